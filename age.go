@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ageThreshold is an age cutoff such as --older-than 18mo. Calendar units are
+// applied with AddDate rather than as fixed durations, so "6 months" means
+// six calendar months back from asOf, not 180 days. The zero threshold is
+// unset.
+type ageThreshold struct {
+	years, months, days int
+}
+
+// monthsAge is the threshold for a whole number of months, as set by
+// --branch-age-months and --repo-age-months
+func monthsAge(months int) ageThreshold {
+	return ageThreshold{months: months}
+}
+
+// ageUnitPattern matches the calendar forms accepted by parseAgeThreshold
+var ageUnitPattern = regexp.MustCompile(`^(\d+)(y|mo|w|d)$`)
+
+// parseAgeThreshold parses an --older-than or --stale-grace-period value: a
+// count of years (2y), months (18mo), weeks (6w) or days (90d). Branch ages
+// are whole days at the finest, so sub-day units such as 72h are rejected,
+// and so is 6m, which reads as minutes to Go but is usually meant as months.
+func parseAgeThreshold(value string) (ageThreshold, error) {
+	if match := ageUnitPattern.FindStringSubmatch(value); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err == nil && n > 0 {
+			switch match[2] {
+			case "y":
+				return ageThreshold{years: n}, nil
+			case "mo":
+				return ageThreshold{months: n}, nil
+			case "w":
+				return ageThreshold{days: 7 * n}, nil
+			case "d":
+				return ageThreshold{days: n}, nil
+			}
+		}
+	}
+	if n, ok := strings.CutSuffix(value, "m"); ok {
+		if _, err := strconv.Atoi(n); err == nil {
+			return ageThreshold{}, fmt.Errorf("invalid age %q (did you mean %smo?)", value, n)
+		}
+	}
+	return ageThreshold{}, fmt.Errorf("invalid age %q (use e.g. 18mo, 2y, 6w or 90d)", value)
+}
+
+// isZero reports whether the threshold is unset
+func (a ageThreshold) isZero() bool {
+	return a == ageThreshold{}
+}
+
+// cutoff returns the time the threshold reaches back to from now; anything
+// before it is older than the threshold
+func (a ageThreshold) cutoff(now time.Time) time.Time {
+	return monthsBefore(now, 12*a.years+a.months).AddDate(0, 0, -a.days)
+}
+
+// monthsBefore steps t back by whole calendar months, keeping its day of the
+// month but clamping it to the end of a shorter month: one month before March
+// 31st is February 28th (29th in a leap year), where AddDate would overflow
+// into March 3rd. This matches calculateMonthsDifference, so a date is older
+// than n months exactly when its age column shows at least n, apart from the
+// time of day on the cutoff date itself.
+func monthsBefore(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()-time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), lastDay)-1)
+}
+
+// olderThan reports whether t lies further back than the threshold from asOf
+func (a ageThreshold) olderThan(t time.Time) bool {
+	return t.Before(a.cutoff(asOf))
+}
+
+// wholeMonths is the threshold in whole calendar months as of asOf, for the
+// summary's branch_age_months
+func (a ageThreshold) wholeMonths() int {
+	return calculateMonthsDifference(a.cutoff(asOf), asOf)
+}
+
+// String describes the threshold for reports, e.g. "6 months" or "90 days"
+func (a ageThreshold) String() string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case a.years != 0:
+		return plural(a.years, "year")
+	case a.days != 0:
+		return plural(a.days, "day")
+	}
+	return plural(a.months, "month")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func ymd(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// setAsOf pins asOf, as --as-of does, for the rest of the test
+func setAsOf(t *testing.T, when time.Time) {
+	t.Helper()
+	saved := asOf
+	asOf = when
+	t.Cleanup(func() { asOf = saved })
+}
+
+func TestCalculateMonthsDifference(t *testing.T) {
+	tests := []struct {
+		start, end time.Time
+		want       int
+	}{
+		{ymd(2023, 1, 15), ymd(2023, 1, 15), 0},
+		{ymd(2023, 1, 15), ymd(2023, 2, 14), 0},
+		{ymd(2023, 1, 15), ymd(2023, 2, 15), 1},
+		{ymd(2022, 11, 30), ymd(2023, 2, 28), 2},
+		// Month ends: February is shorter than the start day
+		{ymd(2023, 1, 31), ymd(2023, 2, 28), 0},
+		{ymd(2023, 1, 31), ymd(2023, 3, 1), 1},
+		{ymd(2024, 1, 31), ymd(2024, 2, 29), 0},
+		{ymd(2023, 2, 28), ymd(2023, 3, 31), 1},
+		{ymd(2024, 2, 29), ymd(2024, 3, 31), 1},
+		{ymd(2023, 3, 31), ymd(2023, 4, 30), 0},
+		// Leap days
+		{ymd(2024, 2, 29), ymd(2025, 2, 28), 11},
+		{ymd(2024, 2, 29), ymd(2025, 3, 1), 12},
+		{ymd(2020, 2, 29), ymd(2024, 2, 29), 48},
+		// A date after end is a negative age
+		{ymd(2023, 3, 1), ymd(2023, 1, 1), -2},
+	}
+	for _, tt := range tests {
+		if got := calculateMonthsDifference(tt.start, tt.end); got != tt.want {
+			t.Errorf("calculateMonthsDifference(%s, %s) = %d, want %d",
+				tt.start.Format("2006-01-02"), tt.end.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestMonthsBeforeClampsToMonthEnd(t *testing.T) {
+	tests := []struct {
+		from   time.Time
+		months int
+		want   time.Time
+	}{
+		{ymd(2023, 3, 31), 1, ymd(2023, 2, 28)},
+		{ymd(2024, 3, 31), 1, ymd(2024, 2, 29)},
+		{ymd(2023, 3, 31), 2, ymd(2023, 1, 31)},
+		{ymd(2023, 5, 31), 1, ymd(2023, 4, 30)},
+		{ymd(2024, 2, 29), 12, ymd(2023, 2, 28)},
+		{ymd(2023, 1, 31), 2, ymd(2022, 11, 30)},
+		{ymd(2023, 7, 15), 6, ymd(2023, 1, 15)},
+	}
+	for _, tt := range tests {
+		if got := monthsBefore(tt.from, tt.months); !got.Equal(tt.want) {
+			t.Errorf("monthsBefore(%s, %d) = %s, want %s", tt.from.Format("2006-01-02"), tt.months,
+				got.Format("2006-01-02"), tt.want.Format("2006-01-02"))
+		}
+	}
+}
+
+// TestIsOlderThanAgreesWithAgeColumn checks, for every --as-of date in a common
+// and a leap year, that dates around the cutoff are never flagged older than n
+// months while their age column shows fewer, nor left unflagged while it shows
+// more.
+func TestIsOlderThanAgreesWithAgeColumn(t *testing.T) {
+	for when := ymd(2023, 1, 1); when.Before(ymd(2025, 1, 1)); when = when.AddDate(0, 0, 1) {
+		setAsOf(t, when)
+		for _, months := range []int{1, 6, 12} {
+			cutoff := monthsBefore(when, months)
+			for offset := -3; offset <= 3; offset++ {
+				branchDate := cutoff.AddDate(0, 0, offset)
+				age := calculateMonthsDifference(branchDate, when)
+				older := isOlderThan(branchDate, months)
+				if older && age < months {
+					t.Fatalf("as of %s, %s is older than %d months but its age is %d",
+						when.Format("2006-01-02"), branchDate.Format("2006-01-02"), months, age)
+				}
+				if !older && age > months {
+					t.Fatalf("as of %s, %s isn't older than %d months but its age is %d",
+						when.Format("2006-01-02"), branchDate.Format("2006-01-02"), months, age)
+				}
+			}
+		}
+	}
+}
+
+func TestOlderThanAsOf(t *testing.T) {
+	setAsOf(t, ymd(2024, 3, 31))
+	tests := []struct {
+		threshold ageThreshold
+		branch    time.Time
+		want      bool
+	}{
+		{monthsAge(1), ymd(2024, 2, 28), true},
+		{monthsAge(1), ymd(2024, 2, 29), false},
+		{monthsAge(1), ymd(2024, 3, 1), false},
+		{monthsAge(2), ymd(2024, 1, 30), true},
+		{monthsAge(2), ymd(2024, 1, 31), false},
+		{ageThreshold{years: 1}, ymd(2023, 3, 30), true},
+		{ageThreshold{years: 1}, ymd(2023, 3, 31), false},
+		{ageThreshold{days: 30}, ymd(2024, 2, 29), true},
+		{ageThreshold{days: 30}, ymd(2024, 3, 1), false},
+	}
+	for _, tt := range tests {
+		if got := tt.threshold.olderThan(tt.branch); got != tt.want {
+			t.Errorf("%s older than %s as of 2024-03-31 = %v, want %v", tt.branch.Format("2006-01-02"), tt.threshold, got, tt.want)
+		}
+	}
+}
+
+func TestParseAgeThreshold(t *testing.T) {
+	tests := []struct {
+		value string
+		want  ageThreshold
+		err   string // substring of the error, empty for success
+	}{
+		{value: "2y", want: ageThreshold{years: 2}},
+		{value: "18mo", want: ageThreshold{months: 18}},
+		{value: "6w", want: ageThreshold{days: 42}},
+		{value: "90d", want: ageThreshold{days: 90}},
+		{value: "6m", err: "did you mean 6mo?"},
+		{value: "72h", err: "invalid age"},
+		{value: "30s", err: "invalid age"},
+		{value: "1h30m", err: "invalid age"},
+		{value: "0d", err: "invalid age"},
+		{value: "-3mo", err: "invalid age"},
+		{value: "", err: "invalid age"},
+	}
+	for _, tt := range tests {
+		got, err := parseAgeThreshold(tt.value)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("parseAgeThreshold(%q) error = %v, want %q", tt.value, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseAgeThreshold(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"strconv"
+)
+
+// countCommitsBetween counts the commits reachable from include but not from
+// exclude, as git rev-list --count exclude..include does, using the commit
+// listing that Bitbucket's own branch comparison is built on. A long history
+// takes a request per 100 commits. Counts are keyed by commit hash and
+// cached, so branches sharing a tip cost one count.
+func (c *BitbucketClient) countCommitsBetween(ctx context.Context, repoFullName, include, exclude string) (int, error) {
+	flavor, ok := c.flavor.(branchCommitsFlavor)
+	if !ok {
+		return 0, errLookupUnsupported
+	}
+
+	key := repoFullName + ":" + exclude + ".." + include
+	c.compareMu.Lock()
+	cached, ok := c.compares[key]
+	c.compareMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	url := flavor.branchCommitsURL(c.baseURL, repoFullName, include, exclude, pageSize)
+	count := 0
+	for url != "" {
+		data, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return 0, err
+		}
+		commits, next, err := c.flavor.parseCommits(data, url)
+		if err != nil {
+			return 0, err
+		}
+		count += len(commits)
+		url = next
+	}
+
+	c.storeCompare(key, count)
+	return count, nil
+}
+
+// storeCompare caches an exact commit count under its exclude..include key
+func (c *BitbucketClient) storeCompare(key string, count int) {
+	c.compareMu.Lock()
+	c.compares[key] = count
+	c.compareMu.Unlock()
+}
+
+// compareBranches returns the commits head has that base doesn't, and the
+// other way round. Where the API has a branch comparison with counts that is
+// a single request; otherwise both sides are counted with
+// countCommitsBetween.
+func (c *BitbucketClient) compareBranches(ctx context.Context, repoFullName, base, head string) (ahead, behind int, err error) {
+	flavor, ok := c.flavor.(compareFlavor)
+	if !ok {
+		if ahead, err = c.countCommitsBetween(ctx, repoFullName, head, base); err != nil {
+			return 0, 0, err
+		}
+		behind, err = c.countCommitsBetween(ctx, repoFullName, base, head)
+		return ahead, behind, err
+	}
+
+	aheadKey := repoFullName + ":" + base + ".." + head
+	behindKey := repoFullName + ":" + head + ".." + base
+	c.compareMu.Lock()
+	ahead, aheadCached := c.compares[aheadKey]
+	behind, behindCached := c.compares[behindKey]
+	c.compareMu.Unlock()
+	if aheadCached && behindCached {
+		return ahead, behind, nil
+	}
+
+	data, err := c.makeRequest(ctx, flavor.compareURL(c.baseURL, repoFullName, base, head))
+	if err != nil {
+		return 0, 0, err
+	}
+	if ahead, behind, err = flavor.parseCompare(data); err != nil {
+		return 0, 0, err
+	}
+	c.storeCompare(aheadKey, ahead)
+	c.storeCompare(behindKey, behind)
+	return ahead, behind, nil
+}
+
+// hasCommitsAhead reports whether head has any commit that base lacks. That
+// is a single one-commit page of the listing countCommitsBetween pages
+// through, or the comparison where the API has one.
+func (c *BitbucketClient) hasCommitsAhead(ctx context.Context, repoFullName, base, head string) (bool, error) {
+	key := repoFullName + ":" + base + ".." + head
+	c.compareMu.Lock()
+	cached, ok := c.compares[key]
+	c.compareMu.Unlock()
+	if ok {
+		return cached > 0, nil
+	}
+
+	flavor, ok := c.flavor.(branchCommitsFlavor)
+	if !ok {
+		ahead, _, err := c.compareBranches(ctx, repoFullName, base, head)
+		return ahead > 0, err
+	}
+	url := flavor.branchCommitsURL(c.baseURL, repoFullName, head, base, 1)
+	data, err := c.makeRequest(ctx, url)
+	if err != nil {
+		return false, err
+	}
+	commits, _, err := c.flavor.parseCommits(data, url)
+	if err != nil {
+		return false, err
+	}
+	if len(commits) == 0 {
+		// None at all is an exact count
+		c.storeCompare(key, 0)
+	}
+	return len(commits) > 0, nil
+}
+
+// mainBranchHash returns the tip of the repository's main branch from its
+// branch list, or "" when it isn't there
+func mainBranchHash(repo Repository, branches []Branch) string {
+	for _, branch := range branches {
+		if branch.Name == repo.MainBranch.Name {
+			return branch.Target.Hash
+		}
+	}
+	return ""
+}
+
+// markAheadBehind returns a copy of branches with Ahead and Behind filled in:
+// the commits each branch has that the main branch doesn't, and the other way
+// round. The main branch itself is 0 and 0. That costs a comparison, or two
+// commit listings, per branch, cached by the client; branches whose counts
+// can't be determined keep nil Ahead and Behind, and the failures are
+// recorded for the end-of-run report.
+func (c *BitbucketClient) markAheadBehind(ctx context.Context, repo Repository, branches []Branch) []Branch {
+	marked := make([]Branch, len(branches))
+	copy(marked, branches)
+
+	mainHash := mainBranchHash(repo, branches)
+	if mainHash == "" {
+		return marked
+	}
+
+	for i := range marked {
+		branch := &marked[i]
+		if branch.Target.Hash == "" {
+			continue
+		}
+		if branch.Target.Hash == mainHash {
+			zero := 0
+			branch.Ahead, branch.Behind = &zero, &zero
+			continue
+		}
+		ahead, behind, err := c.compareBranches(ctx, repo.FullName, mainHash, branch.Target.Hash)
+		if err != nil {
+			c.failures.record(repo.FullName, "ahead/behind count of branch "+branch.Name, err)
+			continue
+		}
+		branch.Ahead, branch.Behind = &ahead, &behind
+	}
+	return marked
+}
+
+// markNotAhead returns a copy of branches with Ahead set to 0 on those without
+// commits the main branch lacks, for --safe-delete. Only whether there are
+// any is checked, one small request per branch, so the others keep a nil
+// Ahead, as do branches that couldn't be checked; those failures are
+// recorded for the end-of-run report.
+func (c *BitbucketClient) markNotAhead(ctx context.Context, repo Repository, branches []Branch) []Branch {
+	marked := make([]Branch, len(branches))
+	copy(marked, branches)
+
+	mainHash := mainBranchHash(repo, branches)
+	if mainHash == "" {
+		return marked
+	}
+
+	zero := 0
+	for i := range marked {
+		branch := &marked[i]
+		if branch.Target.Hash == "" {
+			continue
+		}
+		if branch.Target.Hash == mainHash {
+			branch.Ahead = &zero
+			continue
+		}
+		ahead, err := c.hasCommitsAhead(ctx, repo.FullName, mainHash, branch.Target.Hash)
+		if err != nil {
+			c.failures.record(repo.FullName, "ahead check of branch "+branch.Name, err)
+			continue
+		}
+		if !ahead {
+			branch.Ahead = &zero
+		}
+	}
+	return marked
+}
+
+// aheadBehindColumns formats a branch's Ahead and Behind for CSV, empty when
+// they weren't determined
+func aheadBehindColumns(branch Branch) (string, string) {
+	if branch.Ahead == nil || branch.Behind == nil {
+		return "", ""
+	}
+	return strconv.Itoa(*branch.Ahead), strconv.Itoa(*branch.Behind)
+}
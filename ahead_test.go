@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMarkNotAheadChecksOneCommit(t *testing.T) {
+	var requests []string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path+"?"+r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/repositories/acme/api/commits/f1":
+			fmt.Fprint(w, `{"values": [{"hash": "x"}], "next": "http://example.com/more"}`)
+		case "/repositories/acme/api/commits/s1":
+			fmt.Fprint(w, `{"values": []}`)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	repo := Repository{FullName: "acme/api"}
+	repo.MainBranch.Name = "main"
+	branch := func(name, hash string) Branch {
+		var b Branch
+		b.Name, b.Target.Hash = name, hash
+		return b
+	}
+	branches := []Branch{branch("main", "m1"), branch("feature", "f1"), branch("stale", "s1"), branch("broken", "b1")}
+
+	marked := client.markNotAhead(context.Background(), repo, branches)
+	for i, want := range []string{"0", "nil", "0", "nil"} {
+		got := "nil"
+		if marked[i].Ahead != nil {
+			got = fmt.Sprint(*marked[i].Ahead)
+		}
+		if got != want || marked[i].Behind != nil {
+			t.Errorf("%s: ahead %s, behind %v, want ahead %s and no behind", marked[i].Name, got, marked[i].Behind, want)
+		}
+	}
+	if len(requests) != 3 {
+		t.Errorf("made %d requests, want 3: %v", len(requests), requests)
+	}
+	for _, request := range requests {
+		if !strings.Contains(request, "pagelen=1&") {
+			t.Errorf("request %s doesn't ask for a single commit", request)
+		}
+	}
+	var report strings.Builder
+	if client.failures.report(&report) != 1 || !strings.Contains(report.String(), "broken") {
+		t.Errorf("failure report = %q, want the broken branch", report.String())
+	}
+}
+
+func TestCompareBranchesUsesGitHubComparison(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/repos/acme/api/compare/m1...f1" {
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+		fmt.Fprint(w, `{"ahead_by": 2, "behind_by": 5}`)
+	}))
+	client.flavor = githubFlavor{}
+
+	for i := 0; i < 2; i++ {
+		ahead, behind, err := client.compareBranches(context.Background(), "acme/api", "m1", "f1")
+		if err != nil || ahead != 2 || behind != 5 {
+			t.Errorf("compareBranches = %d, %d, %v, want 2, 5", ahead, behind, err)
+		}
+	}
+	if ahead, err := client.hasCommitsAhead(context.Background(), "acme/api", "m1", "f1"); err != nil || !ahead {
+		t.Errorf("hasCommitsAhead = %v, %v, want true", ahead, err)
+	}
+	if requests != 1 {
+		t.Errorf("made %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// anonymizer replaces people's names with stable pseudonyms so reports can be
+// shared without revealing who owns what. Pseudonyms are derived with a keyed
+// hash, so the same seed always maps the same person to the same pseudonym.
+// A nil anonymizer leaves names untouched.
+type anonymizer struct {
+	key []byte
+}
+
+// newAnonymizer creates an anonymizer keyed by seed. An empty seed generates a
+// random key, so pseudonyms are only consistent within a single run.
+func newAnonymizer(seed string) (*anonymizer, error) {
+	if seed != "" {
+		return &anonymizer{key: []byte(seed)}, nil
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &anonymizer{key: key}, nil
+}
+
+// pseudonym returns the pseudonym for a name
+func (a *anonymizer) pseudonym(name string) string {
+	if a == nil || name == "" {
+		return name
+	}
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(name))
+	return "user-" + hex.EncodeToString(mac.Sum(nil)[:4])
+}
+
+// repository anonymizes the owner of a repository
+func (a *anonymizer) repository(repo *Repository) {
+	if a == nil {
+		return
+	}
+	repo.Owner.DisplayName = a.pseudonym(repo.Owner.DisplayName)
+	repo.Owner.Username = a.pseudonym(repo.Owner.Username)
+}
+
+// branch anonymizes the author of a branch's tip commit
+func (a *anonymizer) branch(branch *Branch) {
+	if a == nil {
+		return
+	}
+	branch.Target.Author.User.DisplayName = a.pseudonym(branch.Target.Author.User.DisplayName)
+	branch.Target.Author.Raw = a.rawAuthor(branch.Target.Author.Raw)
+}
+
+// tag anonymizes the tagger of a tag and the author of the tagged commit
+func (a *anonymizer) tag(tag *Tag) {
+	if a == nil {
+		return
+	}
+	tag.Tagger.User.DisplayName = a.pseudonym(tag.Tagger.User.DisplayName)
+	tag.Tagger.Raw = a.pseudonym(tag.Tagger.Raw)
+	tag.Target.Author.User.DisplayName = a.pseudonym(tag.Target.Author.User.DisplayName)
+}
+
+// commit anonymizes the author of a commit
+func (a *anonymizer) commit(commit *Commit) {
+	if a == nil {
+		return
+	}
+	commit.Author.User.DisplayName = a.pseudonym(commit.Author.User.DisplayName)
+	commit.Author.Raw = a.rawAuthor(commit.Author.Raw)
+}
+
+// rawAuthor anonymizes a raw "Name <email>" author, keeping only the email
+// domain, which isn't personal
+func (a *anonymizer) rawAuthor(raw string) string {
+	if raw == "" {
+		return ""
+	}
+	pseudonym := a.pseudonym(raw)
+	if domain := emailDomain(raw); domain != "" {
+		pseudonym += " <" + pseudonym + "@" + domain + ">"
+	}
+	return pseudonym
+}
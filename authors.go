@@ -0,0 +1,55 @@
+package main
+
+import "strings"
+
+// authorNormalizer maps the different spellings of a person's name to one
+// canonical name, so per-author statistics count each person once. Names are
+// matched after trimming, collapsing whitespace and lowercasing. A nil
+// normalizer leaves names untouched.
+type authorNormalizer struct {
+	fold    bool              // merge names that differ only in case and whitespace
+	aliases map[string]string // folded name -> canonical name, from author_aliases
+	seen    map[string]string // folded name -> first spelling seen
+}
+
+// newAuthorNormalizer returns a normalizer, or nil when there is nothing to normalize
+func newAuthorNormalizer(fold bool, aliases map[string]string) *authorNormalizer {
+	if !fold && len(aliases) == 0 {
+		return nil
+	}
+	n := &authorNormalizer{
+		fold:    fold,
+		aliases: make(map[string]string, len(aliases)),
+		seen:    make(map[string]string),
+	}
+	for name, canonical := range aliases {
+		n.aliases[foldAuthor(name)] = canonical
+	}
+	return n
+}
+
+// foldAuthor trims, collapses whitespace and lowercases a name
+func foldAuthor(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// canonical returns the name to aggregate under. With folding, names that
+// differ only in case and whitespace all become the first spelling seen.
+func (n *authorNormalizer) canonical(name string) string {
+	if n == nil {
+		return name
+	}
+	key := foldAuthor(name)
+	if alias, ok := n.aliases[key]; ok {
+		return alias
+	}
+	if !n.fold {
+		return name
+	}
+	if first, ok := n.seen[key]; ok {
+		return first
+	}
+	first := strings.Join(strings.Fields(name), " ")
+	n.seen[key] = first
+	return first
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// markCreators returns a copy of branches with Creator filled in from each
+// branch's first commit of its own. That costs at least one commit listing
+// request per branch, cached by the client, so branches are looked up on the
+// request pool. The main branch is skipped, as it has no commits that aren't
+// on the main branch; so are branches whose first commit can't be
+// determined, with failed lookups recorded for the end-of-run report.
+func (c *BitbucketClient) markCreators(ctx context.Context, repo Repository, branches []Branch) []Branch {
+	marked := make([]Branch, len(branches))
+	copy(marked, branches)
+
+	forEachIndex(ctx, len(marked), cap(c.requestSlots), func(i int) {
+		branch := &marked[i]
+		if branch.Name == repo.MainBranch.Name {
+			return
+		}
+		first, err := c.getBranchFirstCommit(ctx, repo, branch.Name)
+		if err != nil {
+			// A history too long to search or a missing main branch just
+			// leaves the creator unknown
+			if !errors.Is(err, errHistoryTooLong) && !errors.Is(err, errNoMainBranch) && !errors.Is(err, errLookupUnsupported) {
+				c.failures.record(repo.FullName, "creator lookup of branch "+branch.Name, err)
+			}
+			return
+		}
+		if first != nil {
+			branch.Creator = commitAuthorName(first)
+		}
+	})
+	return marked
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// responseCache stores successful API responses on disk, keyed by request
+// URL, so repeated runs against the same workspace skip the network. Entries
+// live in a directory per credential identity so responses never leak
+// between users. A nil cache does nothing.
+type responseCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// cacheRoot returns the directory holding all cached responses
+func cacheRoot() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("locating cache directory: %w", err)
+	}
+	return filepath.Join(base, "bhunter", "responses"), nil
+}
+
+// newResponseCache returns a cache for the given identity (credentials and
+// workspace), whose entries expire after ttl
+func newResponseCache(ttl time.Duration, identity string) (*responseCache, error) {
+	root, err := cacheRoot()
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(root, hashKey(identity))
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("creating cache directory: %w", err)
+	}
+	return &responseCache{dir: dir, ttl: ttl}, nil
+}
+
+// clearResponseCache removes every cached response
+func clearResponseCache() error {
+	root, err := cacheRoot()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(root)
+}
+
+func hashKey(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *responseCache) path(url string) string {
+	return filepath.Join(c.dir, hashKey(url))
+}
+
+// get returns the cached response for url if it hasn't expired
+func (c *responseCache) get(url string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	path := c.path(url)
+	info, err := os.Stat(path)
+	if err != nil || time.Since(info.ModTime()) > c.ttl {
+		return nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// put stores a response. Write failures only cost a future cache miss, so
+// they are ignored.
+func (c *responseCache) put(url string, data []byte) {
+	if c == nil {
+		return
+	}
+	// Write to a temporary file first so concurrent readers never see a partial entry
+	tmp, err := os.CreateTemp(c.dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), c.path(url)); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// getLatestCommit returns the most recent commit in a repository. Commits are
+// listed newest first, so a single one-commit page is enough. Results are
+// cached per client.
+func (c *BitbucketClient) getLatestCommit(ctx context.Context, repoFullName string) (*Commit, error) {
+	c.latestCommitMu.Lock()
+	cached, ok := c.latestCommits[repoFullName]
+	c.latestCommitMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	url := c.flavor.commitsURL(c.baseURL, repoFullName, 1)
+	data, err := c.makeCommitsRequest(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, _, err := c.flavor.parseCommits(data, url)
+	if err != nil {
+		return nil, err
+	}
+	if len(commits) == 0 {
+		return nil, errNoCommits
+	}
+
+	commit := &commits[0]
+	c.anonymizer.commit(commit)
+
+	c.latestCommitMu.Lock()
+	c.latestCommits[repoFullName] = commit
+	c.latestCommitMu.Unlock()
+
+	return commit, nil
+}
+
+// commitAuthorName names a commit's author: the linked Bitbucket user if any,
+// otherwise the name part of the raw "Name <email>" author
+func commitAuthorName(commit *Commit) string {
+	if commit.Author.User.DisplayName != "" {
+		return commit.Author.User.DisplayName
+	}
+	return rawAuthorName(commit.Author.Raw)
+}
+
+// rawAuthorName returns the name part of a raw "Name <email>" author, or the
+// email when the name is missing
+func rawAuthorName(raw string) string {
+	name, email, _ := strings.Cut(raw, "<")
+	if name = strings.TrimSpace(name); name != "" {
+		return name
+	}
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(email), ">"))
+}
+
+// commitStatsLimit caps the commits --commit-stats counts per repository, a
+// hundred requests; larger histories are reported as at least this many
+const commitStatsLimit = 10000
+
+// commitStats are the per-repository commit totals reported by --commit-stats
+type commitStats struct {
+	total      int
+	capped     bool // total is a lower bound: counting stopped at commitStatsLimit
+	lastAuthor string
+	err        error
+}
+
+// totalText formats the total for display and CSV, e.g. "10000+" when capped
+func (s commitStats) totalText() string {
+	if s.capped {
+		return strconv.Itoa(s.total) + "+"
+	}
+	return strconv.Itoa(s.total)
+}
+
+// lookupCommitStats returns the total commit count, up to commitStatsLimit,
+// and latest committer of a repository. Both lookups are cached by the client.
+func lookupCommitStats(ctx context.Context, repo Repository, client *BitbucketClient) commitStats {
+	total, complete, err := client.getCommitCount(ctx, repo.FullName, commitStatsLimit)
+	if err != nil {
+		return commitStats{err: err}
+	}
+	if total == 0 {
+		return commitStats{}
+	}
+	stats := commitStats{total: total, capped: !complete}
+	latest, err := client.getLatestCommit(ctx, repo.FullName)
+	if err != nil {
+		stats.err = err
+		return stats
+	}
+	stats.lastAuthor = commitAuthorName(latest)
+	return stats
+}
+
+// prefetchCommitStats looks up the commit stats of repos concurrently, so
+// later output is served from the client's caches
+func prefetchCommitStats(ctx context.Context, repos []Repository, client *BitbucketClient, maxConcurrency int) {
+	forEachRepo(ctx, repos, maxConcurrency, func(_ int, r Repository) {
+		lookupCommitStats(ctx, r, client)
+	})
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"os"
+	"strings"
+)
+
+// listingCursor persists the repository listing's next-page URL so a scan of
+// a very large workspace can be split across runs. A nil cursor does nothing.
+type listingCursor struct {
+	path      string
+	resumeURL string // page to start from, consumed by the first listing
+	maxPages  int    // stop listing after this many pages (0 = no limit)
+}
+
+// loadCursor reads a cursor file written by an earlier run
+func loadCursor(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("cursor file %s not found (the previous scan may have finished)", path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading cursor file %s: %w", path, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// validateCursor checks that a cursor URL lists repositories of workspace on
+// the API at baseURL, so a cursor can't resume a different workspace's scan
+func validateCursor(cursorURL string, flavor apiFlavor, baseURL, workspace string) error {
+	parsed, err := neturl.Parse(cursorURL)
+	if err != nil {
+		return fmt.Errorf("invalid cursor URL %q: %w", cursorURL, err)
+	}
+	listURL, err := flavor.repositoriesURL(baseURL, workspace, "", "", pageSize)
+	if err != nil {
+		return err
+	}
+	listing, err := neturl.Parse(listURL)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != listing.Scheme || parsed.Host != listing.Host || parsed.EscapedPath() != listing.EscapedPath() {
+		return fmt.Errorf("cursor URL %q is not a repository listing for workspace %s", cursorURL, workspace)
+	}
+	return nil
+}
+
+// takeResumeURL returns the page to resume from, once
+func (c *listingCursor) takeResumeURL() string {
+	if c == nil {
+		return ""
+	}
+	url := c.resumeURL
+	c.resumeURL = ""
+	return url
+}
+
+// save records the next page to fetch. When there are no more pages the
+// cursor file is removed, since the scan is complete.
+func (c *listingCursor) save(next string) error {
+	if c == nil {
+		return nil
+	}
+	if next == "" {
+		if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("removing cursor file %s: %w", c.path, err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(c.path, []byte(next+"\n"), 0644); err != nil {
+		return fmt.Errorf("writing cursor file %s: %w", c.path, err)
+	}
+	return nil
+}
+
+// pageLimitReached reports whether listing should stop after pages pages
+func (c *listingCursor) pageLimitReached(pages int) bool {
+	return c != nil && c.maxPages > 0 && pages >= c.maxPages
+}
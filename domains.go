@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultEmailSample is how many recent commits per repository are sampled by
+// --commit-email-domains
+const defaultEmailSample = 100
+
+// personalEmailDomains are flagged when no corporate domains are configured
+var personalEmailDomains = []string{
+	"gmail.com", "googlemail.com", "outlook.com", "hotmail.com", "live.com",
+	"yahoo.com", "icloud.com", "me.com", "protonmail.com", "proton.me", "aol.com",
+}
+
+// emailDomain extracts the lowercased email domain from a raw commit author
+// such as "Jane Doe <jane@example.com>". It returns "" when there is no email.
+func emailDomain(raw string) string {
+	start := strings.LastIndex(raw, "<")
+	end := strings.LastIndex(raw, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	email := raw[start+1 : end]
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+// domainClassifier decides which email domains are flagged as non-corporate.
+// With corporate domains configured, everything else (other than their
+// subdomains) is flagged; otherwise well-known personal providers are.
+type domainClassifier struct {
+	corporate []string
+}
+
+// flagged reports whether commits from domain should be called out
+func (d *domainClassifier) flagged(domain string) bool {
+	if len(d.corporate) == 0 {
+		for _, personal := range personalEmailDomains {
+			if domain == personal {
+				return true
+			}
+		}
+		return false
+	}
+	for _, corporate := range d.corporate {
+		corporate = strings.ToLower(corporate)
+		if domain == corporate || strings.HasSuffix(domain, "."+corporate) {
+			return false
+		}
+	}
+	return true
+}
+
+// DomainCount is the number of sampled commits from one email domain
+type DomainCount struct {
+	Domain  string
+	Commits int
+}
+
+// repoDomains is the email domain distribution of a repository's recent commits
+type repoDomains struct {
+	Repository Repository
+	Domains    []DomainCount
+	Error      error
+}
+
+// getRecentCommits fetches up to limit of a repository's most recent commits
+func (c *BitbucketClient) getRecentCommits(ctx context.Context, repoFullName string, limit int) ([]Commit, error) {
+	var commits []Commit
+	url := c.flavor.commitsURL(c.baseURL, repoFullName, min(limit, pageSize))
+
+	for url != "" && len(commits) < limit {
+		data, err := c.makeCommitsRequest(ctx, url)
+		if errors.Is(err, errNoCommits) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		page, next, err := c.flavor.parseCommits(data, url)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range page {
+			c.anonymizer.commit(&page[i])
+		}
+		commits = append(commits, page...)
+		url = next
+	}
+
+	if len(commits) > limit {
+		commits = commits[:limit]
+	}
+	return commits, nil
+}
+
+// countDomains tallies commits by email domain, most common first. Commits
+// without an email are counted under "(none)".
+func countDomains(commits []Commit) []DomainCount {
+	counts := make(map[string]int)
+	for _, commit := range commits {
+		domain := emailDomain(commit.Author.Raw)
+		if domain == "" {
+			domain = "(none)"
+		}
+		counts[domain]++
+	}
+	return sortedDomainCounts(counts)
+}
+
+// sortedDomainCounts orders domain counts by commits, then by domain
+func sortedDomainCounts(counts map[string]int) []DomainCount {
+	result := make([]DomainCount, 0, len(counts))
+	for domain, commits := range counts {
+		result = append(result, DomainCount{Domain: domain, Commits: commits})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Commits != result[j].Commits {
+			return result[i].Commits > result[j].Commits
+		}
+		return result[i].Domain < result[j].Domain
+	})
+	return result
+}
+
+// collectEmailDomains samples recent commits of every repository concurrently,
+// keeping the input order
+func collectEmailDomains(ctx context.Context, repos []Repository, client *BitbucketClient, sample, maxConcurrency int) []repoDomains {
+	results := make([]repoDomains, len(repos))
+	forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+		commits, err := client.getRecentCommits(ctx, r.FullName, sample)
+		results[i] = repoDomains{Repository: r, Domains: countDomains(commits), Error: err}
+	})
+
+	return results
+}
+
+// workspaceDomains combines the per-repository distributions
+func workspaceDomains(results []repoDomains) []DomainCount {
+	counts := make(map[string]int)
+	for _, result := range results {
+		for _, dc := range result.Domains {
+			counts[dc.Domain] += dc.Commits
+		}
+	}
+	return sortedDomainCounts(counts)
+}
+
+// outputEmailDomains prints the workspace-wide and per-repository email domain
+// distributions, flagging non-corporate domains. CSV rows for the workspace
+// totals use "(workspace)" as the repository name.
+func outputEmailDomains(w io.Writer, results []repoDomains, classifier *domainClassifier, asCSV bool, bold, red, yellow func(a ...interface{}) string) error {
+	totals := workspaceDomains(results)
+
+	if asCSV {
+		if err := writeCSVHeader(w, "Repository Name", "Domain", "Commits", "Flagged"); err != nil {
+			return err
+		}
+		for _, dc := range totals {
+			if err := writeCSVRow(w, "(workspace)", dc.Domain, strconv.Itoa(dc.Commits), strconv.FormatBool(classifier.flagged(dc.Domain))); err != nil {
+				return err
+			}
+		}
+		for _, result := range results {
+			for _, dc := range result.Domains {
+				if err := writeCSVRow(w, result.Repository.Name, dc.Domain, strconv.Itoa(dc.Commits), strconv.FormatBool(classifier.flagged(dc.Domain))); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	formatCount := func(dc DomainCount) string {
+		line := fmt.Sprintf("%-30s %d", dc.Domain, dc.Commits)
+		if classifier.flagged(dc.Domain) {
+			return red(line + "  (non-corporate)")
+		}
+		return line
+	}
+
+	fmt.Printf("\n%s\n", bold("Commit email domains (workspace):"))
+	for _, dc := range totals {
+		fmt.Printf("  %s\n", formatCount(dc))
+	}
+
+	for _, result := range results {
+		fmt.Printf("\n%s\n", bold(result.Repository.DisplayName()))
+		if result.Error != nil {
+			fmt.Printf("  %s\n", yellow("Error fetching commits: "+result.Error.Error()))
+			continue
+		}
+		if len(result.Domains) == 0 {
+			fmt.Println("  (no commits)")
+			continue
+		}
+		for _, dc := range result.Domains {
+			fmt.Printf("  %s\n", formatCount(dc))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// branchSpread is a branch name and the repositories it appears in
+type branchSpread struct {
+	Name  string
+	Repos []string // full names, in repository order
+}
+
+// findDuplicateBranches aggregates branch names across the workspace and
+// returns those found in more than minRepos repositories, most widespread
+// first. Default and protected branches are left out, since they exist
+// everywhere by design. Repositories whose branches can't be fetched are skipped.
+func findDuplicateBranches(ctx context.Context, repos []Repository, provider Provider, protection *branchProtection, minRepos, maxConcurrency int) []branchSpread {
+	names := make([][]string, len(repos))
+	forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+		branches, err := provider.getBranches(ctx, r.FullName)
+		if err != nil {
+			return
+		}
+		for _, branch := range branches {
+			if branch.Name == r.MainBranch.Name || protection.isProtected(branch.Name) {
+				continue
+			}
+			names[i] = append(names[i], branch.Name)
+		}
+	})
+
+	reposByName := make(map[string][]string)
+	for i, repo := range repos {
+		for _, name := range names[i] {
+			reposByName[name] = append(reposByName[name], repo.FullName)
+		}
+	}
+
+	var spreads []branchSpread
+	for name, repoNames := range reposByName {
+		if len(repoNames) > minRepos {
+			spreads = append(spreads, branchSpread{Name: name, Repos: repoNames})
+		}
+	}
+	sort.Slice(spreads, func(i, j int) bool {
+		if len(spreads[i].Repos) != len(spreads[j].Repos) {
+			return len(spreads[i].Repos) > len(spreads[j].Repos)
+		}
+		return spreads[i].Name < spreads[j].Name
+	})
+	return spreads
+}
+
+// outputDuplicateBranches prints the widespread branch names with their repositories
+func outputDuplicateBranches(w io.Writer, spreads []branchSpread, minRepos int, asCSV bool, bold, cyan func(a ...interface{}) string) error {
+	if asCSV {
+		if err := writeCSVHeader(w, "Branch Name", "Repository Count", "Repositories"); err != nil {
+			return err
+		}
+		for _, spread := range spreads {
+			if err := writeCSVRow(w, spread.Name, strconv.Itoa(len(spread.Repos)), strings.Join(spread.Repos, " ")); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(spreads) == 0 {
+		fmt.Printf("\nNo branch names appear in more than %d repositories\n", minRepos)
+		return nil
+	}
+	fmt.Printf("\n%s\n", bold(fmt.Sprintf("Branch names in more than %d repositories (%d):", minRepos, len(spreads))))
+	for _, spread := range spreads {
+		fmt.Printf("  %s (%d repositories)\n", cyan(spread.Name), len(spread.Repos))
+		for _, repoName := range spread.Repos {
+			fmt.Printf("    %s\n", repoName)
+		}
+	}
+	return nil
+}
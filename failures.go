@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// repoFailure is a lookup that failed for one repository
+type repoFailure struct {
+	repo string
+	step string // what failed, e.g. "branch listing"
+	err  error
+}
+
+// failureLog collects per-repository failures so they can be reported at the
+// end of a run instead of silently leaving gaps in the output. It is safe for
+// concurrent use. Only the latest outcome of each step counts: a lookup that
+// fails and later succeeds on retry is no longer reported.
+type failureLog struct {
+	mu       sync.Mutex
+	failures map[string]repoFailure
+}
+
+func newFailureLog() *failureLog {
+	return &failureLog{failures: make(map[string]repoFailure)}
+}
+
+// record notes that step failed for a repository
+func (l *failureLog) record(repo, step string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.failures[repo+"\x00"+step] = repoFailure{repo: repo, step: step, err: err}
+}
+
+// clear forgets an earlier failure of step once it has succeeded
+func (l *failureLog) clear(repo, step string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, repo+"\x00"+step)
+}
+
+// report prints the failures, sorted by repository, and returns how many
+// repositories had at least one
+func (l *failureLog) report(w io.Writer) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.failures) == 0 {
+		return 0
+	}
+
+	failures := make([]repoFailure, 0, len(l.failures))
+	repos := make(map[string]bool)
+	for _, failure := range l.failures {
+		failures = append(failures, failure)
+		repos[failure.repo] = true
+	}
+	sort.Slice(failures, func(i, j int) bool {
+		if failures[i].repo != failures[j].repo {
+			return failures[i].repo < failures[j].repo
+		}
+		return failures[i].step < failures[j].step
+	})
+
+	fmt.Fprintf(w, "\nWarning: %d repositories could not be read completely; the report is missing their data:\n", len(repos))
+	for _, failure := range failures {
+		fmt.Fprintf(w, "  %s: %s failed: %v\n", failure.repo, failure.step, failure.err)
+	}
+	return len(repos)
+}
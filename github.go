@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"time"
+)
+
+// githubFlavor is the GitHub REST API. The workspace is an organization,
+// repositories are named owner/repo, and pages are requested by number.
+type githubFlavor struct{}
+
+// githubRepository is a repository as returned by the GitHub API
+type githubRepository struct {
+	Name          string    `json:"name"`
+	FullName      string    `json:"full_name"`
+	Description   string    `json:"description"`
+	HTMLURL       string    `json:"html_url"`
+	DefaultBranch string    `json:"default_branch"`
+	Language      string    `json:"language"`
+	Size          int64     `json:"size"` // kilobytes
+	Archived      bool      `json:"archived"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	PushedAt      time.Time `json:"pushed_at"`
+	Owner         struct {
+		Login string `json:"login"`
+	} `json:"owner"`
+}
+
+// toRepository converts the repository into the Bitbucket Cloud shape
+func (value githubRepository) toRepository() Repository {
+	var repo Repository
+	repo.Name = value.Name
+	repo.FullName = value.FullName
+	repo.Description = value.Description
+	repo.Links.HTML.Href = value.HTMLURL
+	repo.MainBranch.Name = value.DefaultBranch
+	repo.Language = value.Language
+	repo.Size = value.Size * 1024
+	repo.Archived = value.Archived
+	repo.CreatedOn = value.CreatedAt
+	// updated_at also moves for metadata changes such as stars, so the last
+	// push is the better measure of activity
+	repo.UpdatedOn = value.PushedAt
+	if repo.UpdatedOn.IsZero() {
+		repo.UpdatedOn = value.UpdatedAt
+	}
+	repo.Owner.DisplayName = value.Owner.Login
+	repo.Owner.Username = value.Owner.Login
+	return repo
+}
+
+// githubCommit is a commit as returned by the GitHub API
+type githubCommit struct {
+	SHA    string `json:"sha"`
+	Commit struct {
+		Author struct {
+			Name  string    `json:"name"`
+			Email string    `json:"email"`
+			Date  time.Time `json:"date"`
+		} `json:"author"`
+		Message string `json:"message"`
+	} `json:"commit"`
+}
+
+// toCommit converts the commit into the Bitbucket Cloud shape
+func (value githubCommit) toCommit() Commit {
+	var commit Commit
+	commit.Hash = value.SHA
+	commit.Date = value.Commit.Author.Date
+	commit.Message = value.Commit.Message
+	commit.Author.Raw = fmt.Sprintf("%s <%s>", value.Commit.Author.Name, value.Commit.Author.Email)
+	commit.Author.User.DisplayName = value.Commit.Author.Name
+	return commit
+}
+
+func (githubFlavor) repositoriesURL(baseURL, workspace, query, role string, pageLen int) (string, error) {
+	if query != "" || role != "" {
+		return "", errFilterUnsupported
+	}
+	return fmt.Sprintf("%s/orgs/%s/repos?per_page=%d&type=all", baseURL, neturl.PathEscape(workspace), pageLen), nil
+}
+
+func (githubFlavor) repositoryURL(baseURL, workspace, repoSlug string) string {
+	return fmt.Sprintf("%s/repos/%s/%s", baseURL, neturl.PathEscape(workspace), neturl.PathEscape(repoSlug))
+}
+
+func (githubFlavor) parseRepositories(data []byte, pageURL string) ([]Repository, string, error) {
+	var values []githubRepository
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	repos := make([]Repository, len(values))
+	for i, value := range values {
+		repos[i] = value.toRepository()
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return repos, next, err
+}
+
+func (githubFlavor) parseRepository(data []byte) (*Repository, error) {
+	var value githubRepository
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	repo := value.toRepository()
+	return &repo, nil
+}
+
+// repositoryWebURL maps api.github.com to github.com, and a GitHub
+// Enterprise Server's /api/v3 to the server itself
+func (githubFlavor) repositoryWebURL(baseURL, repoFullName string) string {
+	return webRoot(baseURL, "/api/v3") + "/" + repoFullName
+}
+
+func (githubFlavor) currentUserURL(baseURL string) string {
+	return baseURL + "/user"
+}
+
+func (githubFlavor) parseCurrentUser(data []byte) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := json.Unmarshal(data, &user); err != nil {
+		return "", err
+	}
+	return user.Login, nil
+}
+
+func (githubFlavor) branchesURL(baseURL, repoFullName string, pageLen int) string {
+	return fmt.Sprintf("%s/repos/%s/branches?per_page=%d", baseURL, repoFullName, pageLen)
+}
+
+func (githubFlavor) parseBranches(data []byte, pageURL string) ([]Branch, string, error) {
+	var values []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	// Branch listings carry only the tip hash; getBranches resolves the date
+	// and author from the tip commit
+	branches := make([]Branch, len(values))
+	for i, value := range values {
+		branches[i].Name = value.Name
+		branches[i].Target.Hash = value.Commit.SHA
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return branches, next, err
+}
+
+func (githubFlavor) tagsURL(baseURL, repoFullName string) string {
+	return fmt.Sprintf("%s/repos/%s/tags?per_page=%d", baseURL, repoFullName, pageSize)
+}
+
+func (githubFlavor) parseTags(data []byte, pageURL string) ([]Tag, string, error) {
+	var values []struct {
+		Name   string `json:"name"`
+		Commit struct {
+			SHA string `json:"sha"`
+		} `json:"commit"`
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	tags := make([]Tag, len(values))
+	for i, value := range values {
+		tags[i].Name = value.Name
+		tags[i].Target.Hash = value.Commit.SHA
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return tags, next, err
+}
+
+func (githubFlavor) commitURL(baseURL, repoFullName, hash string) string {
+	return fmt.Sprintf("%s/repos/%s/commits/%s", baseURL, repoFullName, hash)
+}
+
+func (githubFlavor) parseCommit(data []byte) (*Commit, error) {
+	var value githubCommit
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	commit := value.toCommit()
+	return &commit, nil
+}
+
+func (githubFlavor) commitsURL(baseURL, repoFullName string, pageLen int) string {
+	return fmt.Sprintf("%s/repos/%s/commits?per_page=%d", baseURL, repoFullName, pageLen)
+}
+
+func (githubFlavor) compareURL(baseURL, repoFullName, base, head string) string {
+	// Only the counts are wanted, so keep the embedded commit list short
+	return fmt.Sprintf("%s/repos/%s/compare/%s...%s?per_page=1",
+		baseURL, repoFullName, neturl.PathEscape(base), neturl.PathEscape(head))
+}
+
+func (githubFlavor) parseCompare(data []byte) (int, int, error) {
+	var value struct {
+		AheadBy  int `json:"ahead_by"`
+		BehindBy int `json:"behind_by"`
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return 0, 0, err
+	}
+	return value.AheadBy, value.BehindBy, nil
+}
+
+func (githubFlavor) parseCommits(data []byte, pageURL string) ([]Commit, string, error) {
+	var values []githubCommit
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	commits := make([]Commit, len(values))
+	for i, value := range values {
+		commits[i] = value.toCommit()
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return commits, next, err
+}
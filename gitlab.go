@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"time"
+)
+
+// gitlabFlavor is the GitLab REST API v4. The workspace is a group (including
+// its subgroups), repositories are named by their full project path, and
+// pages are requested by number.
+type gitlabFlavor struct{}
+
+// gitlabProjectPath escapes a project path such as group/sub/project into
+// the single path segment GitLab accepts in place of a project ID
+func gitlabProjectPath(repoFullName string) string {
+	return neturl.PathEscape(repoFullName)
+}
+
+// gitlabProject is a project as returned by the GitLab API
+type gitlabProject struct {
+	Name              string    `json:"name"`
+	PathWithNamespace string    `json:"path_with_namespace"`
+	Description       string    `json:"description"`
+	WebURL            string    `json:"web_url"`
+	DefaultBranch     string    `json:"default_branch"`
+	Archived          bool      `json:"archived"`
+	CreatedAt         time.Time `json:"created_at"`
+	LastActivityAt    time.Time `json:"last_activity_at"`
+	Namespace         struct {
+		Name     string `json:"name"`
+		FullPath string `json:"full_path"`
+	} `json:"namespace"`
+	// Owner is only set for projects in a user's personal namespace
+	Owner *struct {
+		Name     string `json:"name"`
+		Username string `json:"username"`
+	} `json:"owner"`
+}
+
+// toRepository converts the project into the Bitbucket Cloud shape. The
+// namespace stands in for the Bitbucket project, so --include and --exclude
+// can select subgroups.
+func (value gitlabProject) toRepository() Repository {
+	var repo Repository
+	repo.Name = value.Name
+	repo.FullName = value.PathWithNamespace
+	repo.Description = value.Description
+	repo.Links.HTML.Href = value.WebURL
+	repo.MainBranch.Name = value.DefaultBranch
+	repo.Archived = value.Archived
+	repo.CreatedOn = value.CreatedAt
+	repo.UpdatedOn = value.LastActivityAt
+	repo.Project.Key = value.Namespace.FullPath
+	repo.Project.Name = value.Namespace.Name
+	if value.Owner != nil {
+		repo.Owner.DisplayName = value.Owner.Name
+		repo.Owner.Username = value.Owner.Username
+	} else {
+		repo.Owner.DisplayName = value.Namespace.Name
+		repo.Owner.Username = value.Namespace.FullPath
+	}
+	// Sizes are only returned with statistics=true, which needs extra
+	// permissions; a non-zero size keeps projects from counting as empty
+	repo.Size = -1
+	return repo
+}
+
+// gitlabCommit is a commit as returned by the GitLab API
+type gitlabCommit struct {
+	ID            string    `json:"id"`
+	AuthorName    string    `json:"author_name"`
+	AuthorEmail   string    `json:"author_email"`
+	CommittedDate time.Time `json:"committed_date"`
+	Message       string    `json:"message"`
+}
+
+// toCommit converts the commit into the Bitbucket Cloud shape
+func (value gitlabCommit) toCommit() Commit {
+	var commit Commit
+	commit.Hash = value.ID
+	commit.Date = value.CommittedDate
+	commit.Message = value.Message
+	commit.Author.Raw = fmt.Sprintf("%s <%s>", value.AuthorName, value.AuthorEmail)
+	commit.Author.User.DisplayName = value.AuthorName
+	return commit
+}
+
+func (gitlabFlavor) repositoriesURL(baseURL, workspace, query, role string, pageLen int) (string, error) {
+	if query != "" || role != "" {
+		return "", errFilterUnsupported
+	}
+	return fmt.Sprintf("%s/groups/%s/projects?per_page=%d&include_subgroups=true", baseURL, gitlabProjectPath(workspace), pageLen), nil
+}
+
+func (gitlabFlavor) repositoryURL(baseURL, workspace, repoSlug string) string {
+	return fmt.Sprintf("%s/projects/%s", baseURL, gitlabProjectPath(workspace+"/"+repoSlug))
+}
+
+func (gitlabFlavor) parseRepositories(data []byte, pageURL string) ([]Repository, string, error) {
+	var values []gitlabProject
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	repos := make([]Repository, len(values))
+	for i, value := range values {
+		repos[i] = value.toRepository()
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return repos, next, err
+}
+
+func (gitlabFlavor) parseRepository(data []byte) (*Repository, error) {
+	var value gitlabProject
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	repo := value.toRepository()
+	return &repo, nil
+}
+
+func (gitlabFlavor) repositoryWebURL(baseURL, repoFullName string) string {
+	return webRoot(baseURL, "/api/v4") + "/" + repoFullName
+}
+
+func (gitlabFlavor) currentUserURL(baseURL string) string {
+	return baseURL + "/user"
+}
+
+func (gitlabFlavor) parseCurrentUser(data []byte) (string, error) {
+	var user struct {
+		Username string `json:"username"`
+	}
+	if err := json.Unmarshal(data, &user); err != nil {
+		return "", err
+	}
+	return user.Username, nil
+}
+
+func (gitlabFlavor) branchesURL(baseURL, repoFullName string, pageLen int) string {
+	return fmt.Sprintf("%s/projects/%s/repository/branches?per_page=%d", baseURL, gitlabProjectPath(repoFullName), pageLen)
+}
+
+func (gitlabFlavor) parseBranches(data []byte, pageURL string) ([]Branch, string, error) {
+	var values []struct {
+		Name   string       `json:"name"`
+		Commit gitlabCommit `json:"commit"`
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	branches := make([]Branch, len(values))
+	for i, value := range values {
+		branch := &branches[i]
+		branch.Name = value.Name
+		branch.Target.Hash = value.Commit.ID
+		branch.Target.Date = value.Commit.CommittedDate
+		branch.Target.Author.User.DisplayName = value.Commit.AuthorName
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return branches, next, err
+}
+
+func (gitlabFlavor) tagsURL(baseURL, repoFullName string) string {
+	return fmt.Sprintf("%s/projects/%s/repository/tags?per_page=%d", baseURL, gitlabProjectPath(repoFullName), pageSize)
+}
+
+func (gitlabFlavor) parseTags(data []byte, pageURL string) ([]Tag, string, error) {
+	var values []struct {
+		Name   string       `json:"name"`
+		Commit gitlabCommit `json:"commit"`
+	}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	// GitLab doesn't name an annotated tag's tagger, so the tagged commit's
+	// author stands in for it
+	tags := make([]Tag, len(values))
+	for i, value := range values {
+		tag := &tags[i]
+		tag.Name = value.Name
+		tag.Target.Hash = value.Commit.ID
+		tag.Target.Date = value.Commit.CommittedDate
+		tag.Target.Author.User.DisplayName = value.Commit.AuthorName
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return tags, next, err
+}
+
+func (gitlabFlavor) commitURL(baseURL, repoFullName, hash string) string {
+	return fmt.Sprintf("%s/projects/%s/repository/commits/%s", baseURL, gitlabProjectPath(repoFullName), hash)
+}
+
+func (gitlabFlavor) parseCommit(data []byte) (*Commit, error) {
+	var value gitlabCommit
+	if err := json.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	commit := value.toCommit()
+	return &commit, nil
+}
+
+func (gitlabFlavor) commitsURL(baseURL, repoFullName string, pageLen int) string {
+	return fmt.Sprintf("%s/projects/%s/repository/commits?per_page=%d", baseURL, gitlabProjectPath(repoFullName), pageLen)
+}
+
+func (gitlabFlavor) parseCommits(data []byte, pageURL string) ([]Commit, string, error) {
+	var values []gitlabCommit
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, "", err
+	}
+
+	commits := make([]Commit, len(values))
+	for i, value := range values {
+		commits[i] = value.toCommit()
+	}
+
+	next, err := nextPageNumberURL(pageURL, len(values))
+	return commits, next, err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"os"
+)
+
+// htmlReport is the data behind the --html report
+type htmlReport struct {
+	Target    string
+	Generated string
+	Stats     *SummaryStats
+	RepoOnly  bool
+	Repos     []htmlRepo
+}
+
+// htmlRepo is one repository row of the --html report
+type htmlRepo struct {
+	Name       string
+	Owner      string
+	Creator    string
+	Created    string
+	LastAccess string
+	AgeMonths  int
+	Old        bool // no access within the repository threshold, shown yellow
+	// CreatedUnknown is set when there is no creation date (Data Center), so no age
+	CreatedUnknown bool
+	Error          string
+	Branches       []htmlBranch
+}
+
+// htmlBranch is one branch row of the --html report
+type htmlBranch struct {
+	Name         string
+	LastPushed   string
+	LastPushedBy string
+	AgeMonths    int
+	Old          bool // past the branch threshold, shown red
+	Unknown      bool // no push date, so no age
+}
+
+// htmlTemplate is self-contained, with inline CSS, so the report can be
+// emailed or hosted without any other files
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Bitbucket Repository Report: {{.Target}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #172b4d; }
+h1 { font-size: 1.6em; }
+h2 { font-size: 1.3em; margin-top: 1.5em; }
+table { border-collapse: collapse; margin: 0.5em 0 1em; }
+th, td { border: 1px solid #dfe1e6; padding: 4px 10px; text-align: left; }
+th { background: #f4f5f7; }
+td.num { text-align: right; }
+tr.old-repo td { background: #fff4c2; }
+tr.old-branch td { background: #ffd5d2; }
+.stats td:first-child { font-weight: 600; }
+.branches { margin-left: 2em; }
+.error { color: #bf2600; }
+.legend span { padding: 2px 8px; margin-right: 1em; }
+</style>
+</head>
+<body>
+<h1>Bitbucket Repository Report: {{.Target}}</h1>
+<p>Generated {{.Generated}}.
+<span class="legend"><span style="background: #fff4c2">old repository (no access for &gt;{{.Stats.RepoAgeMonths}} months)</span>{{if not .RepoOnly}}<span style="background: #ffd5d2">old branch (no push for &gt;{{.Stats.BranchAge}})</span>{{end}}</span></p>
+
+<h2>Summary</h2>
+<table class="stats">
+<tr><td>Total Repositories</td><td class="num">{{.Stats.TotalRepos}}</td></tr>
+<tr><td>Recent Repositories</td><td class="num">{{.Stats.RecentRepos}}</td></tr>
+<tr><td>Old Repositories</td><td class="num">{{.Stats.OldRepos}}</td></tr>
+{{- if not .RepoOnly}}
+<tr><td>Total Branches</td><td class="num">{{.Stats.TotalBranches}}</td></tr>
+<tr><td>Recent Branches</td><td class="num">{{.Stats.RecentBranches}}</td></tr>
+<tr><td>Old Branches</td><td class="num">{{.Stats.OldBranches}}</td></tr>
+{{- if .Stats.UnknownBranches}}
+<tr><td>Branches With Unknown Dates</td><td class="num">{{.Stats.UnknownBranches}}</td></tr>
+{{- end}}
+{{- end}}
+</table>
+
+<h2>Repositories</h2>
+<table>
+<tr><th>Repository</th><th>Owner</th><th>Creator</th><th>Created</th><th>Last Access</th><th>Age (months)</th></tr>
+{{- range .Repos}}
+<tr{{if .Old}} class="old-repo"{{end}}><td>{{.Name}}</td><td>{{.Owner}}</td><td>{{.Creator}}</td><td>{{.Created}}</td><td>{{.LastAccess}}</td><td class="num">{{if .CreatedUnknown}}-{{else}}{{.AgeMonths}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- if not .RepoOnly}}
+
+<h2>Branches</h2>
+{{- range .Repos}}
+<h3>{{.Name}}</h3>
+{{- if .Error}}
+<p class="error">Error fetching branches: {{.Error}}</p>
+{{- else if not .Branches}}
+<p>No branches.</p>
+{{- else}}
+<table class="branches">
+<tr><th>Branch</th><th>Last Pushed</th><th>Last Pushed By</th><th>Age (months)</th></tr>
+{{- range .Branches}}
+<tr{{if .Old}} class="old-branch"{{end}}><td>{{.Name}}</td><td>{{.LastPushed}}</td><td>{{.LastPushedBy}}</td><td class="num">{{if .Unknown}}-{{else}}{{.AgeMonths}}{{end}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// buildHTMLReport collects the report rows, fetching branches unless repoOnly.
+// Rows are flagged old by the same policy as the terminal colors.
+func buildHTMLReport(ctx context.Context, target string, results []RepositoryResult, client *BitbucketClient, policy *stalePolicy, stats *SummaryStats, repoOnly bool) *htmlReport {
+	report := &htmlReport{
+		Target:    target,
+		Generated: asOf.Format("2006-01-02"),
+		Stats:     stats,
+		RepoOnly:  repoOnly,
+	}
+	for _, result := range results {
+		repo := result.Repository
+		row := htmlRepo{
+			Name:       repo.DisplayName(),
+			Owner:      repo.Owner.DisplayName,
+			Creator:    result.creatorLabel(),
+			Created:    formatDate(repo.CreatedOn),
+			LastAccess: formatDate(repo.UpdatedOn),
+			AgeMonths:  calculateMonthsDifference(repo.CreatedOn, asOf),
+			Old:        policy.isOldRepo(repo),
+
+			CreatedUnknown: repo.CreatedOn.IsZero(),
+		}
+		if !repoOnly {
+			branches, err := result.branches(ctx, client)
+			if err != nil {
+				row.Error = err.Error()
+			}
+			for _, branch := range branches {
+				row.Branches = append(row.Branches, htmlBranch{
+					Name:         branch.Name,
+					LastPushed:   formatDate(branch.Target.Date),
+					LastPushedBy: branch.AuthorName(),
+					AgeMonths:    calculateMonthsDifference(branch.Target.Date, asOf),
+					Old:          policy.isStale(ctx, repo, branch),
+					Unknown:      branch.Target.Date.IsZero(),
+				})
+			}
+		}
+		report.Repos = append(report.Repos, row)
+	}
+	return report
+}
+
+// writeHTMLReport renders the report to a file, replacing any existing one
+func writeHTMLReport(path string, report *htmlReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := htmlTemplate.Execute(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// saveHTMLReport writes the HTML report, exiting on failure
+func saveHTMLReport(path string, report *htmlReport) {
+	if err := writeHTMLReport(path, report); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing HTML report: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	fmt.Printf("HTML report written to %s\n", path)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+// pipelineConfigFile is the Bitbucket Pipelines configuration file name
+const pipelineConfigFile = "bitbucket-pipelines.yml"
+
+// hygieneResult records which governance files a repository has at the root
+// of its default branch
+type hygieneResult struct {
+	Repository  Repository
+	HasReadme   bool
+	HasPipeline bool
+	Error       error
+}
+
+// compliant reports whether the repository has both a README and a pipeline config
+func (r hygieneResult) compliant() bool {
+	return r.Error == nil && r.HasReadme && r.HasPipeline
+}
+
+// missing describes what the repository lacks, for display
+func (r hygieneResult) missing() string {
+	if r.Error != nil {
+		return "unable to check: " + r.Error.Error()
+	}
+	var parts []string
+	if !r.HasReadme {
+		parts = append(parts, "README")
+	}
+	if !r.HasPipeline {
+		parts = append(parts, pipelineConfigFile)
+	}
+	return "missing " + strings.Join(parts, ", ")
+}
+
+// getRootFiles lists the names of the files at the root of a branch
+func (c *BitbucketClient) getRootFiles(ctx context.Context, repoFullName, branchName string) ([]string, error) {
+	var files []string
+	url := fmt.Sprintf("%s/repositories/%s/src/%s/?pagelen=100", c.baseURL, repoFullName, neturl.PathEscape(branchName))
+
+	for url != "" {
+		data, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		var response struct {
+			Values []struct {
+				Path string `json:"path"`
+				Type string `json:"type"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+
+		err = json.Unmarshal(data, &response)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range response.Values {
+			if entry.Type == "commit_file" {
+				files = append(files, entry.Path)
+			}
+		}
+		url = response.Next
+	}
+
+	return files, nil
+}
+
+// checkRepositoryHygiene looks for a README* and a pipeline config at the root
+// of the repository's default branch
+func checkRepositoryHygiene(ctx context.Context, repo Repository, client *BitbucketClient) hygieneResult {
+	result := hygieneResult{Repository: repo}
+	if repo.MainBranch.Name == "" {
+		result.Error = fmt.Errorf("repository has no default branch")
+		return result
+	}
+
+	files, err := client.getRootFiles(ctx, repo.FullName, repo.MainBranch.Name)
+	if err != nil {
+		result.Error = err
+		return result
+	}
+	for _, file := range files {
+		if strings.HasPrefix(strings.ToLower(file), "readme") {
+			result.HasReadme = true
+		}
+		if file == pipelineConfigFile {
+			result.HasPipeline = true
+		}
+	}
+	return result
+}
+
+// checkHygiene checks every repository concurrently, keeping the input order
+func checkHygiene(ctx context.Context, repos []Repository, client *BitbucketClient, maxConcurrency int) []hygieneResult {
+	results := make([]hygieneResult, len(repos))
+	forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+		results[i] = checkRepositoryHygiene(ctx, r, client)
+	})
+
+	return results
+}
+
+// outputHygiene reports the repositories that are missing a README or a
+// pipeline config. CSV output lists every repository so it can be filtered.
+func outputHygiene(w io.Writer, results []hygieneResult, asCSV bool, bold, green, red func(a ...interface{}) string) error {
+	if asCSV {
+		if err := writeCSVHeader(w, "Repository Name", "Main Branch", "Has README", "Has Pipeline", "Compliant", "Error"); err != nil {
+			return err
+		}
+		for _, result := range results {
+			errText := ""
+			if result.Error != nil {
+				errText = result.Error.Error()
+			}
+			err := writeCSVRow(w,
+				result.Repository.Name,
+				result.Repository.MainBranch.Name,
+				strconv.FormatBool(result.HasReadme),
+				strconv.FormatBool(result.HasPipeline),
+				strconv.FormatBool(result.compliant()),
+				errText)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var nonCompliant []hygieneResult
+	for _, result := range results {
+		if !result.compliant() {
+			nonCompliant = append(nonCompliant, result)
+		}
+	}
+
+	if len(nonCompliant) == 0 {
+		fmt.Printf("\n%s\n", green(fmt.Sprintf("All %d repositories have a README and %s", len(results), pipelineConfigFile)))
+		return nil
+	}
+	fmt.Printf("\n%s\n", bold(fmt.Sprintf("Non-compliant repositories (%d of %d):", len(nonCompliant), len(results))))
+	for _, result := range nonCompliant {
+		fmt.Printf("  %s  %s\n", result.Repository.DisplayName(), red(result.missing()))
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// errNotInteractive is returned when --interactive can't prompt because
+// stdin isn't a terminal
+var errNotInteractive = errors.New("--interactive needs a terminal on stdin to prompt; use --output or --output --preview in scripts")
+
+// stdinIsTerminal reports whether stdin is an interactive terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// selectBranchesInteractively asks about each candidate on prompt, reading
+// answers from in, and writes the branches chosen for deletion to out in the
+// --output format. Answering "skip all" keeps every remaining branch. It
+// returns how many branches were selected.
+func selectBranchesInteractively(candidates []branchCandidate, template string, in io.Reader, prompt, out io.Writer) int {
+	reader := bufio.NewReader(in)
+	selected := 0
+	for i, candidate := range candidates {
+		fmt.Fprintf(prompt, "\n[%d/%d] %s  %s\n", i+1, len(candidates), candidate.repo.FullName, candidate.branch.Name)
+		fmt.Fprintf(prompt, "  Last pushed %s by %s (%s): %s\n", formatDate(candidate.branch.Target.Date),
+			candidate.branch.AuthorName(), branchAgeLabel(candidate.branch), candidate.reason)
+
+		for {
+			fmt.Fprintf(prompt, "  [k]eep, [d]elete or [s]kip all remaining? ")
+			answer, err := reader.ReadString('\n')
+			if err != nil && answer == "" {
+				// End of input: keep what's left rather than guess
+				fmt.Fprintln(prompt)
+				return selected
+			}
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "k", "keep":
+			case "d", "delete":
+				fmt.Fprintln(out, formatOutputLine(template, candidate.repo, candidate.branch))
+				selected++
+			case "s", "skip", "skip all":
+				return selected
+			default:
+				continue
+			}
+			break
+		}
+	}
+	return selected
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// RepositoryJSON is one repository in --json output. Ages are computed in
+// whole months so consumers don't have to recompute them. Dates and ages are
+// null when unknown, as Data Center creation dates always are.
+type RepositoryJSON struct {
+	Name             string       `json:"name"`
+	FullName         string       `json:"full_name"`
+	Workspace        string       `json:"workspace"`
+	DisplayName      string       `json:"display_name,omitempty"` // name_map alias, if any
+	Owner            string       `json:"owner"`
+	Creator          string       `json:"creator"`
+	CreatorSource    string       `json:"creator_source,omitempty"` // first-commit or owner-fallback
+	ProjectKey       string       `json:"project_key,omitempty"`
+	ProjectName      string       `json:"project_name,omitempty"`
+	CreatedOn        *time.Time   `json:"created_on"`
+	UpdatedOn        *time.Time   `json:"updated_on"`
+	MainBranch       string       `json:"main_branch"`
+	RepoAgeMonths    *int         `json:"repo_age_months"`
+	LastAccessMonths *int         `json:"last_access_months"`
+	Archived         bool         `json:"archived"`
+	SizeBytes        *int64       `json:"size_bytes,omitempty"` // absent when the API doesn't report it
+	Language         string       `json:"language,omitempty"`
+	TotalCommits     *int         `json:"total_commits,omitempty"`        // --commit-stats
+	CommitsCapped    bool         `json:"total_commits_capped,omitempty"` // total_commits is a lower bound
+	LastCommitAuthor string       `json:"last_commit_author,omitempty"`   // --commit-stats
+	RiskScore        *int         `json:"risk_score,omitempty"`           // 0-100, absent with --repo-only
+	Branches         []BranchJSON `json:"branches,omitempty"`
+	Truncated        bool         `json:"branches_truncated,omitempty"` // --max-branches cut the branch list short
+	Error            string       `json:"error,omitempty"`
+}
+
+// BranchJSON is one branch in --json output. LastPushed and AgeMonths are
+// null when the branch date is unknown.
+type BranchJSON struct {
+	Name         string     `json:"name"`
+	LastPushed   *time.Time `json:"last_pushed"`
+	LastPushedBy string     `json:"last_pushed_by"`
+	AgeMonths    *int       `json:"age_months"`
+	Stale        bool       `json:"stale"`
+	Ahead        *int       `json:"commits_ahead,omitempty"`  // --ahead-behind
+	Behind       *int       `json:"commits_behind,omitempty"` // --ahead-behind
+}
+
+// buildRepositoryJSON converts a result, fetching its branches unless repoOnly
+// and its commit stats if withCommitStats, and counts the branches' commits
+// ahead of and behind the main branch if withAheadBehind. Creator lookup and
+// branch fetch errors are reported in the error field.
+func buildRepositoryJSON(ctx context.Context, result RepositoryResult, client *BitbucketClient, policy *stalePolicy, repoOnly, withCommitStats, withAheadBehind bool) RepositoryJSON {
+	repo := result.Repository
+	out := RepositoryJSON{
+		Name:          repo.Name,
+		FullName:      repo.FullName,
+		Workspace:     repo.Workspace,
+		DisplayName:   repo.Alias,
+		Owner:         repo.Owner.DisplayName,
+		Creator:       result.Creator,
+		CreatorSource: result.CreatorSource,
+		ProjectKey:    repo.Project.Key,
+		ProjectName:   repo.Project.Name,
+		MainBranch:    repo.MainBranch.Name,
+		Archived:      repo.Archived,
+		Language:      repo.Language,
+	}
+	out.CreatedOn, out.RepoAgeMonths = jsonDate(repo.CreatedOn)
+	out.UpdatedOn, out.LastAccessMonths = jsonDate(repo.UpdatedOn)
+	if repo.Size >= 0 {
+		out.SizeBytes = &repo.Size
+	}
+	if result.Error != nil {
+		out.Error = result.Error.Error()
+	}
+	if withCommitStats {
+		if stats := lookupCommitStats(ctx, repo, client); stats.err == nil {
+			out.TotalCommits = &stats.total
+			out.CommitsCapped = stats.capped
+			out.LastCommitAuthor = stats.lastAuthor
+		}
+	}
+	if repoOnly {
+		return out
+	}
+
+	branches, err := result.branches(ctx, client)
+	if err != nil {
+		out.Error = err.Error()
+		return out
+	}
+	if score, err := policy.riskScore(ctx, repo); err == nil {
+		out.RiskScore = &score
+	}
+	out.Truncated = client.branchesTruncated(repo.FullName)
+	if withAheadBehind {
+		branches = client.markAheadBehind(ctx, repo, branches)
+	}
+	out.Branches = make([]BranchJSON, len(branches))
+	for i, branch := range branches {
+		b := BranchJSON{
+			Name:         branch.Name,
+			LastPushedBy: branch.AuthorName(),
+			Stale:        policy.isStale(ctx, repo, branch),
+			Ahead:        branch.Ahead,
+			Behind:       branch.Behind,
+		}
+		b.LastPushed, b.AgeMonths = jsonDate(branch.Target.Date)
+		out.Branches[i] = b
+	}
+	return out
+}
+
+// jsonDate returns a date and its age in months, or nils when the date is unknown
+func jsonDate(date time.Time) (*time.Time, *int) {
+	if date.IsZero() {
+		return nil, nil
+	}
+	age := calculateMonthsDifference(date, asOf)
+	return &date, &age
+}
+
+// outputResultJSONLine writes one result to w as a single line of JSON, for
+// --jsonl. Lines are written as results arrive, so w should be unbuffered
+// for consumers to see each one straight away.
+func outputResultJSONLine(ctx context.Context, w io.Writer, result RepositoryResult, client *BitbucketClient, policy *stalePolicy, repoOnly, withCommitStats, withAheadBehind bool) error {
+	line, err := json.Marshal(buildRepositoryJSON(ctx, result, client, policy, repoOnly, withCommitStats, withAheadBehind))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// streamResultsJSONLines processes repos on up to maxConcurrency workers and
+// writes each repository's JSON line to w as soon as it is done, in completion
+// order. A line is built on the worker that processed its repository, risk
+// score, stale checks and all, so only the writes are serialized. After the
+// first write error no more repositories are started, and it is returned.
+func streamResultsJSONLines(ctx context.Context, w io.Writer, repos []Repository, client *BitbucketClient, policy *stalePolicy, maxConcurrency int, resolveCreators, repoOnly, withCommitStats, withAheadBehind bool) error {
+	var mu sync.Mutex
+	var writeErr error
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return writeErr != nil
+	}
+	forEachRepo(ctx, repos, maxConcurrency, func(_ int, r Repository) {
+		if failed() {
+			return
+		}
+		result := processRepositoryConcurrently(ctx, r, client, resolveCreators, !repoOnly)
+		line, err := json.Marshal(buildRepositoryJSON(ctx, result, client, policy, repoOnly, withCommitStats, withAheadBehind))
+		mu.Lock()
+		defer mu.Unlock()
+		if writeErr != nil {
+			return
+		}
+		if err == nil {
+			_, err = w.Write(append(line, '\n'))
+		}
+		writeErr = err
+	})
+	return writeErr
+}
+
+// outputResultsJSON writes the results to w as a JSON array
+func outputResultsJSON(ctx context.Context, w io.Writer, results []RepositoryResult, client *BitbucketClient, policy *stalePolicy, repoOnly, withCommitStats, withAheadBehind bool) error {
+	repos := make([]RepositoryJSON, len(results))
+	for i, result := range results {
+		repos[i] = buildRepositoryJSON(ctx, result, client, policy, repoOnly, withCommitStats, withAheadBehind)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(repos)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// defaultKeyringService is the service name credentials are stored under in
+// the OS keychain (macOS Keychain, Windows Credential Manager or a libsecret
+// store such as GNOME Keyring)
+const defaultKeyringService = "bhunter"
+
+// keyringUsernameAccount holds the username saved with --save-credentials, so
+// a run needs no credentials anywhere else; the app password itself is stored
+// under the username.
+const keyringUsernameAccount = "username"
+
+// keyringTokenAccount is the keychain account of a provider's access token
+func keyringTokenAccount(provider string) string {
+	if provider == providerBitbucket {
+		return "access_token"
+	}
+	return provider + "_access_token"
+}
+
+// saveKeyringCredentials stores the configured access token, or username and
+// app password, in the OS keychain
+func saveKeyringCredentials(service, provider string, config *Config) error {
+	if config.AccessToken != "" {
+		if err := keyring.Set(service, keyringTokenAccount(provider), config.AccessToken); err != nil {
+			return fmt.Errorf("saving access token to the keychain: %w", err)
+		}
+		return nil
+	}
+	if config.Username == "" || config.AppPassword == "" {
+		return fmt.Errorf("--save-credentials needs an access token, or a username and app password")
+	}
+	if err := keyring.Set(service, keyringUsernameAccount, config.Username); err != nil {
+		return fmt.Errorf("saving username to the keychain: %w", err)
+	}
+	if err := keyring.Set(service, config.Username, config.AppPassword); err != nil {
+		return fmt.Errorf("saving app password to the keychain: %w", err)
+	}
+	return nil
+}
+
+// loadKeyringCredentials fills in missing credentials from the OS keychain and
+// reports whether it found any. A configured username looks up its own app
+// password first, then the provider's access token is tried, then the saved
+// username. A keychain that isn't available counts as holding nothing.
+func loadKeyringCredentials(service, provider string, config *Config) bool {
+	if config.Username != "" {
+		if password, err := keyring.Get(service, config.Username); err == nil && password != "" {
+			config.AppPassword = password
+			return true
+		}
+	}
+	if token, err := keyring.Get(service, keyringTokenAccount(provider)); err == nil && token != "" {
+		config.AccessToken = token
+		return true
+	}
+	if config.Username != "" {
+		return false
+	}
+	username, err := keyring.Get(service, keyringUsernameAccount)
+	if err != nil || username == "" {
+		return false
+	}
+	password, err := keyring.Get(service, username)
+	if err != nil || password == "" {
+		return false
+	}
+	config.Username = username
+	config.AppPassword = password
+	return true
+}
@@ -1,16 +1,31 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
+	"math/rand"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
 	"gopkg.in/yaml.v3"
@@ -23,10 +38,108 @@ var (
 	date    = "unknown"
 )
 
+// VersionInfo describes the running build, for --version --json
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	Date      string `json:"date"`
+	GoVersion string `json:"go_version"`
+	Platform  string `json:"platform"`
+}
+
+func getVersionInfo() VersionInfo {
+	return VersionInfo{
+		Version:   version,
+		Commit:    commit,
+		Date:      date,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+}
+
 type Config struct {
 	Username    string `yaml:"username"`
 	AppPassword string `yaml:"app_password"`
 	Workspace   string `yaml:"workspace,omitempty"`
+	// Workspaces lists further workspaces scanned in the same run
+	Workspaces  []string `yaml:"workspaces,omitempty"`
+	AccessToken string   `yaml:"access_token,omitempty"` // OAuth 2.0 access token, preferred over the app password
+	BaseURL     string   `yaml:"base_url,omitempty"`     // API base URL, e.g. a Bitbucket Data Center instance
+	Provider    string   `yaml:"provider,omitempty"`     // bitbucket (default), github or gitlab
+	Proxy       string   `yaml:"proxy,omitempty"`        // outbound proxy URL, overriding HTTP_PROXY and HTTPS_PROXY
+	RetryOn     string   `yaml:"retry_on,omitempty"`
+
+	// BranchAgeMonths and RepoAgeMonths set the staleness thresholds. Zero
+	// keeps the defaults of 6 and 12 months.
+	BranchAgeMonths int `yaml:"branch_age_months,omitempty"`
+	RepoAgeMonths   int `yaml:"repo_age_months,omitempty"`
+
+	// MaxRetries and RetryBaseDelay tune retries of transient failures. A nil
+	// MaxRetries keeps the default; 0 disables retries.
+	MaxRetries     *int   `yaml:"max_retries,omitempty"`
+	RetryBaseDelay string `yaml:"retry_base_delay,omitempty"` // Go duration, e.g. 500ms
+
+	// Timeout bounds each whole request; DialTimeout, TLSHandshakeTimeout and
+	// ResponseHeaderTimeout bound its phases. All are Go durations, empty
+	// keeps the defaults, and the matching flags take precedence.
+	Timeout               string `yaml:"timeout,omitempty"`
+	DialTimeout           string `yaml:"dial_timeout,omitempty"`
+	TLSHandshakeTimeout   string `yaml:"tls_handshake_timeout,omitempty"`
+	ResponseHeaderTimeout string `yaml:"response_header_timeout,omitempty"`
+
+	// NameMap maps repository full names (workspace/repo) to friendly display
+	// aliases used in human-readable output
+	NameMap map[string]string `yaml:"name_map,omitempty"`
+
+	// CorporateDomains are the email domains treated as corporate by
+	// --commit-email-domains
+	CorporateDomains []string `yaml:"corporate_domains,omitempty"`
+
+	// ProtectedBranches are glob patterns for branches that are never
+	// deletion candidates, in addition to main, master and develop
+	ProtectedBranches []string `yaml:"protected_branches,omitempty"`
+
+	// AuthorAliases maps alternative spellings of a person's name to the name
+	// their per-author statistics are reported under
+	AuthorAliases map[string]string `yaml:"author_aliases,omitempty"`
+
+	// AppPasswordDeprecationDate overrides the date (YYYY-MM-DD) after which
+	// app passwords are treated as deprecated by --fail-on-deprecated
+	AppPasswordDeprecationDate string `yaml:"app_password_deprecation_date,omitempty"`
+
+	// KeyringService is the OS keychain service credentials are looked up
+	// under when none are configured (default bhunter)
+	KeyringService string `yaml:"keyring_service,omitempty"`
+}
+
+// defaultAppPasswordDeprecationDate is when Atlassian stops accepting app
+// passwords for the Bitbucket Cloud API
+const defaultAppPasswordDeprecationDate = "2026-06-09"
+
+// checkAppPasswordDeprecation prints a one-time warning to stderr about app
+// password deprecation unless silenced, and reports whether the deprecation
+// date has passed
+func checkAppPasswordDeprecation(config *Config, silence bool) (bool, error) {
+	deprecationDate := config.AppPasswordDeprecationDate
+	if deprecationDate == "" {
+		deprecationDate = defaultAppPasswordDeprecationDate
+	}
+	deadline, err := time.Parse("2006-01-02", deprecationDate)
+	if err != nil {
+		return false, fmt.Errorf("invalid app_password_deprecation_date %q (expected YYYY-MM-DD)", deprecationDate)
+	}
+
+	passed := !time.Now().Before(deadline)
+	if !silence {
+		yellow := color.New(color.FgYellow, color.Bold).SprintFunc()
+		if passed {
+			fmt.Fprintf(os.Stderr, "%s Bitbucket app passwords were deprecated on %s and may stop working at any time.\n", yellow("WARNING:"), deprecationDate)
+		} else {
+			fmt.Fprintf(os.Stderr, "%s Bitbucket app passwords are deprecated and stop working on %s.\n", yellow("WARNING:"), deprecationDate)
+		}
+		fmt.Fprintf(os.Stderr, "         Please migrate to an Atlassian API token. Silence with --no-deprecation-warning.\n")
+	}
+	return passed, nil
 }
 
 type Repository struct {
@@ -38,6 +151,12 @@ type Repository struct {
 		DisplayName string `json:"display_name"`
 		Username    string `json:"username"`
 	} `json:"owner"`
+	Description string `json:"description"`
+	Links       struct {
+		HTML struct {
+			Href string `json:"href"`
+		} `json:"html"`
+	} `json:"links"`
 	MainBranch struct {
 		Name string `json:"name"`
 	} `json:"mainbranch"`
@@ -45,24 +164,116 @@ type Repository struct {
 		Key  string `json:"key"`
 		Name string `json:"name"`
 	} `json:"project"`
+	Size     int64  `json:"size"` // bytes; -1 when the API doesn't report it
+	Language string `json:"language"`
+
+	// Archived is set for read-only archived repositories
+	Archived bool `json:"archived"`
+
+	// Workspace is the workspace the repository was listed from
+	Workspace string `json:"-"`
+
+	// RenamedFrom holds the originally requested name when the API redirected
+	// to a renamed or moved repository
+	RenamedFrom string `json:"-"`
+
+	// Alias is a friendly display name from the config name_map, if any
+	Alias string `json:"-"`
+
+	// BranchStats is filled in when branches were classified ahead of display
+	// (e.g. by --min-stale-ratio)
+	BranchStats *RepoBranchStats `json:"-"`
+}
+
+// DisplayName returns the repository's alias if it has one, or its real name
+func (r Repository) DisplayName() string {
+	if r.Alias != "" {
+		return r.Alias
+	}
+	return r.Name
+}
+
+// applyNameMap sets the display alias of every repository found in nameMap.
+// Keys are matched against the full name case-insensitively.
+func applyNameMap(repos []Repository, nameMap map[string]string) {
+	if len(nameMap) == 0 {
+		return
+	}
+	aliases := make(map[string]string, len(nameMap))
+	for fullName, alias := range nameMap {
+		aliases[strings.ToLower(fullName)] = alias
+	}
+	for i := range repos {
+		repos[i].Alias = aliases[strings.ToLower(repos[i].FullName)]
+	}
+}
+
+// nameRepository sets the display alias of a single repository, as
+// applyNameMap does for a listing
+func nameRepository(repo *Repository, nameMap map[string]string) {
+	named := []Repository{*repo}
+	applyNameMap(named, nameMap)
+	*repo = named[0]
+}
+
+// RepoBranchStats counts a repository's branches by staleness
+type RepoBranchStats struct {
+	Total int
+	Stale int
+}
+
+// StaleRatio returns the fraction of branches that are stale
+func (s *RepoBranchStats) StaleRatio() float64 {
+	if s.Total == 0 {
+		return 0
+	}
+	return float64(s.Stale) / float64(s.Total)
 }
 
 type Branch struct {
 	Name   string `json:"name"`
 	Target struct {
+		Hash   string    `json:"hash"`
 		Date   time.Time `json:"date"`
 		Author struct {
+			Raw  string `json:"raw"` // "Name <email>" as recorded in the commit
 			User struct {
 				DisplayName string `json:"display_name"`
 			} `json:"user"`
 		} `json:"author"`
 	} `json:"target"`
+
+	// Merged reports whether the branch is merged into the main branch. It is
+	// nil until filled in by markMerged, or when the status is unknown.
+	Merged *bool `json:"-"`
+
+	// Ahead and Behind count the commits the branch has that the main branch
+	// doesn't, and the other way round. They are nil until filled in by
+	// markAheadBehind, or when the counts are unknown.
+	Ahead  *int `json:"-"`
+	Behind *int `json:"-"`
+
+	// Creator is the author of the branch's first commit of its own, which
+	// is not necessarily the author of its tip. It is empty until filled in
+	// by markCreators, or when the branch has no commits of its own.
+	Creator string `json:"-"`
+}
+
+// AuthorName names the author of the branch's tip commit: the linked
+// Bitbucket user if any, otherwise the name in the raw author, which is all
+// the API returns for emails not linked to an account
+func (b Branch) AuthorName() string {
+	if b.Target.Author.User.DisplayName != "" {
+		return b.Target.Author.User.DisplayName
+	}
+	return rawAuthorName(b.Target.Author.Raw)
 }
 
 type Commit struct {
 	Hash   string    `json:"hash"`
 	Date   time.Time `json:"date"`
 	Author struct {
+		Raw  string `json:"raw"` // "Name <email>" as recorded in the commit
 		User struct {
 			DisplayName string `json:"display_name"`
 		} `json:"user"`
@@ -71,598 +282,3059 @@ type Commit struct {
 }
 
 type BitbucketClient struct {
-	username    string
-	appPassword string
-	workspace   string
-	baseURL     string
-	httpClient  *http.Client
+	username       string
+	appPassword    string
+	accessToken    string // OAuth 2.0 bearer token; replaces basic auth when set
+	workspace      string
+	workspaces     []string // every workspace getRepositories lists; nil means just workspace
+	baseURL        string
+	provider       string    // hosting service, one of validProviders
+	flavor         apiFlavor // Bitbucket Cloud, Server / Data Center, GitHub or GitLab
+	httpClient     *http.Client
+	retryOn        retryPolicy
+	maxRetries     int
+	retryBaseDelay time.Duration // first backoff delay, doubled on each retry
+	jitter         bool          // randomize backoff so concurrent workers don't retry in lockstep
+	timeouts       httpTimeouts  // dial, TLS handshake, response header and whole-request limits
+	proxy          proxyFunc     // chooses the outbound proxy, if any, for each request
+	retryLog       *retryLogger
+	failures       *failureLog // per-repository failures reported at the end of the run
+	anonymizer     *anonymizer // replaces people's names in API results when set
+	role           string      // restricts repository listing to this role, if set
+	cursor         *listingCursor
+	cache          *responseCache // on-disk responses reused by makeRequest (--cache-ttl)
+	requestStats   *requestStats  // HTTP requests made per repository and in total
+	showStats      bool           // print the run totals on exit (--stats)
+	pageLen        int            // results per page of repository and branch listings
+	maxRepos       int            // stop listing repositories after this many (0 = no limit)
+	reposCapped    bool           // the last repository listing stopped at maxRepos
+	maxBranches    int            // stop listing a repository's branches after this many (0 = no limit)
+	creatorPages   int            // commit pages searched for a repository's first commit (0 = no limit)
+
+	// requestSlots bounds the number of HTTP requests in flight across all
+	// goroutines, however many sub-lookups each repository triggers
+	requestSlots chan struct{}
+	limiter      *rateLimiter // shared pacing and server rate limit pauses
+
+	commitCountMu sync.Mutex
+	commitCounts  map[string]commitCountEntry
+
+	mergeBaseMu sync.Mutex
+	mergeBases  map[string]*Commit
+
+	compareMu sync.Mutex
+	compares  map[string]int // commits in exclude..include, by countCommitsBetween
+
+	branchStartMu sync.Mutex
+	branchStarts  map[string]*Commit // nil for branches without commits of their own
+
+	pullRequestMu     sync.Mutex
+	pullRequestCounts map[string]int
+
+	latestCommitMu sync.Mutex
+	latestCommits  map[string]*Commit
+
+	tagsMu sync.Mutex
+	tags   map[string][]Tag
+
+	firstCommitMu sync.Mutex
+	firstCommits  map[string]firstCommitEntry
+
+	branchesMu sync.Mutex
+	branches   map[string][]Branch
+	truncated  map[string]bool // repositories whose branch listing stopped at maxBranches
+}
+
+// firstCommitEntry caches the result of a first-commit (creator) lookup,
+// including failures, so each repository is only looked up once per run
+type firstCommitEntry struct {
+	commit *Commit
+	err    error
+}
+
+// commitCountEntry caches a commit count for a repository. When complete is
+// false the count stopped early at a cap and is only a lower bound.
+type commitCountEntry struct {
+	count    int
+	complete bool
 }
 
 func NewBitbucketClient(username, appPassword, workspace string) *BitbucketClient {
 	if workspace == "" {
 		workspace = username
 	}
-	return &BitbucketClient{
-		username:    username,
-		appPassword: appPassword,
-		workspace:   workspace,
-		baseURL:     "https://api.bitbucket.org/2.0",
-		httpClient:  &http.Client{Timeout: 30 * time.Second},
+	c := newBitbucketClient(workspace)
+	c.username = username
+	c.appPassword = appPassword
+	return c
+}
+
+// NewBitbucketClientWithToken creates a client that authenticates with an
+// OAuth 2.0 access token instead of a username and app password
+func NewBitbucketClientWithToken(token, workspace string) *BitbucketClient {
+	c := newBitbucketClient(workspace)
+	c.accessToken = token
+	return c
+}
+
+// newBitbucketClient creates a client with no credentials set
+func newBitbucketClient(workspace string) *BitbucketClient {
+	c := &BitbucketClient{
+		workspace: workspace,
+		baseURL:   defaultBaseURL,
+		provider:  providerBitbucket,
+		flavor:    cloudFlavor{},
+		httpClient: &http.Client{
+			// No overall Timeout: doRequest sets a per-request deadline instead,
+			// so slow but progressing body reads aren't cut off
+			Transport: newTransport(defaultWorkers, defaultHTTPTimeouts, http.ProxyFromEnvironment),
+		},
+		retryOn:           defaultRetryPolicy,
+		jitter:            true,
+		timeouts:          defaultHTTPTimeouts,
+		pageLen:           pageSize,
+		creatorPages:      defaultCreatorPages,
+		proxy:             http.ProxyFromEnvironment,
+		requestSlots:      make(chan struct{}, defaultWorkers),
+		limiter:           newRateLimiter(0),
+		maxRetries:        defaultMaxRetries,
+		retryBaseDelay:    defaultRetryBaseDelay,
+		commitCounts:      make(map[string]commitCountEntry),
+		firstCommits:      make(map[string]firstCommitEntry),
+		mergeBases:        make(map[string]*Commit),
+		compares:          make(map[string]int),
+		branchStarts:      make(map[string]*Commit),
+		pullRequestCounts: make(map[string]int),
+		latestCommits:     make(map[string]*Commit),
+		tags:              make(map[string][]Tag),
+		branches:          make(map[string][]Branch),
+		truncated:         make(map[string]bool),
+		requestStats:      newRequestStats(defaultBaseURL),
+		failures:          newFailureLog(),
+	}
+	// Follow redirects for renamed repositories, but only keep credentials
+	// when staying on the same host
+	c.httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		if req.URL.Host == via[0].URL.Host {
+			c.setAuth(req)
+		}
+		return nil
 	}
+	return c
 }
 
-func (c *BitbucketClient) makeRequest(url string) ([]byte, error) {
-	req, err := http.NewRequest("GET", url, nil)
+// setProvider points the client at a hosting service, and optionally at
+// another instance of it such as a self-hosted Bitbucket Server / Data Center
+// or GitHub Enterprise, choosing the matching API flavor
+func (c *BitbucketClient) setProvider(provider, baseURL string) error {
+	flavor, normalized, err := flavorForProvider(provider, baseURL)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	c.provider = provider
+	c.flavor = flavor
+	c.baseURL = normalized
+	c.requestStats = newRequestStats(normalized)
+	return nil
+}
 
+// setAuth adds the client's credentials to a request, preferring the access
+// token over basic auth
+func (c *BitbucketClient) setAuth(req *http.Request) {
+	if c.accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.accessToken)
+		return
+	}
 	req.SetBasicAuth(c.username, c.appPassword)
-	req.Header.Set("Accept", "application/json")
+}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, err
+// defaultWorkers is the default number of repositories processed concurrently
+const defaultWorkers = 10
+
+// httpTimeouts bound the phases of each API request
+type httpTimeouts struct {
+	dial           time.Duration // establishing the TCP connection
+	tlsHandshake   time.Duration // the TLS handshake
+	responseHeader time.Duration // waiting for the response headers once the request is sent
+	request        time.Duration // the whole request, including reading the body
+}
+
+// defaultHTTPTimeouts make dead connections fail fast, while the whole-request
+// timeout is generous because large pages can take a while to download on
+// slow links
+var defaultHTTPTimeouts = httpTimeouts{
+	dial:           10 * time.Second,
+	tlsHandshake:   10 * time.Second,
+	responseHeader: 10 * time.Second,
+	request:        2 * time.Minute,
+}
+
+// parseHTTPTimeouts applies the timeouts set in the config file to the
+// defaults
+func parseHTTPTimeouts(config *Config) (httpTimeouts, error) {
+	timeouts := defaultHTTPTimeouts
+	for _, setting := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"timeout", config.Timeout, &timeouts.request},
+		{"dial_timeout", config.DialTimeout, &timeouts.dial},
+		{"tls_handshake_timeout", config.TLSHandshakeTimeout, &timeouts.tlsHandshake},
+		{"response_header_timeout", config.ResponseHeaderTimeout, &timeouts.responseHeader},
+	} {
+		if setting.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(setting.value)
+		if err != nil || duration <= 0 {
+			return timeouts, fmt.Errorf("invalid %s %q (expected a duration such as 10s or 2m)", setting.name, setting.value)
+		}
+		*setting.field = duration
 	}
-	defer resp.Body.Close()
+	return timeouts, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed with status: %d", resp.StatusCode)
+// newTransport returns an HTTP transport whose connection pool is sized for the
+// number of concurrent workers. The default transport keeps only two idle
+// connections per host, so most concurrent requests to api.bitbucket.org would
+// otherwise pay for a fresh TLS handshake. The whole-request timeout isn't a
+// transport setting; doRequest applies it. HTTPS requests reach the host
+// through a CONNECT tunnel when proxy selects a proxy, so credentials are
+// only ever sent inside TLS.
+func newTransport(workers int, timeouts httpTimeouts, proxy proxyFunc) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxy
+	transport.MaxIdleConns = workers * 2
+	transport.MaxIdleConnsPerHost = workers
+	transport.MaxConnsPerHost = workers * 2
+	transport.DialContext = (&net.Dialer{Timeout: timeouts.dial, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeouts.tlsHandshake
+	transport.ResponseHeaderTimeout = timeouts.responseHeader
+	return transport
+}
+
+// setWorkers resizes the client's connection pool for the given concurrency
+func (c *BitbucketClient) setWorkers(workers int) {
+	c.httpClient.Transport = newTransport(workers, c.timeouts, c.proxy)
+}
+
+// setProxy routes requests through proxy, or through the proxy named by the
+// environment when it is empty. Call it before setWorkers, which builds the
+// transport with the proxy.
+func (c *BitbucketClient) setProxy(proxy string) error {
+	selectProxy, err := newProxyFunc(proxy)
+	if err != nil {
+		return err
 	}
+	c.proxy = selectProxy
+	return nil
+}
 
-	return io.ReadAll(resp.Body)
+// setTimeouts sets the request timeouts. Call it before setWorkers, which
+// builds the transport with them.
+func (c *BitbucketClient) setTimeouts(timeouts httpTimeouts) {
+	c.timeouts = timeouts
 }
 
-func (c *BitbucketClient) getRepositories() ([]Repository, error) {
-	var allRepos []Repository
-	url := fmt.Sprintf("%s/repositories/%s?pagelen=100", c.baseURL, c.workspace)
+// setMaxInFlight sets the maximum number of concurrent HTTP requests
+func (c *BitbucketClient) setMaxInFlight(limit int) {
+	c.requestSlots = make(chan struct{}, limit)
+}
 
-	for url != "" {
-		data, err := c.makeRequest(url)
-		if err != nil {
+const (
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 1 * time.Second
+	defaultRetryOn        = "network,5xx,429"
+)
+
+// retryPolicy controls which failures makeRequest retries
+type retryPolicy struct {
+	network     bool // connection errors and timeouts
+	serverError bool // 500, 502, 503 and 504 responses
+	rateLimited bool // 429 responses
+}
+
+var defaultRetryPolicy = retryPolicy{network: true, serverError: true, rateLimited: true}
+
+// parseRetryOn parses a comma-separated list of retry conditions
+// (network, 5xx, 429), or "none" to disable retries entirely
+func parseRetryOn(value string) (retryPolicy, error) {
+	var policy retryPolicy
+	for _, condition := range strings.Split(value, ",") {
+		switch strings.ToLower(strings.TrimSpace(condition)) {
+		case "network":
+			policy.network = true
+		case "5xx":
+			policy.serverError = true
+		case "429":
+			policy.rateLimited = true
+		case "none", "":
+		default:
+			return retryPolicy{}, fmt.Errorf("invalid retry condition %q (valid: network, 5xx, 429, none)", condition)
+		}
+	}
+	return policy, nil
+}
+
+func (c *BitbucketClient) makeRequest(ctx context.Context, url string) ([]byte, error) {
+	if data, ok := c.cache.get(url); ok {
+		c.requestStats.cacheHits.Add(1)
+		return data, nil
+	} else if c.cache != nil {
+		c.requestStats.cacheMisses.Add(1)
+	}
+
+	for attempt := 0; ; attempt++ {
+		// Hold a request slot only while the request runs, not during backoff
+		// or while waiting for the rate limiter
+		if err := c.limiter.wait(ctx); err != nil {
 			return nil, err
 		}
+		select {
+		case c.requestSlots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		started := time.Now()
+		c.requestStats.calls.Add(1)
+		data, retryable, err := c.doRequest(ctx, url)
+		c.requestStats.record(url, time.Since(started))
+		<-c.requestSlots
 
-		var response struct {
-			Values []Repository `json:"values"`
-			Next   string       `json:"next"`
+		if err == nil {
+			if attempt > 0 {
+				c.retryLog.record(url, attempt+1, nil, 0, "succeeded")
+			}
+			c.cache.put(url, data)
+			return data, nil
+		}
+		if !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			if attempt > 0 {
+				c.retryLog.record(url, attempt+1, err, 0, "failed")
+				return nil, fmt.Errorf("%w (after %d attempts)", err, attempt+1)
+			}
+			return nil, err
 		}
 
-		err = json.Unmarshal(data, &response)
-		if err != nil {
+		// A rate-limited response says when to come back; otherwise back off
+		delay := c.backoff(attempt + 1)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			delay = apiErr.RetryAfter
+		}
+		c.retryLog.record(url, attempt+1, err, delay, "retrying")
+		c.requestStats.retries.Add(1)
+		if err := sleepContext(ctx, delay); err != nil {
 			return nil, err
 		}
+	}
+}
 
-		allRepos = append(allRepos, response.Values...)
-		url = response.Next
+// sleepContext pauses for d, returning early with the context's error if it
+// is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	return allRepos, nil
+// Exit codes, documented in the README for scripts and CI
+const (
+	exitConfigError  = 1 // invalid flags or config, failed authentication, or a local I/O error
+	exitAPIError     = 2 // the network or the Bitbucket API failed
+	exitNotFound     = 3 // the repository given with -r doesn't exist
+	exitPartialError = 4 // the run completed, but some repositories couldn't be read
+)
+
+// exitCodeForError maps a failed API call to an exit code: authentication
+// and permission failures are configuration errors, a 404 means not found,
+// and anything else is a network or API error
+func exitCodeForError(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitConfigError
+		case http.StatusNotFound:
+			return exitNotFound
+		}
+	}
+	return exitAPIError
 }
 
-func (c *BitbucketClient) getRepository(repoName string) (*Repository, error) {
-	url := fmt.Sprintf("%s/repositories/%s/%s", c.baseURL, c.workspace, repoName)
-	data, err := c.makeRequest(url)
-	if err != nil {
-		return nil, err
+// exitIfPartial reports the repositories whose creator lookup or branch
+// listing failed, and exits with exitPartialError if there were any, so a
+// report with gaps isn't mistaken for a complete one. Every completed run
+// ends here, so it also closes the --out-file and prints the --stats totals.
+func exitIfPartial(client *BitbucketClient) {
+	closeOutputFile()
+	if client.showStats {
+		client.requestStats.printTotals(os.Stderr, client.cache != nil)
 	}
+	if client.failures.report(os.Stderr) > 0 {
+		os.Exit(exitPartialError)
+	}
+}
 
-	var repo Repository
-	err = json.Unmarshal(data, &repo)
+// outputFile is the open --out-file, if any
+var outputFile *os.File
+
+// closeOutputFile closes the --out-file, exiting if that fails: the run ends
+// with os.Exit, which would skip a deferred Close and lose its error
+func closeOutputFile() {
+	if outputFile == nil {
+		return
+	}
+	err := outputFile.Close()
+	outputFile = nil
 	if err != nil {
-		return nil, err
+		fmt.Fprintf(os.Stderr, "Error writing output file: %v\n", err)
+		os.Exit(exitConfigError)
 	}
+}
 
-	return &repo, nil
+// exitIfInterrupted stops the program once Ctrl-C has cancelled ctx, so a
+// partial scan isn't reported as a list of request errors
+func exitIfInterrupted(ctx context.Context) {
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted\n")
+		os.Exit(130)
+	}
 }
 
-func (c *BitbucketClient) getBranches(repoFullName string) ([]Branch, error) {
-	var allBranches []Branch
-	url := fmt.Sprintf("%s/repositories/%s/refs/branches?pagelen=100", c.baseURL, repoFullName)
+// backoff returns the delay before a retry attempt. The base is exponential
+// (1s, 2s, 4s, ... by default); with jitter enabled a random delay between zero and that
+// base is used instead ("full jitter"), which spreads out retries from workers
+// that were all rate limited at the same moment.
+func (c *BitbucketClient) backoff(attempt int) time.Duration {
+	delay := c.retryBaseDelay << (attempt - 1)
+	if !c.jitter {
+		return delay
+	}
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
 
-	for url != "" {
-		data, err := c.makeRequest(url)
-		if err != nil {
-			return nil, err
-		}
+// configureColor decides whether output is colored. By default color is
+// disabled when NO_COLOR is set or stdout is not a terminal; forceColor
+// overrides that detection. noColor and machine-readable output always win.
+func configureColor(noColor, forceColor, machineOutput bool) {
+	color.NoColor = os.Getenv("NO_COLOR") != "" || color.NoColor
+	if forceColor {
+		color.NoColor = false
+	}
+	if noColor || machineOutput {
+		color.NoColor = true
+	}
+}
 
-		var response struct {
-			Values []Branch `json:"values"`
-			Next   string   `json:"next"`
-		}
+// parseBackoffJitter parses a --backoff-jitter value
+func parseBackoffJitter(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "full":
+		return true, nil
+	case "none":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid --backoff-jitter %q (valid: full, none)", value)
+}
 
-		err = json.Unmarshal(data, &response)
-		if err != nil {
-			return nil, err
-		}
+// APIError is returned when the Bitbucket API responds with a non-200 status
+type APIError struct {
+	StatusCode int
+	RetryAfter time.Duration // from the Retry-After header of a 429 response, if any
+}
 
-		allBranches = append(allBranches, response.Values...)
-		url = response.Next
+// retryableStatus reports whether a status is a transient server failure
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
 	}
-
-	return allBranches, nil
+	return false
 }
 
-func (c *BitbucketClient) getFirstCommit(repoFullName string) (*Commit, error) {
-	// Get repository info to know when it was created
-	parts := strings.Split(repoFullName, "/")
-	if len(parts) != 2 {
-		return nil, fmt.Errorf("invalid repository name format")
+// parseRetryAfter parses a Retry-After header, given either in seconds or as
+// an HTTP date. It returns 0 if the header is missing or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
 	}
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0)
+	}
+	return 0
+}
 
-	repo, err := c.getRepository(parts[1])
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed with status: %d", e.StatusCode)
+}
+
+// doRequest performs a single GET request and reports whether a failure
+// should be retried under the client's retry policy
+func (c *BitbucketClient) doRequest(ctx context.Context, url string) ([]byte, bool, error) {
+	// The deadline covers the whole request, including reading the body
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.request)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
-	// Look for commits around the creation date (subtract 1 day to catch earliest commits, then 30 days after)
-	startDate := repo.CreatedOn.AddDate(0, 0, -1) // 1 day before creation
-	endDate := repo.CreatedOn.AddDate(0, 0, 30)   // 30 days after creation
 
-	// Format dates for API (ISO 8601 format)
-	since := startDate.Format("2006-01-02T15:04:05Z")
-	until := endDate.Format("2006-01-02T15:04:05Z")
-
-	// Use date filtering in the API call
-	url := fmt.Sprintf("%s/repositories/%s/commits?pagelen=100&since=%s&until=%s",
-		c.baseURL, repoFullName, since, until)
+	c.setAuth(req)
+	req.Header.Set("Accept", "application/json")
 
-	data, err := c.makeRequest(url)
+	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, c.retryOn.network, err
 	}
+	defer resp.Body.Close()
+	c.limiter.observe(resp.Header)
 
-	var response struct {
-		Values []Commit `json:"values"`
-		Next   string   `json:"next"`
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{StatusCode: resp.StatusCode}
+		if resp.StatusCode == http.StatusTooManyRequests {
+			apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		}
+		retryable := (resp.StatusCode == http.StatusTooManyRequests && c.retryOn.rateLimited) ||
+			(retryableStatus(resp.StatusCode) && c.retryOn.serverError)
+		return nil, retryable, apiErr
 	}
 
-	err = json.Unmarshal(data, &response)
+	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, c.retryOn.network, err
 	}
+	return data, false, nil
+}
 
-	if len(response.Values) == 0 {
-		return nil, fmt.Errorf("no commits found near creation date")
+// setWorkspaces makes the client list repositories from every workspace in
+// list. The first one is used for single-repository lookups.
+func (c *BitbucketClient) setWorkspaces(list []string) {
+	c.workspace = list[0]
+	if len(list) > 1 {
+		c.workspaces = list
 	}
+}
 
-	// Return the oldest commit from the filtered results (last in the list)
-	return &response.Values[len(response.Values)-1], nil
+// cacheIdentity identifies the credentials and workspaces for the response
+// cache, so different users never share cached responses. Secrets are
+// hashed rather than stored.
+func (c *BitbucketClient) cacheIdentity() string {
+	return strings.Join([]string{c.baseURL, c.username, hashKey(c.appPassword), hashKey(c.accessToken), c.workspaceLabel()}, "\x00")
 }
 
-func loadConfigFromFile() (*Config, error) {
-	configPaths := []string{
-		"bhunter.local.yaml", // Local override (highest priority)
-		"bhunter.local.yml",
-		"bhunter.yaml", // Standard config
-		"bhunter.yml",
-		".bhunter.local.yaml", // Hidden local override
-		".bhunter.local.yml",
-		".bhunter.yaml", // Hidden config
-		".bhunter.yml",
+// workspaceLabel names the scanned workspaces for headers and reports
+func (c *BitbucketClient) workspaceLabel() string {
+	if len(c.workspaces) > 1 {
+		return strings.Join(c.workspaces, ",")
 	}
+	return c.workspace
+}
 
-	// Try current directory first
-	for _, configPath := range configPaths {
-		if _, err := os.Stat(configPath); err == nil {
-			return readConfigFile(configPath)
-		}
+// getRepositories lists all repositories in the client's workspaces, tagging
+// each with the workspace it came from. A non-empty query is passed to the
+// API as a server-side "q" filter. Listing stops once maxRepos repositories
+// have been found.
+func (c *BitbucketClient) getRepositories(ctx context.Context, query string) ([]Repository, error) {
+	workspaces := c.workspaces
+	if len(workspaces) == 0 {
+		workspaces = []string{c.workspace}
 	}
 
-	// Try home directory
-	homeDir, err := os.UserHomeDir()
-	if err == nil {
-		for _, configPath := range configPaths {
-			fullPath := filepath.Join(homeDir, configPath)
-			if _, err := os.Stat(fullPath); err == nil {
-				return readConfigFile(fullPath)
+	var allRepos []Repository
+	for _, workspace := range workspaces {
+		limit := 0
+		if c.maxRepos > 0 {
+			limit = c.maxRepos - len(allRepos)
+			if limit <= 0 {
+				break
+			}
+		}
+		repos, err := c.listWorkspaceRepositories(ctx, workspace, query, limit)
+		if err != nil {
+			if len(workspaces) > 1 {
+				return nil, fmt.Errorf("workspace %s: %w", workspace, err)
 			}
+			return nil, err
 		}
+		allRepos = append(allRepos, repos...)
 	}
-
-	return nil, fmt.Errorf("no config file found")
+	c.reposCapped = c.maxRepos > 0 && len(allRepos) >= c.maxRepos
+	c.completeRepositories(ctx, allRepos)
+	return allRepos, nil
 }
 
-func readConfigFile(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+// listWorkspaceRepositories lists the repositories of a single workspace, or
+// only the first limit of them when limit is positive
+func (c *BitbucketClient) listWorkspaceRepositories(ctx context.Context, workspace, query string, limit int) ([]Repository, error) {
+	var allRepos []Repository
+	url, err := c.flavor.repositoriesURL(c.baseURL, workspace, query, c.role, limitedPageLen(c.pageLen, limit))
 	if err != nil {
 		return nil, err
 	}
+	if resumeURL := c.cursor.takeResumeURL(); resumeURL != "" {
+		url = resumeURL
+	}
 
-	var config Config
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
-		return nil, err
+	pages := 0
+	for url != "" {
+		data, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		repos, next, err := c.flavor.parseRepositories(data, url)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range repos {
+			repos[i].Workspace = workspace
+			c.anonymizer.repository(&repos[i])
+		}
+		allRepos = append(allRepos, repos...)
+		if limit > 0 && len(allRepos) >= limit {
+			// The rest of the workspace isn't wanted, so neither is the next
+			// page. A resumed scan starts after this page when all of it was
+			// used, otherwise at this page again, repeating some repositories
+			// rather than skipping any.
+			resume := next
+			if len(allRepos) > limit {
+				resume = url
+			}
+			if err := c.cursor.save(resume); err != nil {
+				return nil, err
+			}
+			return allRepos[:limit], nil
+		}
+		url = next
+
+		pages++
+		if err := c.cursor.save(url); err != nil {
+			return nil, err
+		}
+		if c.cursor.pageLimitReached(pages) {
+			break
+		}
 	}
 
-	return &config, nil
+	return allRepos, nil
 }
 
-func createSampleConfigFile() {
-	sampleConfig := `# Bitbucket Hunter Configuration
-username: your_username
-app_password: your_app_password
-workspace: your_workspace  # Optional, defaults to username
-`
-	err := os.WriteFile("bhunter.yaml", []byte(sampleConfig), 0644)
-	if err != nil {
-		fmt.Printf("Error creating sample config file: %v\n", err)
-	} else {
-		fmt.Println("Sample config file 'bhunter.yaml' created. Please edit it with your credentials.")
+// validRoles are the values accepted by the repositories endpoint's role filter
+var validRoles = []string{"owner", "admin", "contributor", "member"}
+
+// parseRole validates a --role value
+func parseRole(role string) (string, error) {
+	role = strings.ToLower(strings.TrimSpace(role))
+	for _, valid := range validRoles {
+		if role == valid {
+			return role, nil
+		}
 	}
+	return "", fmt.Errorf("invalid role %q (valid: %s)", role, strings.Join(validRoles, ", "))
 }
 
-func formatDate(t time.Time) string {
-	return t.Format("2006-01-02 15:04:05")
-}
+// getRepositoriesModifiedSince lists repositories updated after since. The
+// filter is applied server-side; if the API rejects the query the full list is
+// fetched and filtered client-side instead.
+func (c *BitbucketClient) getRepositoriesModifiedSince(ctx context.Context, since time.Time) ([]Repository, error) {
+	query := fmt.Sprintf("updated_on > %s", since.UTC().Format(time.RFC3339))
+	repos, err := c.getRepositories(ctx, query)
 
-func isOlderThan(t time.Time, months int) bool {
-	return time.Since(t) > time.Duration(months)*30*24*time.Hour
+	var apiErr *APIError
+	rejected := errors.Is(err, errFilterUnsupported) || (errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest)
+	if err == nil || !rejected {
+		return repos, err
+	}
+
+	allRepos, err := c.getRepositories(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, repo := range allRepos {
+		if repo.UpdatedOn.After(since) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos, nil
 }
 
-func printUsage() {
-	fmt.Println("Bitbucket Hunter - Repository and Branch Analysis Tool")
-	fmt.Println("\nUsage:")
-	fmt.Println("  bhunter [options]")
-	fmt.Println("\nOptions:")
-	fmt.Println("  -u, --username     Bitbucket username")
-	fmt.Println("  -p, --password     Bitbucket app password")
-	fmt.Println("  -w, --workspace    Bitbucket workspace (optional, defaults to username)")
-	fmt.Println("  -r, --repo         Repository name (optional, analyze only this repo)")
-	fmt.Println("  -e, --exclude      Comma-separated list of project keys/names to exclude")
-	fmt.Println("  -i, --include      Comma-separated list of project keys/names to include (only these analyzed)")
-	fmt.Println("  --repo-only        Show only repository information (no branch details)")
-	fmt.Println("  -o, --output       Output old branch names (>6 months) for piping to bkiller")
-	fmt.Println("  --csv              Output repository information in CSV format")
-	fmt.Println("  --summary          Show summary statistics (repos, branches, old branches)")
-	fmt.Println("  -c, --config       Create sample config file")
-	fmt.Println("  -h, --help         Show this help message")
-	fmt.Println("  --version          Show version information")
-	fmt.Println("\nExamples:")
-	fmt.Println("  bhunter                                    # Analyze all repositories with branches")
-	fmt.Println("  bhunter --repo-only                        # Show only repository information")
-	fmt.Println("  bhunter --summary                          # Show summary statistics only")
-	fmt.Println("  bhunter -r BidvestDirect                   # Analyze only BidvestDirect repo")
-	fmt.Println("  bhunter -r BidvestDirect --repo-only       # Show only BidvestDirect repo info")
-	fmt.Println("  bhunter --output | bkiller                 # Find old branches and pipe to bkiller")
-	fmt.Println("  bhunter -r MyRepo -o | bkiller             # Find old branches in specific repo")
-	fmt.Println("  bhunter -e test,demo                       # Exclude repositories from projects 'test' or 'demo'")
-	fmt.Println("  bhunter --exclude old-project --summary    # Get summary excluding repositories from 'old-project'")
-	fmt.Println("  bhunter --include core,main --csv          # Analyze only repositories from 'core' and 'main' projects, output as CSV")
-	fmt.Println("\nConfiguration File:")
-	fmt.Println("  The program will automatically look for config files in this order:")
-	fmt.Println("  1. ./bhunter.local.yaml or ./bhunter.local.yml (local overrides)")
-	fmt.Println("  2. ./bhunter.yaml or ./bhunter.yml (standard config)")
-	fmt.Println("  3. ./.bhunter.local.yaml or ./.bhunter.local.yml (hidden local)")
-	fmt.Println("  4. ./.bhunter.yaml or ./.bhunter.yml (hidden config)")
-	fmt.Println("  5. ~/bhunter.local.yaml or ~/bhunter.local.yml (user local)")
-	fmt.Println("  6. ~/bhunter.yaml or ~/bhunter.yml (user config)")
-	fmt.Println("  7. ~/.bhunter.local.yaml or ~/.bhunter.local.yml (hidden user local)")
-	fmt.Println("  8. ~/.bhunter.yaml or ~/.bhunter.yml (hidden user config)")
-	fmt.Println("\nExample config file (bhunter.yaml):")
-	fmt.Println("  username: your_username")
-	fmt.Println("  app_password: your_app_password")
-	fmt.Println("  workspace: your_workspace")
-	fmt.Println("\nGet app password at: https://bitbucket.org/account/settings/app-passwords/")
-}
-
-func outputOldBranches(repo Repository, client *BitbucketClient) {
-	branches, err := client.getBranches(repo.FullName)
+// getRepository fetches a repository by name from the client's first
+// workspace, or from another one when given as "workspace/name"
+func (c *BitbucketClient) getRepository(ctx context.Context, repoName string) (*Repository, error) {
+	workspace := c.workspace
+	if i := strings.Index(repoName, "/"); i >= 0 {
+		workspace, repoName = repoName[:i], repoName[i+1:]
+	}
+	data, err := c.makeRequest(ctx, c.flavor.repositoryURL(c.baseURL, workspace, repoName))
 	if err != nil {
-		// Don't output errors when in pipe mode
-		return
+		return nil, err
 	}
 
-	for _, branch := range branches {
-		// Skip main/master branches
-		if branch.Name == "main" || branch.Name == "master" || branch.Name == "develop" {
-			continue
-		}
+	repo, err := c.flavor.parseRepository(data)
+	if err != nil {
+		return nil, err
+	}
 
-		if isOlderThan(branch.Target.Date, 6) {
-			fmt.Printf("%s:%s\n", repo.FullName, branch.Name)
-		}
+	// The API answers requests for a renamed repository with a redirect to its
+	// new location, which the HTTP client follows. Detect that by comparing the
+	// slug we asked for with the one we got, so FullName is used from now on.
+	slug := repo.FullName[strings.LastIndex(repo.FullName, "/")+1:]
+	if repo.FullName != "" && !strings.EqualFold(slug, repoName) && !strings.EqualFold(repo.Name, repoName) {
+		repo.RenamedFrom = repoName
 	}
-}
+	repo.Workspace = workspace
+	c.anonymizer.repository(repo)
 
-func displayRepositoryInfo(repo Repository, creator string, client *BitbucketClient, yellow, red, bold, green, cyan func(a ...interface{}) string, repoOnly bool) {
-	fmt.Printf("\n%s\n", green("Repository: "+repo.Name))
-	fmt.Printf("  Name: %s\n", repo.Name)
-	fmt.Printf("  Owner: %s (%s)\n", repo.Owner.DisplayName, repo.Owner.Username)
-	fmt.Printf("  Creator: %s\n", creator)
+	repos := []Repository{*repo}
+	c.completeRepositories(ctx, repos)
+	return &repos[0], nil
+}
 
-	// Display project information if available
-	if repo.Project.Key != "" || repo.Project.Name != "" {
-		if repo.Project.Key != "" && repo.Project.Name != "" {
-			fmt.Printf("  Project: %s (%s)\n", repo.Project.Name, repo.Project.Key)
-		} else if repo.Project.Key != "" {
-			fmt.Printf("  Project: %s\n", repo.Project.Key)
-		} else {
-			fmt.Printf("  Project: %s\n", repo.Project.Name)
-		}
-	} else {
-		fmt.Printf("  Project: (not assigned to any project)\n")
+// completeRepositories fills in the main branch and last update of
+// repositories whose flavor leaves them out of the listing: the default branch
+// is the main branch, and the tip of the most recently changed branch dates
+// the last update. An empty repository has neither, so a 404 leaves them
+// unset; other failures are recorded for the end-of-run report.
+func (c *BitbucketClient) completeRepositories(ctx context.Context, repos []Repository) {
+	flavor, ok := c.flavor.(repositoryDetailsFlavor)
+	if !ok {
+		return
 	}
+	forEachRepo(ctx, repos, cap(c.requestSlots), func(i int, repo Repository) {
+		err := c.completeRepository(ctx, flavor, &repos[i])
+		var apiErr *APIError
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound) {
+			c.failures.record(repo.FullName, "repository details", err)
+		}
+	})
+}
 
-	fmt.Printf("  Date Created: %s\n", formatDate(repo.CreatedOn))
+func (c *BitbucketClient) completeRepository(ctx context.Context, flavor repositoryDetailsFlavor, repo *Repository) error {
+	url := flavor.latestBranchURL(c.baseURL, repo.FullName)
+	data, err := c.makeRequest(ctx, url)
+	if err != nil {
+		return err
+	}
+	branches, _, err := c.flavor.parseBranches(data, url)
+	if err != nil {
+		return err
+	}
+	if len(branches) > 0 {
+		repo.UpdatedOn = branches[0].Target.Date
+	}
 
-	lastAccessed := formatDate(repo.UpdatedOn)
-	if isOlderThan(repo.UpdatedOn, 12) {
-		lastAccessed = yellow(lastAccessed)
+	data, err = c.makeRequest(ctx, flavor.defaultBranchURL(c.baseURL, repo.FullName))
+	if err != nil {
+		return err
 	}
-	fmt.Printf("  Date Last Accessed: %s\n", lastAccessed)
-	fmt.Printf("  Main Branch: %s\n", repo.MainBranch.Name)
+	repo.MainBranch.Name, err = flavor.parseDefaultBranch(data)
+	return err
+}
 
-	// Skip branch details if repo-only flag is set
-	if repoOnly {
-		return
+// getBranches lists all branches of a repository. Successful results are
+// cached per client, so classifying branches ahead of display is free.
+func (c *BitbucketClient) getBranches(ctx context.Context, repoFullName string) ([]Branch, error) {
+	c.branchesMu.Lock()
+	cached, ok := c.branches[repoFullName]
+	c.branchesMu.Unlock()
+	if ok {
+		return cached, nil
 	}
 
-	fmt.Println("\n  Branches:")
-	branches, err := client.getBranches(repo.FullName)
+	// Failures are logged for the end-of-run report, where the callers that
+	// skip a repository without branches would otherwise hide them
+	branches, truncated, err := c.fetchBranches(ctx, repoFullName)
 	if err != nil {
-		fmt.Printf("    Error fetching branches: %v\n", err)
-		return
+		c.failures.record(repoFullName, "branch listing", err)
+		return nil, err
 	}
-	for _, branch := range branches {
-		fmt.Printf("    %s\n", cyan("Branch: "+branch.Name))
-		fmt.Printf("      Name: %s\n", branch.Name)
-		fmt.Printf("      Date Created: %s\n", formatDate(branch.Target.Date))
+	c.failures.clear(repoFullName, "branch listing")
 
-		lastPush := formatDate(branch.Target.Date)
-		if isOlderThan(branch.Target.Date, 6) {
-			lastPush = red(lastPush)
-		}
-		fmt.Printf("      Date Last Pushed: %s\n", lastPush)
-		fmt.Printf("      Last Pushed By: %s\n", branch.Target.Author.User.DisplayName)
-		fmt.Printf("      Created By: %s\n", branch.Target.Author.User.DisplayName)
-	}
-}
+	c.branchesMu.Lock()
+	c.branches[repoFullName] = branches
+	c.truncated[repoFullName] = truncated
+	c.branchesMu.Unlock()
 
-// RepositoryResult holds a repository and its processing result
-type RepositoryResult struct {
-	Repository Repository
-	Creator    string
-	Error      error
+	return branches, nil
 }
 
-// processRepositoryConcurrently processes a single repository with creator lookup
-func processRepositoryConcurrently(repo Repository, client *BitbucketClient, results chan<- RepositoryResult) {
-	creator := "(unable to determine)"
+// branchesTruncated reports whether a repository's listed branches stopped at
+// the --max-branches cap while more remained, so the list is incomplete
+func (c *BitbucketClient) branchesTruncated(repoFullName string) bool {
+	c.branchesMu.Lock()
+	defer c.branchesMu.Unlock()
+	return c.truncated[repoFullName]
+}
 
-	// Try to get the actual creator from the first commit
-	firstCommit, err := client.getFirstCommit(repo.FullName)
-	if err == nil && firstCommit.Author.User.DisplayName != "" {
-		creator = firstCommit.Author.User.DisplayName
+// fetchBranches lists a repository's branches, stopping at maxBranches, and
+// reports whether more branches remained past the cap. One branch more than
+// the cap is asked for to tell: GitHub and GitLab report a next page after
+// every full one, so a following page doesn't prove there are more.
+func (c *BitbucketClient) fetchBranches(ctx context.Context, repoFullName string) ([]Branch, bool, error) {
+	var allBranches []Branch
+	truncated := false
+	limit := 0
+	if c.maxBranches > 0 {
+		limit = c.maxBranches + 1
 	}
+	url := c.flavor.branchesURL(c.baseURL, repoFullName, limitedPageLen(c.pageLen, limit))
 
-	results <- RepositoryResult{
-		Repository: repo,
-		Creator:    creator,
-		Error:      err,
-	}
-}
+	for url != "" {
+		data, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return nil, false, err
+		}
 
-// processRepositoriesConcurrently processes repositories with controlled concurrency
-func processRepositoriesConcurrently(repos []Repository, client *BitbucketClient, maxConcurrency int) []RepositoryResult {
-	results := make(chan RepositoryResult, len(repos))
-	semaphore := make(chan struct{}, maxConcurrency)
-	var wg sync.WaitGroup
+		branches, next, err := c.flavor.parseBranches(data, url)
+		if err != nil {
+			return nil, false, err
+		}
 
-	// Start workers
-	for _, repo := range repos {
-		wg.Add(1)
-		go func(r Repository) {
-			defer wg.Done()
-			semaphore <- struct{}{} // Acquire semaphore
-			processRepositoryConcurrently(r, client, results)
-			<-semaphore // Release semaphore
-		}(repo)
+		for i := range branches {
+			c.anonymizer.branch(&branches[i])
+		}
+		allBranches = append(allBranches, branches...)
+		if c.maxBranches > 0 && len(allBranches) > c.maxBranches {
+			truncated = true
+			allBranches = allBranches[:c.maxBranches]
+			break
+		}
+		url = next
 	}
 
-	// Close results channel when all workers are done
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
-
-	// Collect results
-	var repoResults []RepositoryResult
-	for result := range results {
-		repoResults = append(repoResults, result)
+	// Some refs come back without a target date (and GitHub's without an
+	// author); resolve them from the tip commit
+	for i := range allBranches {
+		if allBranches[i].Target.Date.IsZero() && allBranches[i].Target.Hash != "" {
+			tip, err := c.getCommit(ctx, repoFullName, allBranches[i].Target.Hash)
+			if err == nil {
+				allBranches[i].Target.Date = tip.Date
+				if allBranches[i].AuthorName() == "" {
+					allBranches[i].Target.Author.User.DisplayName = tip.Author.User.DisplayName
+					allBranches[i].Target.Author.Raw = tip.Author.Raw
+				}
+			}
+		}
 	}
 
-	return repoResults
+	return allBranches, truncated, nil
 }
 
-// outputCSVHeader prints the CSV header
-func outputCSVHeader() {
-	fmt.Println("Repository Name,Owner,Creator,Date Created,Date Last Accessed,Main Branch,Repo Age (months),Last Access (months),Branch Name,Branch Date Created,Branch Last Pushed,Branch Last Pushed By,Branch Age (months)")
+// getBranchCreationDate estimates when a branch was created using the oldest
+// commit on it that is not reachable from the repository's main branch. It
+// returns the zero time if the branch has no commits of its own.
+func (c *BitbucketClient) getBranchCreationDate(ctx context.Context, repo Repository, branchName string) (time.Time, error) {
+	first, err := c.getBranchFirstCommit(ctx, repo, branchName)
+	if err != nil || first == nil {
+		return time.Time{}, err
+	}
+	return first.Date, nil
 }
 
-// outputRepositoryCSV outputs repository information in CSV format
-func outputRepositoryCSV(repo Repository, creator string, client *BitbucketClient, repoOnly bool) {
-	now := time.Now()
-	repoAge := calculateMonthsDifference(repo.CreatedOn, now)
-	lastAccessAge := calculateMonthsDifference(repo.UpdatedOn, now)
+// getBranchFirstCommit returns the oldest commit on a branch that is not
+// reachable from the repository's main branch, i.e. the first commit made
+// after the branch diverged, or nil if the branch has no commits of its own.
+// Like lookupFirstCommit it gives up with errHistoryTooLong after
+// creatorPages pages. Results are cached per client, as both the grace
+// period and the branch creator need them.
+func (c *BitbucketClient) getBranchFirstCommit(ctx context.Context, repo Repository, branchName string) (*Commit, error) {
+	flavor, ok := c.flavor.(branchCommitsFlavor)
+	if !ok {
+		return nil, errLookupUnsupported
+	}
+	// Without a main branch to exclude, the walk would cover the whole history
+	if repo.MainBranch.Name == "" {
+		return nil, errNoMainBranch
+	}
 
-	// Escape commas and quotes in text fields
-	name := escapeCSV(repo.Name)
-	ownerDisplay := escapeCSV(repo.Owner.DisplayName)
-	creatorDisplay := escapeCSV(creator)
-	mainBranch := escapeCSV(repo.MainBranch.Name)
+	key := repo.FullName + ":" + branchName
+	c.branchStartMu.Lock()
+	cached, ok := c.branchStarts[key]
+	c.branchStartMu.Unlock()
+	if ok {
+		return cached, nil
+	}
 
-	if repoOnly {
-		// Repository-only mode: output single row without branch details
-		fmt.Printf("%s,%s,%s,%s,%s,%s,%d,%d,,,,,\n",
-			name,
-			ownerDisplay,
-			creatorDisplay,
-			repo.CreatedOn.Format("2006-01-02"),
-			repo.UpdatedOn.Format("2006-01-02"),
-			mainBranch,
-			repoAge,
-			lastAccessAge)
-	} else {
-		// Include branch information
-		branches, err := client.getBranches(repo.FullName)
-		if err != nil {
-			// Output repository row with error indication
-			fmt.Printf("%s,%s,%s,%s,%s,%s,%d,%d,ERROR: %s,,,\n",
-				name,
-				ownerDisplay,
-				creatorDisplay,
-				repo.CreatedOn.Format("2006-01-02"),
-				repo.UpdatedOn.Format("2006-01-02"),
-				mainBranch,
-				repoAge,
-				lastAccessAge,
-				escapeCSV(err.Error()))
-			return
+	url := flavor.branchCommitsURL(c.baseURL, repo.FullName, branchName, repo.MainBranch.Name, pageSize)
+
+	var oldest *Commit
+	for pages := 1; url != ""; pages++ {
+		data, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return nil, err
 		}
 
-		for _, branch := range branches {
-			branchAge := calculateMonthsDifference(branch.Target.Date, now)
-			branchName := escapeCSV(branch.Name)
-			lastPushedBy := escapeCSV(branch.Target.Author.User.DisplayName)
+		commits, next, err := c.flavor.parseCommits(data, url)
+		if err != nil {
+			return nil, err
+		}
 
-			fmt.Printf("%s,%s,%s,%s,%s,%s,%d,%d,%s,%s,%s,%s,%d\n",
-				name,
-				ownerDisplay,
-				creatorDisplay,
-				repo.CreatedOn.Format("2006-01-02"),
-				repo.UpdatedOn.Format("2006-01-02"),
-				mainBranch,
-				repoAge,
-				lastAccessAge,
-				branchName,
-				branch.Target.Date.Format("2006-01-02"),
-				branch.Target.Date.Format("2006-01-02"),
-				lastPushedBy,
-				branchAge)
+		// Commits are returned newest first
+		if len(commits) > 0 {
+			oldest = &commits[len(commits)-1]
+		}
+		if next != "" && c.creatorPages > 0 && pages >= c.creatorPages {
+			return nil, errHistoryTooLong
 		}
+		url = next
 	}
+	if oldest != nil {
+		c.anonymizer.commit(oldest)
+	}
+
+	c.branchStartMu.Lock()
+	c.branchStarts[key] = oldest
+	c.branchStartMu.Unlock()
+
+	return oldest, nil
 }
 
-// escapeCSV escapes commas and quotes in CSV fields
-func escapeCSV(field string) string {
-	if strings.Contains(field, ",") || strings.Contains(field, "\"") || strings.Contains(field, "\n") {
-		// Replace quotes with double quotes and wrap in quotes
-		field = strings.ReplaceAll(field, "\"", "\"\"")
-		return "\"" + field + "\""
+// getMergeBase returns the best common ancestor of two commits, or
+// errLookupUnsupported where the API has no merge-base lookup. Lookups are
+// keyed by commit hash and cached, so branches sharing a tip cost one request.
+func (c *BitbucketClient) getMergeBase(ctx context.Context, repoFullName, hash, otherHash string) (*Commit, error) {
+	flavor, ok := c.flavor.(mergeBaseFlavor)
+	if !ok {
+		return nil, errLookupUnsupported
 	}
-	return field
+	key := repoFullName + ":" + hash + ".." + otherHash
+	c.mergeBaseMu.Lock()
+	cached, ok := c.mergeBases[key]
+	c.mergeBaseMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	data, err := c.makeRequest(ctx, flavor.mergeBaseURL(c.baseURL, repoFullName, hash, otherHash))
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := flavor.parseMergeBase(data)
+	if err != nil {
+		return nil, err
+	}
+	c.anonymizer.commit(commit)
+
+	c.mergeBaseMu.Lock()
+	c.mergeBases[key] = commit
+	c.mergeBaseMu.Unlock()
+
+	return commit, nil
 }
 
-// SummaryStats holds summary statistics
-type SummaryStats struct {
-	TotalRepos     int
-	TotalBranches  int
-	OldBranches    int
-	OldRepos       int
-	RecentRepos    int
-	RecentBranches int
+// getCommit fetches a single commit by its hash
+func (c *BitbucketClient) getCommit(ctx context.Context, repoFullName, hash string) (*Commit, error) {
+	data, err := c.makeRequest(ctx, c.flavor.commitURL(c.baseURL, repoFullName, hash))
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := c.flavor.parseCommit(data)
+	if err != nil {
+		return nil, err
+	}
+	c.anonymizer.commit(commit)
+
+	return commit, nil
 }
 
-// calculateSummaryStats calculates summary statistics for repositories and branches
-func calculateSummaryStats(repos []Repository, client *BitbucketClient) (*SummaryStats, error) {
-	stats := &SummaryStats{
-		TotalRepos: len(repos),
+// getFirstCommit returns the earliest commit of a repository, which identifies
+// its creator. Results are cached per client.
+func (c *BitbucketClient) getFirstCommit(ctx context.Context, repoFullName string) (*Commit, error) {
+	c.firstCommitMu.Lock()
+	entry, ok := c.firstCommits[repoFullName]
+	c.firstCommitMu.Unlock()
+	if ok {
+		return entry.commit, entry.err
 	}
 
-	for _, repo := range repos {
-		// Check if repo is old (>12 months since last access)
-		if isOlderThan(repo.UpdatedOn, 12) {
-			stats.OldRepos++
-		} else {
-			stats.RecentRepos++
-		}
+	commit, err := c.lookupFirstCommit(ctx, repoFullName)
+
+	c.firstCommitMu.Lock()
+	c.firstCommits[repoFullName] = firstCommitEntry{commit: commit, err: err}
+	c.firstCommitMu.Unlock()
+
+	return commit, err
+}
 
-		// Get branches for each repository
-		branches, err := client.getBranches(repo.FullName)
+// defaultCreatorPages is how many pages of commits (100 commits each) the
+// first-commit lookup searches by default before giving up
+const defaultCreatorPages = 20
+
+// lookupFirstCommit walks the commit history to its last page. Commits are
+// listed newest first, so the repository's root commit is on the final page;
+// the earliest dated commit seen is kept in case merged histories interleave.
+// This doesn't depend on CreatedOn, which can predate or postdate the first
+// real commit (e.g. after an import), but costs one request per 100 commits,
+// so the walk stops after creatorPages pages with errHistoryTooLong rather
+// than paging through a large repository's whole history.
+func (c *BitbucketClient) lookupFirstCommit(ctx context.Context, repoFullName string) (*Commit, error) {
+	// GitLab project paths may include subgroups, so only require a namespace
+	if !strings.Contains(repoFullName, "/") {
+		return nil, fmt.Errorf("invalid repository name format")
+	}
+
+	url := c.flavor.commitsURL(c.baseURL, repoFullName, pageSize)
+
+	var oldest *Commit
+	for pages := 1; url != ""; pages++ {
+		data, err := c.makeCommitsRequest(ctx, url)
 		if err != nil {
-			// Skip repos with branch fetch errors but continue processing
-			continue
+			return nil, err
 		}
 
-		stats.TotalBranches += len(branches)
+		commits, next, err := c.flavor.parseCommits(data, url)
+		if err != nil {
+			return nil, err
+		}
 
-		for _, branch := range branches {
-			if isOlderThan(branch.Target.Date, 6) {
-				stats.OldBranches++
-			} else {
-				stats.RecentBranches++
+		// Order by date ascending; on a tie the later-listed commit, the
+		// ancestor in newest-first order, comes first
+		for i := range commits {
+			if oldest == nil || !commits[i].Date.After(oldest.Date) {
+				oldest = &commits[i]
 			}
 		}
+		if next != "" && c.creatorPages > 0 && pages >= c.creatorPages {
+			return nil, errHistoryTooLong
+		}
+		url = next
 	}
 
-	return stats, nil
-}
+	if oldest == nil {
+		return nil, errNoCommits
+	}
 
-// displaySummaryStats displays the summary statistics
-func displaySummaryStats(stats *SummaryStats, yellow, red, green, cyan func(a ...interface{}) string) {
-	fmt.Printf("\n%s\n", green("=== BITBUCKET WORKSPACE SUMMARY ==="))
-	fmt.Printf("\n%s\n", cyan("Repository Statistics:"))
-	fmt.Printf("  Total Repositories: %d\n", stats.TotalRepos)
+	c.anonymizer.commit(oldest)
+	return oldest, nil
+}
 
-	recentReposDisplay := fmt.Sprintf("%d", stats.RecentRepos)
-	oldReposDisplay := fmt.Sprintf("%d", stats.OldRepos)
-	if stats.OldRepos > 0 {
-		oldReposDisplay = yellow(oldReposDisplay)
+// makeCommitsRequest fetches a page of a commit listing. GitHub answers
+// commit listings of an empty repository with 409, which becomes errNoCommits.
+func (c *BitbucketClient) makeCommitsRequest(ctx context.Context, url string) ([]byte, error) {
+	data, err := c.makeRequest(ctx, url)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		return nil, errNoCommits
 	}
+	return data, err
+}
 
-	fmt.Printf("  Recent Repositories (accessed within 12 months): %s\n", recentReposDisplay)
-	fmt.Printf("  Old Repositories (no access for >12 months): %s\n", oldReposDisplay)
+// errLookupUnsupported is returned by lookups whose endpoint the API flavor
+// doesn't have
+var errLookupUnsupported = errors.New("lookup not supported by this API")
 
-	if stats.TotalRepos > 0 {
-		oldRepoPercent := float64(stats.OldRepos) / float64(stats.TotalRepos) * 100
-		fmt.Printf("  Old Repository Percentage: %.1f%%\n", oldRepoPercent)
-	}
+// errNoMainBranch is returned by lookups relative to the main branch of a
+// repository that has none, such as an empty one
+var errNoMainBranch = errors.New("repository has no main branch")
 
-	fmt.Printf("\n%s\n", cyan("Branch Statistics:"))
-	fmt.Printf("  Total Branches: %d\n", stats.TotalBranches)
+// errNoCommits is returned by commit lookups on a repository without commits.
+// An empty repository isn't a failed one, so it never counts as a partial error.
+var errNoCommits = errors.New("repository has no commits")
 
-	recentBranchesDisplay := fmt.Sprintf("%d", stats.RecentBranches)
-	oldBranchesDisplay := fmt.Sprintf("%d", stats.OldBranches)
-	if stats.OldBranches > 0 {
-		oldBranchesDisplay = red(oldBranchesDisplay)
-	}
+// errHistoryTooLong is returned by the first-commit lookup when the history
+// goes on past the pages it searches. Like an empty repository, that leaves
+// the owner as the creator rather than counting as a failure.
+var errHistoryTooLong = errors.New("first commit is beyond the searched commit history")
 
-	fmt.Printf("  Recent Branches (updated within 6 months): %s\n", recentBranchesDisplay)
-	fmt.Printf("  Old Branches (no updates for >6 months): %s\n", oldBranchesDisplay)
+// errNoConfigFile is returned by loadConfigFromFile when none of the candidate
+// config files exist. Any other error means a config file was found but could
+// not be used.
+var errNoConfigFile = errors.New("no config file found")
 
-	if stats.TotalBranches > 0 {
-		oldBranchPercent := float64(stats.OldBranches) / float64(stats.TotalBranches) * 100
-		fmt.Printf("  Old Branch Percentage: %.1f%%\n", oldBranchPercent)
-		avgBranchesPerRepo := float64(stats.TotalBranches) / float64(stats.TotalRepos)
-		fmt.Printf("  Average Branches per Repository: %.1f\n", avgBranchesPerRepo)
+// getCommitCount counts the commits in a repository. If limit is greater than
+// zero, paging stops as soon as at least limit commits have been seen, so for
+// larger repositories the result is only a lower bound and complete is false.
+// Counts are cached per client so repeated lookups for the same repository
+// are free.
+func (c *BitbucketClient) getCommitCount(ctx context.Context, repoFullName string, limit int) (count int, complete bool, err error) {
+	c.commitCountMu.Lock()
+	entry, ok := c.commitCounts[repoFullName]
+	c.commitCountMu.Unlock()
+	if ok && (entry.complete || (limit > 0 && entry.count >= limit)) {
+		return entry.count, entry.complete, nil
 	}
 
-	fmt.Printf("\n%s\n", cyan("Cleanup Recommendations:"))
-	if stats.OldBranches > 0 {
-		fmt.Printf("  • Consider cleaning up %s old branches\n", red(fmt.Sprintf("%d", stats.OldBranches)))
-		fmt.Printf("  • Use: bhunter --output | bkiller --dry-run\n")
-	}
-	if stats.OldRepos > 0 {
-		fmt.Printf("  • Review %s repositories with no recent activity\n", yellow(fmt.Sprintf("%d", stats.OldRepos)))
-	}
-	if stats.OldBranches == 0 && stats.OldRepos == 0 {
-		fmt.Printf("  • %s No cleanup needed - workspace is well maintained!\n", green("✓"))
-	}
-	fmt.Println()
-}
+	complete = true
+	url := c.flavor.commitsURL(c.baseURL, repoFullName, pageSize)
 
-// calculateMonthsDifference calculates the accurate difference in months between two dates
-func calculateMonthsDifference(start, end time.Time) int {
-	years := end.Year() - start.Year()
-	months := int(end.Month()) - int(start.Month())
-	totalMonths := years*12 + months
+	for url != "" {
+		data, err := c.makeCommitsRequest(ctx, url)
+		if errors.Is(err, errNoCommits) {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
 
-	// Adjust if the day hasn't been reached yet in the current month
-	if end.Day() < start.Day() {
-		totalMonths--
+		commits, next, err := c.flavor.parseCommits(data, url)
+		if err != nil {
+			return 0, false, err
+		}
+		count += len(commits)
+		url = next
+
+		// Stop paging once the cap is reached
+		if limit > 0 && count >= limit && url != "" {
+			complete = false
+			break
+		}
 	}
 
-	return totalMonths
+	c.commitCountMu.Lock()
+	c.commitCounts[repoFullName] = commitCountEntry{count: count, complete: complete}
+	c.commitCountMu.Unlock()
+
+	return count, complete, nil
+}
+
+// configDirs returns the directories searched for config files, highest
+// priority first: the --config-dir directory if given, the current directory,
+// the home directory, the XDG config directory and finally /etc/bhunter.
+func configDirs(extraDir string) []string {
+	var dirs []string
+	if extraDir != "" {
+		dirs = append(dirs, extraDir)
+	}
+	dirs = append(dirs, ".")
+
+	homeDir, err := os.UserHomeDir()
+	if err == nil {
+		dirs = append(dirs, homeDir)
+	}
+	if xdgHome := os.Getenv("XDG_CONFIG_HOME"); xdgHome != "" {
+		dirs = append(dirs, filepath.Join(xdgHome, "bhunter"))
+	} else if err == nil {
+		dirs = append(dirs, filepath.Join(homeDir, ".config", "bhunter"))
+	}
+	return append(dirs, "/etc/bhunter")
+}
+
+func loadConfigFromFile(extraDir string) (*Config, error) {
+	configPaths := []string{
+		"bhunter.local.yaml", // Local override (highest priority)
+		"bhunter.local.yml",
+		"bhunter.yaml", // Standard config
+		"bhunter.yml",
+		".bhunter.local.yaml", // Hidden local override
+		".bhunter.local.yml",
+		".bhunter.yaml", // Hidden config
+		".bhunter.yml",
+	}
+
+	for _, dir := range configDirs(extraDir) {
+		for _, configPath := range configPaths {
+			fullPath := filepath.Join(dir, configPath)
+			if _, err := os.Stat(fullPath); err == nil {
+				return readConfigFile(fullPath)
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("cannot access config file %s: %w", fullPath, err)
+			}
+		}
+	}
+
+	return nil, errNoConfigFile
+}
+
+// loadConfig loads the config file given with --config-file if any, and
+// otherwise searches the default locations with loadConfigFromFile. An
+// explicit path that doesn't exist is an error, never errNoConfigFile.
+func loadConfig(path, extraDir string) (*Config, error) {
+	if path == "" {
+		return loadConfigFromFile(extraDir)
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, fmt.Errorf("config file %s does not exist", path)
+	}
+	return readConfigFile(path)
+}
+
+func readConfigFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var config Config
+	err = yaml.Unmarshal(data, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return &config, nil
+}
+
+func createSampleConfigFile() {
+	sampleConfig := `# Bitbucket Hunter Configuration
+username: your_username
+app_password: your_app_password
+workspace: your_workspace  # Optional, defaults to username
+# access_token: your_oauth_token  # Use instead of username/app_password (workspace then required)
+`
+	err := os.WriteFile("bhunter.yaml", []byte(sampleConfig), 0644)
+	if err != nil {
+		fmt.Printf("Error creating sample config file: %v\n", err)
+	} else {
+		fmt.Println("Sample config file 'bhunter.yaml' created. Please edit it with your credentials.")
+	}
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "(unknown date)"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// asOf is the reference "now" for every age and staleness calculation. It
+// defaults to the current time and can be pinned with --as-of so a report
+// regenerated later produces identical classifications.
+var asOf = time.Now()
+
+// isOlderThan reports whether t is more than months calendar months before asOf
+func isOlderThan(t time.Time, months int) bool {
+	return monthsAge(months).olderThan(t)
+}
+
+// isStaleBranch reports whether a branch was last pushed longer ago than age.
+// Branches whose date could not be determined are never considered stale.
+func isStaleBranch(branch Branch, age ageThreshold) bool {
+	return !branch.Target.Date.IsZero() && age.olderThan(branch.Target.Date)
+}
+
+// Default staleness thresholds, overridable with --branch-age-months and
+// --repo-age-months
+const (
+	defaultBranchAgeMonths = 6
+	defaultRepoAgeMonths   = 12
+)
+
+// stalePolicy decides whether a branch or repository should be flagged as stale
+type stalePolicy struct {
+	client *BitbucketClient
+	// branchAge is the branch age threshold, from --branch-age-months or
+	// --older-than; repoMonths is the repository threshold in months
+	branchAge  ageThreshold
+	repoMonths int
+	// gracePeriod exempts branches created within this window even if their
+	// tip commit is old (e.g. cut from an old tag). The zero threshold
+	// disables the check, which avoids the extra per-branch commit lookups.
+	gracePeriod ageThreshold
+	// withPRs counts open pull requests toward the risk score (--with-prs)
+	withPRs bool
+}
+
+// isStale reports whether a branch in repo should be flagged as stale
+func (p *stalePolicy) isStale(ctx context.Context, repo Repository, branch Branch) bool {
+	if !isStaleBranch(branch, p.branchAge) {
+		return false
+	}
+	if p.gracePeriod.isZero() {
+		return true
+	}
+
+	created, err := p.client.getBranchCreationDate(ctx, repo, branch.Name)
+	if err != nil {
+		// Can't tell when the branch was cut, so fall back to its tip date
+		return true
+	}
+	if created.IsZero() {
+		// No commits of its own: the branch may have been cut from an old
+		// commit at any time, today included, so it gets the benefit of the doubt
+		return false
+	}
+	return p.gracePeriod.olderThan(created)
+}
+
+// isOldRepo reports whether repo has had no activity for longer than the
+// repository threshold. A repository whose last update is unknown isn't old.
+func (p *stalePolicy) isOldRepo(repo Repository) bool {
+	return !repo.UpdatedOn.IsZero() && isOlderThan(repo.UpdatedOn, p.repoMonths)
+}
+
+func printUsage() {
+	fmt.Println("Bitbucket Hunter - Repository and Branch Analysis Tool")
+	fmt.Println("\nUsage:")
+	fmt.Println("  bhunter [options]")
+	fmt.Println("\nOptions:")
+	fmt.Println("  -u, --username     Bitbucket username")
+	fmt.Println("  -p, --password     Bitbucket app password")
+	fmt.Println("  --access-token     Bitbucket OAuth 2.0 access token (used instead of username and app password)")
+	fmt.Println("  -w, --workspace    Bitbucket workspace, or a comma-separated list (optional, defaults to username)")
+	fmt.Println("  --base-url         API base URL, e.g. https://bitbucket.example.com for Data Center")
+	fmt.Println("  --provider         Hosting service: bitbucket, github or gitlab (default bitbucket)")
+	fmt.Println("  -r, --repo         Repository name (optional, analyze only this repo)")
+	fmt.Println("  --repo-file        Analyze only the repositories listed in this file, one per line (# starts a comment)")
+	fmt.Println("  -e, --exclude      Comma-separated list of project keys/names to exclude")
+	fmt.Println("  -i, --include      Comma-separated list of project keys/names to include (only these analyzed)")
+	fmt.Println("  --backoff-jitter   Retry backoff jitter: full or none (default full)")
+	fmt.Println("  --retry-log        Record every retried request to this file as JSON lines")
+	fmt.Println("  --stats            Print API calls, retries, cache hits and wall time to stderr after the run")
+	fmt.Println("  --workers-stats    Alias for --stats")
+	fmt.Println("  --workers          Number of repositories to process concurrently (default 10)")
+	fmt.Println("  --concurrency      Alias for --workers")
+	fmt.Println("  --max-inflight     Maximum concurrent HTTP requests across all workers (default: same as --workers)")
+	fmt.Println("  --validate         Check the credentials and workspace with a single request, then exit")
+	fmt.Println("  --save-credentials  Store the credentials in use in the OS keychain for later runs")
+	fmt.Println("  --keyring-service  OS keychain service name for stored credentials (default bhunter)")
+	fmt.Println("  --proxy            Proxy URL for all requests, e.g. http://proxy:3128 (default: HTTP_PROXY/HTTPS_PROXY; NO_PROXY always applies)")
+	fmt.Println("  --timeout          Timeout for each whole request, including downloading the response (default 2m)")
+	fmt.Println("  --dial-timeout     Timeout for establishing a connection (default 10s)")
+	fmt.Println("  --tls-handshake-timeout  Timeout for the TLS handshake (default 10s)")
+	fmt.Println("  --response-header-timeout  Timeout for receiving response headers once a request is sent (default 10s)")
+	fmt.Println("  --connect-timeout  Shorthand setting the dial, TLS handshake and response header timeouts")
+	fmt.Println("  --fetch-timeout    Alias for --timeout")
+	fmt.Println("  --cache-ttl        Reuse API responses cached on disk for this long, e.g. 1h (default off)")
+	fmt.Println("  --no-cache         Bypass the response cache for this run")
+	fmt.Println("  --clear-cache      Delete all cached API responses and exit")
+	fmt.Println("  --rate-limit       Maximum requests per second across all workers (default: no cap)")
+	fmt.Println("  --retry-on         Conditions that trigger retries: network, 5xx, 429, none (default: network,5xx,429)")
+	fmt.Println("  --role             Only list repositories where you have this role (owner, admin, contributor, member)")
+	fmt.Println("  --repos-modified-since  Only fetch repositories updated after this date (YYYY-MM-DD)")
+	fmt.Println("  --created-after    Only repositories created on or after this date (YYYY-MM-DD)")
+	fmt.Println("  --created-before   Only repositories created before this date (YYYY-MM-DD)")
+	fmt.Println("  --updated-after    Only repositories updated on or after this date (YYYY-MM-DD)")
+	fmt.Println("  --updated-before   Only repositories updated before this date (YYYY-MM-DD)")
+	fmt.Println("  --cursor-file      Save the repository listing's next-page URL to this file after each page")
+	fmt.Println("  --continue-from    Resume repository listing from a cursor file (keeps updating it)")
+	fmt.Println("  --max-repo-pages   Stop listing repositories after this many pages (use with a cursor file)")
+	fmt.Println("  --page-len         Results per page of repository and branch listings, 1-100 (default 100)")
+	fmt.Println("  --max-repos        Stop listing repositories after this many (default: no limit)")
+	fmt.Println("  --max-branches     Stop listing each repository's branches after this many (default: no limit)")
+	fmt.Println("  --description-contains  Comma-separated keywords matched against repository descriptions")
+	fmt.Println("  --filter           Only include repositories whose name matches this glob, e.g. svc-* (repeatable)")
+	fmt.Println("  --filter-exclude   Exclude repositories whose name matches this glob (repeatable)")
+	fmt.Println("  --owner            Only include repositories owned by this username, case-insensitive (repeatable)")
+	fmt.Println("  --regex            Interpret --filter and --filter-exclude patterns as regular expressions")
+	fmt.Println("  --description-regex     Regular expression matched against repository descriptions")
+	fmt.Println("  --min-commits      Only include repositories with at least this many commits")
+	fmt.Println("  --max-commits      Only include repositories with at most this many commits")
+	fmt.Println("  --min-stale-ratio  Only include repositories whose stale-branch fraction exceeds this (e.g. 0.5 or 50%)")
+	fmt.Println("  --only-empty-repos List only empty repositories (size 0 or no branches) as deletion candidates")
+	fmt.Println("  --hygiene          Report repositories missing a README or bitbucket-pipelines.yml on their default branch")
+	fmt.Println("  --commit-email-domains  Report the email domains of recent commits, flagging non-corporate ones")
+	fmt.Println("  --email-sample     Recent commits sampled per repository by --commit-email-domains (default 100)")
+	fmt.Println("  --corporate-domains  Comma-separated corporate email domains for --commit-email-domains")
+	fmt.Println("  --duplicate-branches  Report branch names that appear in more than this many repositories")
+	fmt.Println("  --exclude-archived Leave archived repositories out of the scan")
+	fmt.Println("  --repo-only        Show only repository information (no branch details)")
+	fmt.Println("  --branches-only    With --csv, output one row per branch without repository metadata")
+	fmt.Println("  --open             With -r, print the repository's web URL and open it in the default browser")
+	fmt.Println("  --commit-stats     Add total commits and the latest committer to CSV and JSON output (shown with --verbose)")
+	fmt.Println("  --tags             List tags with their commit dates and taggers in the display, CSV and summary")
+	fmt.Println("  --with-prs         Show open pull request counts per repository (extra request per repository)")
+	fmt.Println("  --check-merged     Mark branches already merged into the main branch (extra request per branch)")
+	fmt.Println("  --ahead-behind     Add each branch's commits ahead of and behind the main branch to CSV and JSON (extra requests per branch)")
+	fmt.Println("  --preview          With --output, explain each candidate branch (last push, age, reason) and print a total")
+	fmt.Println("  --interactive      With --output, ask keep/delete for each candidate branch and emit only the ones chosen")
+	fmt.Println("  --merged-only      With --output, emit only branches already merged into the main branch, whatever their age")
+	fmt.Println("  --safe-delete      Like --output, but emit only branches with no commits ahead of the main branch, whatever their age")
+	fmt.Println("  --merge-base       Show how long ago each stale branch diverged from the main branch")
+	fmt.Println("  --branch-creators  Show who created each branch in the full display (extra requests per branch)")
+	fmt.Println("  --hide-recent-branches  List only stale branches in the full display, noting how many were hidden")
+	fmt.Println("  --timeline         Show a per-repository sparkline of monthly commit counts (extra commit requests)")
+	fmt.Println("  --timeline-months  Months covered by --timeline (default 12)")
+	fmt.Println("  --no-color         Disable colored output and use ASCII for sparklines")
+	fmt.Println("  --sort             Order repositories by: name, created, updated, age (stalest first) or risk (highest first)")
+	fmt.Println("  --reverse          Reverse the --sort order")
+	fmt.Println("  --force-color      Keep colors even when stdout is not a terminal or NO_COLOR is set")
+	fmt.Println("  --group-by         Group the full display: creator or project (repositories under a header each, with subtotals)")
+	fmt.Println("  --group-by-project Same as --group-by project")
+	fmt.Println("  --no-creator       Skip the first-commit creator lookup (fastest with --repo-only)")
+	fmt.Println("  --creator-pages    Pages of commits (100 each) searched for a repository's or branch's first commit (default 20, 0 = no limit)")
+	fmt.Println("  --branch-age-months Months without a push after which a branch is old (default 6)")
+	fmt.Println("  --older-than       Age without a push after which a branch is old, e.g. 18mo, 2y, 90d (replaces --branch-age-months)")
+	fmt.Println("  --repo-age-months  Months without activity after which a repository is old (default 12)")
+	fmt.Println("  -o, --output       Output old branch names (see --branch-age-months) for piping to bkiller")
+	fmt.Println("  --output-template  Line format for --output (default {repo}:{branch}; also {repo_name}, {workspace}, \\t)")
+	fmt.Println("  --protect          Glob for branches never reported for deletion, e.g. 'release/*' (repeatable)")
+	fmt.Println("  --protect-branch-regex  Regex for branches never reported by --output (repeatable)")
+	fmt.Println("  --stale-grace-period  Don't flag branches created within this period (e.g. 14d; extra lookups)")
+	fmt.Println("  --csv              Output repository information in CSV format")
+	fmt.Println("  --out-file         Write CSV, JSON, JSON lines or Markdown output to this file instead of stdout")
+	fmt.Println("  --append           Append to --out-file instead of truncating it")
+	fmt.Println("  --post-url         POST the results as JSON (as with --json) to this URL after the scan")
+	fmt.Println("  --post-header      Header sent with --post-url, e.g. 'Authorization: Bearer token' (repeatable)")
+	fmt.Println("  --delimiter        CSV field separator: , ; or \\t (default ,)")
+	fmt.Println("  --summary          Show summary statistics (repos, branches, old branches)")
+	fmt.Println("  --exclude-default-branch     Leave default branches out of adjusted summary branch counts")
+	fmt.Println("  --exclude-protected-branches Leave protected branches out of adjusted summary branch counts")
+	fmt.Println("  --snapshot         Save a snapshot of all branches to this JSON file for later comparison")
+	fmt.Println("  --diff-authors     Compare two snapshots (old.json,new.json) by per-author stale branch counts")
+	fmt.Println("  --repo-age-buckets Month boundaries for the --summary --repo-only age histogram (default 6,12,24)")
+	fmt.Println("  --summary-creators Look up creators during --summary and break stale repositories down by creator")
+	fmt.Println("  --normalize-authors  Count names differing only in case or whitespace as one person in per-author stats")
+	fmt.Println("  --list             With --summary, list the stale repositories and branches behind the counts")
+	fmt.Println("  --trend-file       Append each --summary run's totals to this CSV file")
+	fmt.Println("  --summary-json     Shorthand for --summary --json: summary statistics as JSON on stdout")
+	fmt.Println("  --json             Output results as JSON (with --summary: statistics and recommendations)")
+	fmt.Println("  --jsonl            Stream results as JSON lines, one repository per line as soon as it is processed")
+	fmt.Println("  --json-lines       Alias for --jsonl")
+	fmt.Println("  --markdown         Output a Markdown report (repository table, old branches per repository) for wikis")
+	fmt.Println("  --html             Write a self-contained HTML report with color-coded staleness to this file")
+	fmt.Println("  --as-of            Compute all ages relative to this date (YYYY-MM-DD) instead of now")
+	fmt.Println("  --anonymize        Replace people's names with pseudonyms in all output")
+	fmt.Println("  --anonymize-seed   Seed for pseudonyms that stay the same across runs (implies --anonymize)")
+	fmt.Println("  --no-deprecation-warning  Don't warn about app password deprecation")
+	fmt.Println("  --fail-on-deprecated      Exit with an error when using an app password past its deprecation date")
+	fmt.Println("  --quiet            Don't print the scan progress counter to stderr")
+	fmt.Println("  --verbose          Print the HTTP request count and time for each repository to stderr")
+	fmt.Println("  --config-dir       Look for config files in this directory before the default locations")
+	fmt.Println("  --no-config-file   Never read config files; use only flags and environment variables (or set BHUNTER_NO_CONFIG=1)")
+	fmt.Println("  --config-file      Load configuration from this file instead of searching the default locations")
+	fmt.Println("  -c, --config       Create a sample bhunter.yaml in the current directory (doesn't load a file; see --config-file)")
+	fmt.Println("  -h, --help         Show this help message")
+	fmt.Println("  --version          Show version information (add --json for machine-readable output)")
+	fmt.Println("\nExamples:")
+	fmt.Println("  bhunter                                    # Analyze all repositories with branches")
+	fmt.Println("  bhunter --repo-only                        # Show only repository information")
+	fmt.Println("  bhunter --repo-only --no-creator --csv     # Fastest repository inventory (no branch or commit requests)")
+	fmt.Println("  bhunter --summary                          # Show summary statistics only")
+	fmt.Println("  bhunter --summary --repo-only              # Fast repository age histogram without branch requests")
+	fmt.Println("  bhunter -r BidvestDirect                   # Analyze only BidvestDirect repo")
+	fmt.Println("  bhunter -r BidvestDirect --repo-only       # Show only BidvestDirect repo info")
+	fmt.Println("  bhunter -r BidvestDirect --open            # Open BidvestDirect in the browser")
+	fmt.Println("  bhunter --output | bkiller                 # Find old branches and pipe to bkiller")
+	fmt.Println("  bhunter -r MyRepo -o | bkiller             # Find old branches in specific repo")
+	fmt.Println("  bhunter -o --output-template '{repo}\\t{branch}'  # Tab-separated repo and branch columns")
+	fmt.Println("  bhunter -e test,demo                       # Exclude repositories from projects 'test' or 'demo'")
+	fmt.Println("  bhunter --exclude old-project --summary    # Get summary excluding repositories from 'old-project'")
+	fmt.Println("  bhunter --include core,main --csv          # Analyze only repositories from 'core' and 'main' projects, output as CSV")
+	fmt.Println("  bhunter --max-commits 1 --repo-only        # Find repositories that never got past the initial commit")
+	fmt.Println("  bhunter --only-empty-repos --csv           # List empty repositories for archival")
+	fmt.Println("  bhunter --hygiene                          # Find repositories without a README or pipeline")
+	fmt.Println("  bhunter --duplicate-branches 5             # Branch names copied into more than 5 repositories")
+	fmt.Println("  bhunter --commit-email-domains --corporate-domains example.com  # Spot commits from outside emails")
+	fmt.Println("\nConfiguration File:")
+	fmt.Println("  The program will automatically look for config files in this order:")
+	fmt.Println("  1. ./bhunter.local.yaml or ./bhunter.local.yml (local overrides)")
+	fmt.Println("  2. ./bhunter.yaml or ./bhunter.yml (standard config)")
+	fmt.Println("  3. ./.bhunter.local.yaml or ./.bhunter.local.yml (hidden local)")
+	fmt.Println("  4. ./.bhunter.yaml or ./.bhunter.yml (hidden config)")
+	fmt.Println("  5. ~/bhunter.local.yaml or ~/bhunter.local.yml (user local)")
+	fmt.Println("  6. ~/bhunter.yaml or ~/bhunter.yml (user config)")
+	fmt.Println("  7. ~/.bhunter.local.yaml or ~/.bhunter.local.yml (hidden user local)")
+	fmt.Println("  8. ~/.bhunter.yaml or ~/.bhunter.yml (hidden user config)")
+	fmt.Println("  9. The same names in $XDG_CONFIG_HOME/bhunter/ (default ~/.config/bhunter/)")
+	fmt.Println("  10. The same names in /etc/bhunter/")
+	fmt.Println("  A --config-dir directory is searched first, with the same names.")
+	fmt.Println("  --config-file loads exactly the given file and skips the search.")
+	fmt.Println("  --no-config-file (or BHUNTER_NO_CONFIG=1) skips the search entirely.")
+	fmt.Println("\nExample config file (bhunter.yaml):")
+	fmt.Println("  username: your_username")
+	fmt.Println("  app_password: your_app_password")
+	fmt.Println("  access_token: your_token   # Optional, OAuth 2.0 token used instead of the app password")
+	fmt.Println("  base_url: https://bitbucket.example.com  # Optional, for Bitbucket Data Center")
+	fmt.Println("  provider: github        # Optional, bitbucket (default), github or gitlab")
+	fmt.Println("  proxy: http://proxy.example.com:3128  # Optional, defaults to HTTP_PROXY/HTTPS_PROXY")
+	fmt.Println("  keyring_service: bhunter  # Optional, OS keychain service holding the credentials")
+	fmt.Println("  workspace: your_workspace")
+	fmt.Println("  retry_on: network,429   # Optional, defaults to network,5xx,429")
+	fmt.Println("  max_retries: 5          # Optional, defaults to 3")
+	fmt.Println("  retry_base_delay: 2s    # Optional, defaults to 1s")
+	fmt.Println("  name_map:               # Optional friendly names for human-readable output")
+	fmt.Println("    my-workspace/svc-x7: Billing Service")
+	fmt.Println("  corporate_domains: [example.com]  # Optional, for --commit-email-domains")
+	fmt.Println("  protected_branches: [release/*, production]  # Optional, never reported for deletion")
+	fmt.Println("  author_aliases:         # Optional, merges spellings of a name in per-author stats")
+	fmt.Println("    jsmith: John Smith")
+	fmt.Println("\nGet app password at: https://bitbucket.org/account/settings/app-passwords/")
+}
+
+// defaultOutputTemplate is the bkiller-compatible pipe output format
+const defaultOutputTemplate = "{repo}:{branch}"
+
+// formatOutputLine expands an --output-template for a single branch. Supported
+// placeholders are {repo} (full name), {repo_name}, {workspace} and {branch};
+// the escape sequence \t is expanded to a tab.
+func formatOutputLine(template string, repo Repository, branch Branch) string {
+	workspace := repo.FullName
+	if i := strings.Index(workspace, "/"); i >= 0 {
+		workspace = workspace[:i]
+	}
+	replacer := strings.NewReplacer(
+		"{repo}", repo.FullName,
+		"{repo_name}", repo.Name,
+		"{workspace}", workspace,
+		"{branch}", branch.Name,
+		"\\t", "\t",
+	)
+	return replacer.Replace(template)
+}
+
+// defaultProtectedBranches are never reported as deletion candidates
+var defaultProtectedBranches = []string{"main", "master", "develop"}
+
+// branchProtection decides which branches must never be reported as deletion
+// candidates. A branch is protected if it matches any of the rules.
+type branchProtection struct {
+	names   []string
+	regexes []*regexp.Regexp
+}
+
+// newBranchProtection builds the protection rules, compiling each regex
+func newBranchProtection(names []string, patterns []string) (*branchProtection, error) {
+	protection := &branchProtection{names: names}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --protect-branch-regex %q: %w", pattern, err)
+		}
+		protection.regexes = append(protection.regexes, re)
+	}
+	return protection, nil
+}
+
+// addGlobs protects branches matching any of the glob patterns (* and ?
+// wildcards, as in --protect and protected_branches)
+func (p *branchProtection) addGlobs(globs []string) {
+	for _, glob := range globs {
+		p.regexes = append(p.regexes, regexp.MustCompile(globToRegexp(glob)))
+	}
+}
+
+// isProtected reports whether a branch name matches any protection rule
+func (p *branchProtection) isProtected(branchName string) bool {
+	for _, name := range p.names {
+		if branchName == name {
+			return true
+		}
+	}
+	for _, re := range p.regexes {
+		if re.MatchString(branchName) {
+			return true
+		}
+	}
+	return false
+}
+
+// stringListFlag is a repeatable command line flag
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// openInBrowser launches a URL in the OS default browser. It returns an error
+// on headless systems or when no browser launcher is available.
+func openInBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return fmt.Errorf("no graphical display available")
+		}
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
+
+// branchCandidate is a branch selected for deletion, with the reason why
+type branchCandidate struct {
+	repo   Repository
+	branch Branch
+	reason string
+}
+
+// candidateSelection chooses which branches --output emits
+type candidateSelection int
+
+const (
+	selectStale    candidateSelection = iota // past the age threshold
+	selectMerged                             // merged into the main branch (--merged-only)
+	selectNotAhead                           // no commits ahead of the main branch (--safe-delete)
+)
+
+// oldBranchCandidates returns the deletion candidates of a repository:
+// unprotected branches past the age threshold or, depending on selection,
+// already merged into the main branch or without commits ahead of it. Branch
+// fetch errors yield no candidates.
+func oldBranchCandidates(ctx context.Context, repo Repository, client *BitbucketClient, protection *branchProtection, policy *stalePolicy, selection candidateSelection) []branchCandidate {
+	branches, err := client.getBranches(ctx, repo.FullName)
+	if err != nil {
+		// Don't output errors when in pipe mode
+		return nil
+	}
+	switch selection {
+	case selectMerged:
+		branches = client.markMerged(ctx, repo, branches)
+	case selectNotAhead:
+		branches = client.markNotAhead(ctx, repo, branches)
+	}
+
+	var candidates []branchCandidate
+	for _, branch := range branches {
+		// Skip protected branches (main/master/develop plus any configured rules)
+		if protection.isProtected(branch.Name) {
+			continue
+		}
+
+		// Merged branches, and ones with nothing the main branch lacks, are
+		// safe to delete whatever their age; the main branch itself never is
+		reason := ""
+		switch selection {
+		case selectMerged:
+			if branch.Merged != nil && *branch.Merged {
+				reason = "merged into " + repo.MainBranch.Name
+			}
+		case selectNotAhead:
+			if branch.Name != repo.MainBranch.Name && branch.Ahead != nil && *branch.Ahead == 0 {
+				reason = "no commits ahead of " + repo.MainBranch.Name
+			}
+		default:
+			if policy.isStale(ctx, repo, branch) {
+				reason = fmt.Sprintf("no push for more than %s", policy.branchAge)
+			}
+		}
+		if reason != "" {
+			candidates = append(candidates, branchCandidate{repo: repo, branch: branch, reason: reason})
+		}
+	}
+	return candidates
+}
+
+// branchAgeLabel describes how old a branch's last push is
+func branchAgeLabel(branch Branch) string {
+	if branch.Target.Date.IsZero() {
+		return "age unknown"
+	}
+	return fmt.Sprintf("%d months old", calculateMonthsDifference(branch.Target.Date, asOf))
+}
+
+// outputOldBranches prints the deletion candidates of a repository, one
+// formatted line each, and returns how many there were. With preview each
+// line also explains why the branch was selected.
+func outputOldBranches(ctx context.Context, repo Repository, client *BitbucketClient, template string, protection *branchProtection, policy *stalePolicy, selection candidateSelection, preview bool) int {
+	candidates := oldBranchCandidates(ctx, repo, client, protection, policy, selection)
+	for _, candidate := range candidates {
+		line := formatOutputLine(template, repo, candidate.branch)
+		if preview {
+			fmt.Printf("%s  last pushed %s by %s (%s): %s\n", line, formatDate(candidate.branch.Target.Date),
+				candidate.branch.AuthorName(), branchAgeLabel(candidate.branch), candidate.reason)
+		} else {
+			fmt.Println(line)
+		}
+	}
+	return len(candidates)
+}
+
+// displayOptions controls what displayRepositoryInfo shows
+type displayOptions struct {
+	repoOnly     bool              // skip branch details
+	mergeBase    bool              // show when each stale branch diverged from the main branch
+	checkMerged  bool              // mark branches already merged into the main branch
+	protection   *branchProtection // merged branches matching these are never called safe to delete
+	withPRs      bool              // show the open pull request count
+	commitStats  bool              // show total commits and the latest committer (--commit-stats with --verbose)
+	tags         bool              // list tags with their commit dates and taggers
+	hideRecent   bool              // list only stale branches, noting how many recent ones were hidden
+	timeline     int               // months of commit activity to show as a sparkline (0 = off)
+	ascii        bool              // ASCII sparkline instead of block characters
+	sortBranches bool              // list branches stalest first (with --sort)
+	riskScore    bool              // show the inactivity risk score (--verbose)
+	creators     bool              // show who created each branch (--branch-creators)
+}
+
+func displayRepositoryInfo(ctx context.Context, result RepositoryResult, client *BitbucketClient, policy *stalePolicy, yellow, red, bold, green, cyan func(a ...interface{}) string, opts displayOptions) {
+	repo := result.Repository
+	creator := result.creatorLabel()
+	if repo.RenamedFrom != "" {
+		fmt.Printf("\n%s %s\n", green("Repository: "+repo.DisplayName()), yellow("(renamed from "+repo.RenamedFrom+")"))
+	} else {
+		fmt.Printf("\n%s\n", green("Repository: "+repo.DisplayName()))
+	}
+	fmt.Printf("  Name: %s\n", repo.Name)
+	if len(client.workspaces) > 1 {
+		fmt.Printf("  Workspace: %s\n", repo.Workspace)
+	}
+	fmt.Printf("  Owner: %s (%s)\n", repo.Owner.DisplayName, repo.Owner.Username)
+	fmt.Printf("  Creator: %s\n", creator)
+
+	// Display project information if available
+	if repo.Project.Key != "" || repo.Project.Name != "" {
+		if repo.Project.Key != "" && repo.Project.Name != "" {
+			fmt.Printf("  Project: %s (%s)\n", repo.Project.Name, repo.Project.Key)
+		} else if repo.Project.Key != "" {
+			fmt.Printf("  Project: %s\n", repo.Project.Key)
+		} else {
+			fmt.Printf("  Project: %s\n", repo.Project.Name)
+		}
+	} else {
+		fmt.Printf("  Project: (not assigned to any project)\n")
+	}
+
+	fmt.Printf("  Date Created: %s\n", formatDate(repo.CreatedOn))
+
+	lastAccessed := formatDate(repo.UpdatedOn)
+	if policy.isOldRepo(repo) {
+		lastAccessed = yellow(lastAccessed)
+	}
+	fmt.Printf("  Date Last Accessed: %s\n", lastAccessed)
+	fmt.Printf("  Main Branch: %s\n", repo.MainBranch.Name)
+	fmt.Printf("  Size: %s\n", formatSize(repo.Size))
+	if repo.Language != "" {
+		fmt.Printf("  Language: %s\n", repo.Language)
+	}
+	if opts.commitStats {
+		if stats := lookupCommitStats(ctx, repo, client); stats.err != nil {
+			fmt.Printf("  Total Commits: (unable to determine)\n")
+		} else {
+			fmt.Printf("  Total Commits: %s\n", stats.totalText())
+			if stats.lastAuthor != "" {
+				fmt.Printf("  Last Commit Author: %s\n", stats.lastAuthor)
+			}
+		}
+	}
+	if opts.withPRs {
+		count, err := client.getOpenPullRequestCount(ctx, repo.FullName)
+		if err != nil {
+			fmt.Printf("  Open Pull Requests: (unable to determine)\n")
+		} else if count > 0 {
+			fmt.Printf("  Open Pull Requests: %s\n", cyan(count))
+		} else {
+			fmt.Printf("  Open Pull Requests: 0\n")
+		}
+	}
+	if opts.timeline > 0 {
+		counts, err := client.getMonthlyCommitCounts(ctx, repo.FullName, opts.timeline)
+		if err != nil {
+			fmt.Printf("  Activity (%d months): (unable to determine)\n", opts.timeline)
+		} else {
+			total := 0
+			for _, count := range counts {
+				total += count
+			}
+			fmt.Printf("  Activity (%d months): %s (%d commits)\n", opts.timeline, cyan(sparkline(counts, opts.ascii)), total)
+		}
+	}
+	if opts.riskScore && !opts.repoOnly {
+		if score, err := policy.riskScore(ctx, repo); err != nil {
+			fmt.Printf("  Risk Score: (unable to determine)\n")
+		} else {
+			fmt.Printf("  Risk Score: %s\n", red(score))
+		}
+	}
+	if repo.BranchStats != nil {
+		fmt.Printf("  Stale Branch Ratio: %s (%d of %d branches)\n",
+			red(fmt.Sprintf("%.0f%%", repo.BranchStats.StaleRatio()*100)), repo.BranchStats.Stale, repo.BranchStats.Total)
+	}
+
+	if opts.tags {
+		displayTags(ctx, repo, client, cyan)
+	}
+
+	// Skip branch details if repo-only flag is set
+	if opts.repoOnly {
+		return
+	}
+
+	fmt.Println("\n  Branches:")
+	branches, err := result.branches(ctx, client)
+	if err != nil {
+		fmt.Printf("    Error fetching branches: %v\n", err)
+		return
+	}
+	if opts.sortBranches {
+		branches = sortBranchesByPush(branches)
+	}
+	if opts.checkMerged {
+		branches = client.markMerged(ctx, repo, branches)
+	}
+	if opts.creators {
+		branches = client.markCreators(ctx, repo, branches)
+	}
+
+	// The main branch's tip is needed for merge-base lookups; it's in the branch list already
+	mainHash := ""
+	for _, branch := range branches {
+		if branch.Name == repo.MainBranch.Name {
+			mainHash = branch.Target.Hash
+		}
+	}
+
+	hiddenRecent := 0
+	for _, branch := range branches {
+		if opts.hideRecent && !policy.isStale(ctx, repo, branch) {
+			hiddenRecent++
+			continue
+		}
+		fmt.Printf("    %s\n", cyan("Branch: "+branch.Name))
+		fmt.Printf("      Name: %s\n", branch.Name)
+		fmt.Printf("      Date Created: %s\n", formatDate(branch.Target.Date))
+
+		lastPush := formatDate(branch.Target.Date)
+		if policy.isStale(ctx, repo, branch) {
+			lastPush = red(lastPush)
+		}
+		fmt.Printf("      Date Last Pushed: %s\n", lastPush)
+		fmt.Printf("      Last Pushed By: %s\n", branch.AuthorName())
+		if opts.creators {
+			// The main branch was created with the repository
+			createdBy := branch.Creator
+			if branch.Name == repo.MainBranch.Name {
+				createdBy = creator
+			} else if createdBy == "" {
+				createdBy = "(unknown)"
+			}
+			fmt.Printf("      Created By: %s\n", createdBy)
+		}
+		if branch.Merged != nil {
+			if *branch.Merged {
+				if opts.protection.isProtected(branch.Name) {
+					fmt.Printf("      Merged: yes (protected)\n")
+				} else {
+					fmt.Printf("      Merged: %s\n", green("yes (safe to delete)"))
+				}
+			} else {
+				fmt.Printf("      Merged: no\n")
+			}
+		}
+
+		if opts.mergeBase && branch.Name != repo.MainBranch.Name && mainHash != "" && policy.isStale(ctx, repo, branch) {
+			base, err := client.getMergeBase(ctx, repo.FullName, branch.Target.Hash, mainHash)
+			if err != nil {
+				fmt.Printf("      Diverged: (unable to determine)\n")
+			} else {
+				months := calculateMonthsDifference(base.Date, asOf)
+				fmt.Printf("      Diverged: %s (%s)\n", red(fmt.Sprintf("%d months ago", months)), formatDate(base.Date))
+			}
+		}
+	}
+	if hiddenRecent > 0 {
+		fmt.Printf("    (%d recent branches hidden)\n", hiddenRecent)
+	}
+}
+
+// RepositoryResult holds a repository and its processing result
+type RepositoryResult struct {
+	Repository Repository
+	Creator    string
+	// CreatorSource tells where Creator came from: creatorSourceFirstCommit or
+	// creatorSourceOwnerFallback, or empty when it wasn't determined
+	CreatorSource string
+	Error         error // creator lookup failure, also recorded in the client's failure log
+	// Branches are the repository's branches when they were listed with the
+	// result (fetchBranches), and BranchError the listing failure
+	Branches        []Branch
+	BranchError     error
+	branchesFetched bool
+}
+
+// Sources of a repository's creator
+const (
+	creatorSourceFirstCommit   = "first-commit"   // author of the repository's first commit
+	creatorSourceOwnerFallback = "owner-fallback" // repository owner, when no first commit was found
+)
+
+// creatorLabel is the creator for human-readable output, marking an owner
+// fallback so it isn't mistaken for a first-commit author
+func (r RepositoryResult) creatorLabel() string {
+	if r.CreatorSource == creatorSourceOwnerFallback {
+		return r.Creator + " (repository owner)"
+	}
+	return r.Creator
+}
+
+// branches returns the branches listed with the result, or lists them now
+// when the result was built without them
+func (r RepositoryResult) branches(ctx context.Context, client *BitbucketClient) ([]Branch, error) {
+	if r.branchesFetched {
+		return r.Branches, r.BranchError
+	}
+	return client.getBranches(ctx, r.Repository.FullName)
+}
+
+// creatorNotResolved is reported as the creator when the lookup was skipped with --no-creator
+const creatorNotResolved = "(not resolved)"
+
+// unresolvedCreatorResults wraps repositories in results without looking up
+// their creators, for the fastest possible repository inventory
+func unresolvedCreatorResults(repos []Repository) []RepositoryResult {
+	results := make([]RepositoryResult, len(repos))
+	for i, repo := range repos {
+		results[i] = RepositoryResult{Repository: repo, Creator: creatorNotResolved}
+	}
+	return results
+}
+
+// processRepositoryConcurrently processes a single repository: the creator
+// lookup, and with fetchBranches its branch listing, which is cached by the
+// client so the summary, CSV and display loops don't fetch it serially
+func processRepositoryConcurrently(ctx context.Context, repo Repository, client *BitbucketClient, resolveCreator, fetchBranches bool) RepositoryResult {
+	result := RepositoryResult{Repository: repo, Creator: creatorNotResolved}
+
+	if resolveCreator {
+		// Try to get the actual creator from the first commit
+		result.Creator = "(unable to determine)"
+		firstCommit, err := client.getFirstCommit(ctx, repo.FullName)
+		noFirstCommit := errors.Is(err, errNoCommits) || errors.Is(err, errHistoryTooLong)
+		if err == nil && commitAuthorName(firstCommit) != "" {
+			result.Creator = commitAuthorName(firstCommit)
+			result.CreatorSource = creatorSourceFirstCommit
+		} else if (err == nil || noFirstCommit) && repo.Owner.DisplayName != "" {
+			// Empty and imported repositories often have no usable first
+			// commit; the owner keeps the creator column populated. A failed
+			// lookup leaves the creator undetermined instead, so an outage
+			// isn't reported as the owner.
+			result.Creator = repo.Owner.DisplayName
+			result.CreatorSource = creatorSourceOwnerFallback
+		}
+		if err != nil && !noFirstCommit {
+			client.failures.record(repo.FullName, "creator lookup", err)
+		}
+		result.Error = err
+	}
+	if fetchBranches {
+		result.Branches, result.BranchError = client.getBranches(ctx, repo.FullName)
+		result.branchesFetched = true
+	}
+
+	return result
+}
+
+// forEachIndex calls fn for every index from 0 to n-1 on a pool of at most
+// workers goroutines, and returns once all calls are done. Indexes are handed
+// out in order; once ctx is cancelled the remaining ones are skipped.
+func forEachIndex(ctx context.Context, n, workers int, fn func(i int)) {
+	workers = max(1, min(workers, n))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n && ctx.Err() == nil; i++ {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+}
+
+// forEachRepo calls fn for every repository and its index, at most workers
+// at a time. Callers that keep per-repository results store them by index, so
+// the output order doesn't depend on which worker finishes first.
+func forEachRepo(ctx context.Context, repos []Repository, workers int, fn func(i int, repo Repository)) {
+	forEachIndex(ctx, len(repos), workers, func(i int) {
+		fn(i, repos[i])
+	})
+}
+
+// indexedResult is a RepositoryResult tagged with the position of its repository
+type indexedResult struct {
+	index  int
+	result RepositoryResult
+}
+
+// processRepositoriesConcurrently processes repositories with controlled
+// concurrency. Results are returned in the order of repos, however the
+// workers finish, so output built from them stays stable between runs. A
+// progress counter is written to progress as results arrive, unless it is nil.
+func processRepositoriesConcurrently(ctx context.Context, repos []Repository, client *BitbucketClient, maxConcurrency int, resolveCreators, fetchBranches bool, progress io.Writer) []RepositoryResult {
+	results := make(chan indexedResult, len(repos))
+
+	// Close results channel when all workers are done
+	go func() {
+		forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+			results <- indexedResult{i, processRepositoryConcurrently(ctx, r, client, resolveCreators, fetchBranches)}
+		})
+		close(results)
+	}()
+
+	// Collect results
+	repoResults := make([]RepositoryResult, len(repos))
+	processed := 0
+	for indexed := range results {
+		repoResults[indexed.index] = indexed.result
+		processed++
+		if progress != nil {
+			fmt.Fprintf(progress, "\rProcessed %d/%d repositories", processed, len(repos))
+		}
+	}
+	if progress != nil && processed > 0 {
+		fmt.Fprintln(progress)
+	}
+
+	return repoResults
+}
+
+// csvDelimiter separates CSV output fields; set by --delimiter
+var csvDelimiter = ','
+
+// csvAppending is set when --append adds to a non-empty --out-file, which
+// already starts with the header written by an earlier run
+var csvAppending bool
+
+// writeCSVRow writes one CSV record to w, flushing it so rows stream as they
+// are produced. It returns the write error, so a full disk or closed pipe
+// doesn't leave a truncated CSV behind a successful exit.
+func writeCSVRow(w io.Writer, fields ...string) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = csvDelimiter
+	writer.Write(fields)
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeCSVHeader writes the CSV header row, unless appending to a file that
+// already has one
+func writeCSVHeader(w io.Writer, fields ...string) error {
+	if csvAppending {
+		return nil
+	}
+	return writeCSVRow(w, fields...)
+}
+
+// exitOnCSVError exits when CSV output couldn't be written
+func exitOnCSVError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing CSV: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+}
+
+// exitOnMarkdownError exits if writing the Markdown report failed
+func exitOnMarkdownError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing Markdown: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+}
+
+// exitOnSummaryError exits if the summary statistics couldn't be calculated
+// because no repository's branches could be listed, with the exit code of
+// the API failure
+func exitOnSummaryError(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error calculating summary statistics: %v\n", err)
+		os.Exit(exitCodeForError(err))
+	}
+}
+
+// parseDelimiter validates a --delimiter value. The escape sequence \t stands
+// for a tab.
+func parseDelimiter(value string) (rune, error) {
+	if value == "\\t" {
+		value = "\t"
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("invalid delimiter %q (must be a single character such as , ; or \\t)", value)
+	}
+	delimiter, _ := utf8.DecodeRuneInString(value)
+	if delimiter == '"' || delimiter == '\r' || delimiter == '\n' || delimiter == utf8.RuneError {
+		return 0, fmt.Errorf("invalid delimiter %q", value)
+	}
+	return delimiter, nil
+}
+
+// resultGroup is the repositories sharing a creator or a project, for
+// --group-by
+type resultGroup struct {
+	Name    string
+	Results []RepositoryResult
+}
+
+// groupResults buckets results by the name key gives each of them, sorted by
+// name. Each group keeps the results' original order.
+func groupResults(results []RepositoryResult, key func(RepositoryResult) string) []resultGroup {
+	var groups []resultGroup
+	index := make(map[string]int)
+	for _, result := range results {
+		name := key(result)
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, resultGroup{Name: name})
+		}
+		groups[i].Results = append(groups[i].Results, result)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i].Name) < strings.ToLower(groups[j].Name)
+	})
+	return groups
+}
+
+// groupByCreator buckets results by creator, for --group-by creator
+func groupByCreator(results []RepositoryResult, normalizer *authorNormalizer) []resultGroup {
+	return groupResults(results, func(result RepositoryResult) string {
+		return normalizer.canonical(result.Creator)
+	})
+}
+
+// groupByProject buckets results by project, for --group-by project.
+// Repositories outside any project (GitHub has none) share a "(no project)"
+// group.
+func groupByProject(results []RepositoryResult) []resultGroup {
+	return groupResults(results, func(result RepositoryResult) string {
+		return projectLabel(result.Repository)
+	})
+}
+
+// projectLabel names a repository's project as "Name (KEY)", or "(no project)"
+func projectLabel(repo Repository) string {
+	switch {
+	case repo.Project.Key == "" && repo.Project.Name == "":
+		return "(no project)"
+	case repo.Project.Name == "" || repo.Project.Name == repo.Project.Key:
+		return repo.Project.Key
+	case repo.Project.Key == "":
+		return repo.Project.Name
+	}
+	return fmt.Sprintf("%s (%s)", repo.Project.Name, repo.Project.Key)
+}
+
+// displayResultGroups prints each group's repositories under a header, with
+// kind ("Creator" or "Project") and subtotals of repositories and stale
+// branches
+func displayResultGroups(ctx context.Context, kind string, groups []resultGroup, client *BitbucketClient, policy *stalePolicy, opts displayOptions, verbose bool, yellow, red, bold, green, cyan func(a ...interface{}) string) {
+	for _, group := range groups {
+		staleBranches := 0
+		for _, result := range group.Results {
+			branches, err := result.branches(ctx, client)
+			if err != nil {
+				continue
+			}
+			for _, branch := range branches {
+				if policy.isStale(ctx, result.Repository, branch) {
+					staleBranches++
+				}
+			}
+		}
+
+		fmt.Printf("\n%s\n", bold(fmt.Sprintf("=== %s: %s (%d repositories, %d stale branches) ===", kind, group.Name, len(group.Results), staleBranches)))
+		for _, result := range group.Results {
+			displayRepositoryInfo(ctx, result, client, policy, yellow, red, bold, green, cyan, opts)
+			if verbose {
+				printRepoCost(client, result.Repository)
+			}
+		}
+	}
+}
+
+// csvColumns selects the optional trailing columns of the repository CSV
+type csvColumns struct {
+	displayName bool // name_map alias alongside the real repository name
+	workspace   bool // source workspace, when several are scanned
+	openPRs     bool // open pull request count (--with-prs)
+	commitStats bool // total commits and latest committer (--commit-stats)
+	tags        bool // tag rows, told apart from branch rows by a Ref Type column (--tags)
+	aheadBehind bool // commits ahead of and behind the main branch (--ahead-behind)
+	truncated   bool // whether the branch list stopped at --max-branches
+}
+
+// outputCSVHeader prints the CSV header, followed by the selected optional columns
+func outputCSVHeader(w io.Writer, columns csvColumns) error {
+	header := []string{"Repository Name", "Owner", "Creator", "Date Created", "Date Last Accessed", "Main Branch", "Repo Age (months)", "Last Access (months)", "Branch Name", "Branch Date Created", "Branch Last Pushed", "Branch Last Pushed By", "Branch Age (months)", "Archived", "Size (MB)", "Language", "Creator Source", "Risk Score", "Project Key", "Project Name"}
+	if columns.displayName {
+		header = append(header, "Display Name")
+	}
+	if columns.workspace {
+		header = append(header, "Workspace")
+	}
+	if columns.openPRs {
+		header = append(header, "Open Pull Requests")
+	}
+	if columns.commitStats {
+		header = append(header, "Total Commits", "Last Commit Author")
+	}
+	if columns.tags {
+		header = append(header, "Ref Type")
+	}
+	if columns.aheadBehind {
+		header = append(header, "Commits Ahead", "Commits Behind")
+	}
+	if columns.truncated {
+		header = append(header, "Branches Truncated")
+	}
+	return writeCSVHeader(w, header...)
+}
+
+// dateColumns formats a date and its age in months for CSV and Markdown
+// tables, leaving both empty when the date is unknown
+func dateColumns(date time.Time) (string, string) {
+	if date.IsZero() {
+		return "", ""
+	}
+	return date.Format("2006-01-02"), strconv.Itoa(calculateMonthsDifference(date, asOf))
+}
+
+// outputRepositoryCSV outputs repository information in CSV format, returning
+// the first write error
+func outputRepositoryCSV(ctx context.Context, w io.Writer, result RepositoryResult, client *BitbucketClient, policy *stalePolicy, repoOnly bool, columns csvColumns) error {
+	repo := result.Repository
+	created, repoAge := dateColumns(repo.CreatedOn)
+	updated, lastAccessAge := dateColumns(repo.UpdatedOn)
+	// The risk score needs the branches, so repository-only rows leave it empty
+	risk := ""
+	if !repoOnly {
+		if score, err := policy.riskScore(ctx, repo); err == nil {
+			risk = strconv.Itoa(score)
+		}
+	}
+	openPRs := ""
+	if columns.openPRs {
+		if count, err := client.getOpenPullRequestCount(ctx, repo.FullName); err == nil {
+			openPRs = strconv.Itoa(count)
+		}
+	}
+	totalCommits, lastAuthor := "", ""
+	if columns.commitStats {
+		if stats := lookupCommitStats(ctx, repo, client); stats.err == nil {
+			totalCommits, lastAuthor = stats.totalText(), stats.lastAuthor
+		}
+	}
+
+	// Known only once the branches are listed, so empty with --repo-only
+	truncated := ""
+	if columns.truncated && !repoOnly {
+		if _, err := result.branches(ctx, client); err == nil {
+			truncated = strconv.FormatBool(client.branchesTruncated(repo.FullName))
+		}
+	}
+
+	// Repository columns shared by every row, followed by the branch columns.
+	// Tag rows reuse the branch columns for the tag name, commit date and tagger.
+	// Rows after a failed write are skipped.
+	var writeErr error
+	row := func(branchName, branchDate, lastPushedBy, branchAge, refType, ahead, behind string) {
+		if writeErr != nil {
+			return
+		}
+		fields := []string{
+			repo.Name,
+			repo.Owner.DisplayName,
+			result.Creator,
+			created,
+			updated,
+			repo.MainBranch.Name,
+			repoAge,
+			lastAccessAge,
+			branchName,
+			branchDate,
+			branchDate,
+			lastPushedBy,
+			branchAge,
+			strconv.FormatBool(repo.Archived),
+			sizeMB(repo.Size),
+			repo.Language,
+			result.CreatorSource,
+			risk,
+			repo.Project.Key,
+			repo.Project.Name,
+		}
+		// Optional trailing columns
+		if columns.displayName {
+			fields = append(fields, repo.DisplayName())
+		}
+		if columns.workspace {
+			fields = append(fields, repo.Workspace)
+		}
+		if columns.openPRs {
+			fields = append(fields, openPRs)
+		}
+		if columns.commitStats {
+			fields = append(fields, totalCommits, lastAuthor)
+		}
+		if columns.tags {
+			fields = append(fields, refType)
+		}
+		if columns.aheadBehind {
+			fields = append(fields, ahead, behind)
+		}
+		if columns.truncated {
+			fields = append(fields, truncated)
+		}
+		writeErr = writeCSVRow(w, fields...)
+	}
+	if repoOnly {
+		// Repository-only mode: output single row without branch details
+		row("", "", "", "", "", "", "")
+	} else if branches, err := result.branches(ctx, client); err != nil {
+		// Output repository row with error indication
+		row("ERROR: "+err.Error(), "", "", "", "branch", "", "")
+	} else {
+		if columns.aheadBehind {
+			branches = client.markAheadBehind(ctx, repo, branches)
+		}
+		for _, branch := range branches {
+			branchDate, branchAge := dateColumns(branch.Target.Date)
+			ahead, behind := aheadBehindColumns(branch)
+			row(branch.Name, branchDate, branch.AuthorName(), branchAge, "branch", ahead, behind)
+		}
+	}
+
+	if columns.tags {
+		tags, err := client.getTags(ctx, repo.FullName)
+		if err != nil {
+			row("ERROR: "+err.Error(), "", "", "", "tag", "", "")
+			return writeErr
+		}
+		for _, tag := range tags {
+			tagDate, tagAge := dateColumns(tag.Target.Date)
+			row(tag.Name, tagDate, tag.TaggerName(), tagAge, "tag", "", "")
+		}
+	}
+	return writeErr
+}
+
+// outputBranchesCSVHeader prints the CSV header for --branches-only mode
+func outputBranchesCSVHeader(w io.Writer, withMerged, withAheadBehind bool) error {
+	header := []string{"Repository", "Branch Name", "Branch Last Pushed", "Branch Last Pushed By", "Branch Age (months)", "Stale"}
+	if withMerged {
+		header = append(header, "Merged")
+	}
+	if withAheadBehind {
+		header = append(header, "Commits Ahead", "Commits Behind")
+	}
+	return writeCSVHeader(w, header...)
+}
+
+// outputBranchesCSV outputs one row per branch with only a repository reference
+// column, omitting the repository-level metadata repeated by outputRepositoryCSV.
+// withMerged adds a Merged column, empty when the status couldn't be determined,
+// and withAheadBehind the commit counts relative to the main branch. It
+// returns the first write error.
+func outputBranchesCSV(ctx context.Context, w io.Writer, result RepositoryResult, client *BitbucketClient, policy *stalePolicy, withMerged, withAheadBehind bool) error {
+	repo := result.Repository
+	branches, err := result.branches(ctx, client)
+	if err != nil {
+		return writeCSVRow(w, repo.FullName, "ERROR: "+err.Error(), "", "", "", "")
+	}
+	if withMerged {
+		branches = client.markMerged(ctx, repo, branches)
+	}
+	if withAheadBehind {
+		branches = client.markAheadBehind(ctx, repo, branches)
+	}
+
+	for _, branch := range branches {
+		branchDate := ""
+		branchAge := ""
+		if !branch.Target.Date.IsZero() {
+			branchDate = branch.Target.Date.Format("2006-01-02")
+			branchAge = strconv.Itoa(calculateMonthsDifference(branch.Target.Date, asOf))
+		}
+
+		fields := []string{
+			repo.FullName,
+			branch.Name,
+			branchDate,
+			branch.AuthorName(),
+			branchAge,
+			strconv.FormatBool(policy.isStale(ctx, repo, branch)),
+		}
+		if withMerged {
+			merged := ""
+			if branch.Merged != nil {
+				merged = strconv.FormatBool(*branch.Merged)
+			}
+			fields = append(fields, merged)
+		}
+		if withAheadBehind {
+			ahead, behind := aheadBehindColumns(branch)
+			fields = append(fields, ahead, behind)
+		}
+		if err := writeCSVRow(w, fields...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// escapeCSV escapes commas and quotes in CSV fields. It's used for the
+// comma-separated trend file; CSV output goes through writeCSVRow.
+func escapeCSV(field string) string {
+	if strings.Contains(field, ",") || strings.Contains(field, "\"") || strings.Contains(field, "\n") {
+		// Replace quotes with double quotes and wrap in quotes
+		field = strings.ReplaceAll(field, "\"", "\"\"")
+		return "\"" + field + "\""
+	}
+	return field
+}
+
+// SummaryStats holds summary statistics
+type SummaryStats struct {
+	TotalRepos      int `json:"total_repos"`
+	TotalBranches   int `json:"total_branches"`
+	OldBranches     int `json:"old_branches"`
+	OldRepos        int `json:"old_repos"`
+	RecentRepos     int `json:"recent_repos"`
+	RecentBranches  int `json:"recent_branches"`
+	UnknownBranches int `json:"unknown_branches"` // branches whose last push date could not be determined
+	// TruncatedRepos counts repositories whose branch list stopped at
+	// --max-branches, so their branch counts are lower bounds
+	TruncatedRepos int `json:"truncated_branch_lists,omitempty"`
+
+	// Thresholds the old/recent counts were classified with. BranchAgeMonths
+	// is BranchAge in whole months, for a --older-than given in other units.
+	BranchAgeMonths int          `json:"branch_age_months"`
+	RepoAgeMonths   int          `json:"repo_age_months"`
+	BranchAge       ageThreshold `json:"-"`
+
+	// Adjusted counts leave out branches that are never cleanup candidates
+	// (the default branch and optionally protected branches)
+	Adjusted               bool `json:"adjusted"`
+	ExcludedBranches       int  `json:"excluded_branches"`
+	AdjustedBranches       int  `json:"adjusted_branches"`
+	AdjustedOldBranches    int  `json:"adjusted_old_branches"`
+	AdjustedRecentBranches int  `json:"adjusted_recent_branches"`
+
+	// StaleReposByCreator breaks old repositories down by creator (--summary-creators)
+	StaleReposByCreator []CreatorCount `json:"stale_repos_by_creator,omitempty"`
+
+	// Repository age distributions, by creation date and by last update
+	RepoAgeHistogram        []HistogramBucket `json:"repo_age_histogram,omitempty"`
+	RepoInactivityHistogram []HistogramBucket `json:"repo_inactivity_histogram,omitempty"`
+
+	// The stale repositories and branches behind the counts (--list)
+	StaleRepoList   []StaleRepo   `json:"stale_repositories,omitempty"`
+	StaleBranchList []StaleBranch `json:"stale_branches,omitempty"`
+
+	// Open pull request totals (--with-prs)
+	PullRequests *PullRequestStats `json:"pull_requests,omitempty"`
+
+	// Tags across all repositories (--tags)
+	TotalTags *int `json:"total_tags,omitempty"`
+}
+
+// StaleRepo is a repository counted as old in the summary
+type StaleRepo struct {
+	Repository     string `json:"repository"`
+	MonthsInactive int    `json:"months_inactive"`
+}
+
+// StaleBranch is a branch counted as old in the summary
+type StaleBranch struct {
+	Repository string `json:"repository"`
+	Branch     string `json:"branch"`
+	AgeMonths  int    `json:"age_months"`
+}
+
+// addStaleLists records the concrete stale repositories and branches that the
+// summary counts represent. Branches come from the client's cache, so this
+// costs no extra requests after calculateSummaryStats.
+func addStaleLists(ctx context.Context, stats *SummaryStats, repos []Repository, client *BitbucketClient, policy *stalePolicy, repoOnly bool) {
+	for _, repo := range repos {
+		if policy.isOldRepo(repo) {
+			stats.StaleRepoList = append(stats.StaleRepoList, StaleRepo{
+				Repository:     repo.FullName,
+				MonthsInactive: calculateMonthsDifference(repo.UpdatedOn, asOf),
+			})
+		}
+		if repoOnly {
+			continue
+		}
+
+		branches, err := client.getBranches(ctx, repo.FullName)
+		if err != nil {
+			continue
+		}
+		for _, branch := range branches {
+			if !branch.Target.Date.IsZero() && policy.isStale(ctx, repo, branch) {
+				stats.StaleBranchList = append(stats.StaleBranchList, StaleBranch{
+					Repository: repo.FullName,
+					Branch:     branch.Name,
+					AgeMonths:  calculateMonthsDifference(branch.Target.Date, asOf),
+				})
+			}
+		}
+	}
+}
+
+// displayStaleLists prints the stale repositories and branches under the summary
+func displayStaleLists(stats *SummaryStats, repoOnly bool, yellow, red, cyan func(a ...interface{}) string) {
+	fmt.Printf("\n%s\n", cyan("Stale Repositories:"))
+	if len(stats.StaleRepoList) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, repo := range stats.StaleRepoList {
+		fmt.Printf("  %s %s\n", repo.Repository, yellow(fmt.Sprintf("(%d months inactive)", repo.MonthsInactive)))
+	}
+
+	if repoOnly {
+		return
+	}
+	fmt.Printf("\n%s\n", cyan("Stale Branches:"))
+	if len(stats.StaleBranchList) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, branch := range stats.StaleBranchList {
+		fmt.Printf("  %s:%s %s\n", branch.Repository, branch.Branch, red(fmt.Sprintf("(%d months old)", branch.AgeMonths)))
+	}
+}
+
+// CreatorCount tallies the repositories created by one person
+type CreatorCount struct {
+	Creator    string `json:"creator"`
+	TotalRepos int    `json:"total_repos"`
+	StaleRepos int    `json:"stale_repos"`
+}
+
+// addCreatorBreakdown records, per creator, how many of their repositories are
+// stale, ordered by stale count (then creator name). Stale means old under
+// policy, as the summary's old repository count does, so a repository with an
+// unknown last update isn't counted.
+func addCreatorBreakdown(stats *SummaryStats, results []RepositoryResult, policy *stalePolicy, normalizer *authorNormalizer) {
+	counts := make(map[string]*CreatorCount)
+	for _, result := range results {
+		creator := normalizer.canonical(result.Creator)
+		count, ok := counts[creator]
+		if !ok {
+			count = &CreatorCount{Creator: creator}
+			counts[creator] = count
+		}
+		count.TotalRepos++
+		if policy.isOldRepo(result.Repository) {
+			count.StaleRepos++
+		}
+	}
+
+	stats.StaleReposByCreator = make([]CreatorCount, 0, len(counts))
+	for _, count := range counts {
+		stats.StaleReposByCreator = append(stats.StaleReposByCreator, *count)
+	}
+	sort.Slice(stats.StaleReposByCreator, func(i, j int) bool {
+		a, b := stats.StaleReposByCreator[i], stats.StaleReposByCreator[j]
+		if a.StaleRepos != b.StaleRepos {
+			return a.StaleRepos > b.StaleRepos
+		}
+		return a.Creator < b.Creator
+	})
+}
+
+// HistogramBucket counts repositories whose age falls within [MinMonths, MaxMonths).
+// MaxMonths is 0 for the open-ended last bucket.
+type HistogramBucket struct {
+	Label     string `json:"label"`
+	MinMonths int    `json:"min_months"`
+	MaxMonths int    `json:"max_months,omitempty"`
+	Count     int    `json:"count"`
+}
+
+// defaultRepoAgeBuckets are the month boundaries of the repository age histogram
+var defaultRepoAgeBuckets = []int{6, 12, 24}
+
+// parseBuckets parses comma-separated, strictly increasing month boundaries
+func parseBuckets(value string) ([]int, error) {
+	var boundaries []int
+	for _, part := range parseRepoList(value) {
+		var months int
+		if _, err := fmt.Sscanf(part, "%d", &months); err != nil || months <= 0 {
+			return nil, fmt.Errorf("invalid bucket boundary %q", part)
+		}
+		if len(boundaries) > 0 && months <= boundaries[len(boundaries)-1] {
+			return nil, fmt.Errorf("bucket boundaries must be increasing: %s", value)
+		}
+		boundaries = append(boundaries, months)
+	}
+	if len(boundaries) == 0 {
+		return nil, fmt.Errorf("no bucket boundaries given")
+	}
+	return boundaries, nil
+}
+
+// formatMonths renders a month count as years when it divides evenly
+func formatMonths(months int) string {
+	if months >= 12 && months%12 == 0 {
+		return fmt.Sprintf("%dy", months/12)
+	}
+	return fmt.Sprintf("%dmo", months)
+}
+
+// newHistogram creates empty buckets for the given month boundaries
+func newHistogram(boundaries []int) []HistogramBucket {
+	buckets := make([]HistogramBucket, 0, len(boundaries)+1)
+	lower := 0
+	for _, upper := range boundaries {
+		label := fmt.Sprintf("%s-%s", formatMonths(lower), formatMonths(upper))
+		if lower == 0 {
+			label = "< " + formatMonths(upper)
+		}
+		buckets = append(buckets, HistogramBucket{Label: label, MinMonths: lower, MaxMonths: upper})
+		lower = upper
+	}
+	return append(buckets, HistogramBucket{Label: ">= " + formatMonths(lower), MinMonths: lower})
+}
+
+// addToHistogram counts an age in months into its bucket
+func addToHistogram(buckets []HistogramBucket, months int) {
+	for i := range buckets {
+		if buckets[i].MaxMonths == 0 || months < buckets[i].MaxMonths {
+			buckets[i].Count++
+			return
+		}
+	}
+}
+
+// branchCountExclusion selects branches to leave out of adjusted summary counts
+type branchCountExclusion struct {
+	defaultBranch bool
+	protection    *branchProtection // nil unless protected branches are excluded
+}
+
+// active reports whether any branches are excluded
+func (e *branchCountExclusion) active() bool {
+	return e != nil && (e.defaultBranch || e.protection != nil)
+}
+
+// excludes reports whether a branch is left out of the adjusted counts
+func (e *branchCountExclusion) excludes(repo Repository, branch Branch) bool {
+	if !e.active() {
+		return false
+	}
+	if e.defaultBranch && branch.Name == repo.MainBranch.Name {
+		return true
+	}
+	return e.protection != nil && e.protection.isProtected(branch.Name)
+}
+
+// Recommendation is a single cleanup action suggested by the summary
+type Recommendation struct {
+	Type            string `json:"type"`
+	Target          string `json:"target"`
+	Reason          string `json:"reason"`
+	SuggestedAction string `json:"suggested_action"`
+	Count           int    `json:"count"`
+}
+
+const (
+	recommendationStaleBranches = "stale-branches"
+	recommendationStaleRepos    = "stale-repositories"
+)
+
+// buildRecommendations derives cleanup recommendations from summary statistics.
+// It is the single source for both the human-readable and JSON summaries.
+func buildRecommendations(stats *SummaryStats, target string) []Recommendation {
+	var recommendations []Recommendation
+
+	// Only cleanup candidates count when default/protected branches are excluded
+	oldBranches := stats.OldBranches
+	if stats.Adjusted {
+		oldBranches = stats.AdjustedOldBranches
+	}
+	if oldBranches > 0 {
+		recommendations = append(recommendations, Recommendation{
+			Type:            recommendationStaleBranches,
+			Target:          target,
+			Reason:          fmt.Sprintf("%d branches have had no updates for >%s", oldBranches, stats.BranchAge),
+			SuggestedAction: "bhunter --output | bkiller --dry-run",
+			Count:           oldBranches,
+		})
+	}
+	if stats.OldRepos > 0 {
+		recommendations = append(recommendations, Recommendation{
+			Type:            recommendationStaleRepos,
+			Target:          target,
+			Reason:          fmt.Sprintf("%d repositories have had no activity for >%d months", stats.OldRepos, stats.RepoAgeMonths),
+			SuggestedAction: "Review repositories with no recent activity for archival",
+			Count:           stats.OldRepos,
+		})
+	}
+	return recommendations
+}
+
+// outputSummaryJSON writes the summary statistics and recommendations to w as JSON
+func outputSummaryJSON(w io.Writer, stats *SummaryStats, target string) error {
+	recommendations := buildRecommendations(stats, target)
+	if recommendations == nil {
+		recommendations = []Recommendation{}
+	}
+
+	// Derived figures match the text display, rounded to one decimal
+	round := func(value float64) *float64 {
+		value = math.Round(value*10) / 10
+		return &value
+	}
+	var oldRepoPercent, oldBranchPercent, avgBranches *float64
+	if stats.TotalRepos > 0 {
+		oldRepoPercent = round(float64(stats.OldRepos) / float64(stats.TotalRepos) * 100)
+	}
+	// Branch figures are left out in repository-only mode, which has histograms instead
+	if stats.RepoAgeHistogram == nil && stats.TotalBranches > 0 {
+		oldBranchPercent = round(float64(stats.OldBranches) / float64(stats.TotalBranches) * 100)
+		avgBranches = round(float64(stats.TotalBranches) / float64(stats.TotalRepos))
+	}
+
+	output := struct {
+		*SummaryStats
+		OldRepoPercent     *float64         `json:"old_repo_percent,omitempty"`
+		OldBranchPercent   *float64         `json:"old_branch_percent,omitempty"`
+		AvgBranchesPerRepo *float64         `json:"avg_branches_per_repo,omitempty"`
+		Target             string           `json:"target"`
+		Recommendations    []Recommendation `json:"recommendations"`
+	}{
+		SummaryStats:       stats,
+		OldRepoPercent:     oldRepoPercent,
+		OldBranchPercent:   oldBranchPercent,
+		AvgBranchesPerRepo: avgBranches,
+		Target:             target,
+		Recommendations:    recommendations,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(output)
+}
+
+// calculateSummaryStats calculates summary statistics for repositories and branches
+// If repoOnly is set, no branches are fetched and only repository statistics,
+// including the age histograms with the given bucket boundaries, are computed.
+// Each repository's branches are listed once, up to maxConcurrency
+// repositories at a time, then classified and counted from that list. Branches
+// are classified up to maxConcurrency at a time too, as the grace period costs
+// commit lookups per branch; the counts are added up in repository and branch
+// order, so they don't depend on the concurrency. When the branches of every
+// repository fail to list, there is nothing to summarize and the first
+// failure is returned; partial failures are only recorded for the end-of-run
+// report.
+func calculateSummaryStats(ctx context.Context, repos []Repository, client *BitbucketClient, policy *stalePolicy, exclusion *branchCountExclusion, repoOnly bool, ageBuckets []int, maxConcurrency int) (*SummaryStats, error) {
+	stats := &SummaryStats{
+		TotalRepos:      len(repos),
+		BranchAgeMonths: policy.branchAge.wholeMonths(),
+		BranchAge:       policy.branchAge,
+		RepoAgeMonths:   policy.repoMonths,
+		Adjusted:        exclusion.active(),
+	}
+	// Repositories whose branches can't be listed keep a nil list and are
+	// skipped; getBranches has recorded the failure
+	branchLists := make([][]Branch, len(repos))
+	listErrors := make([]error, len(repos))
+	if repoOnly {
+		stats.RepoAgeHistogram = newHistogram(ageBuckets)
+		stats.RepoInactivityHistogram = newHistogram(ageBuckets)
+	} else {
+		forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+			branchLists[i], listErrors[i] = client.getBranches(ctx, r.FullName)
+		})
+		if err := allFailed(listErrors); err != nil && ctx.Err() == nil {
+			return nil, err
+		}
+	}
+	stale := classifyStaleBranches(ctx, repos, branchLists, policy, maxConcurrency)
+
+	for r, repo := range repos {
+		// Check if repo is old (no access within the repository threshold)
+		if policy.isOldRepo(repo) {
+			stats.OldRepos++
+		} else {
+			stats.RecentRepos++
+		}
+
+		if repoOnly {
+			// Data Center records no creation date, so unknown dates aren't bucketed
+			if !repo.CreatedOn.IsZero() {
+				addToHistogram(stats.RepoAgeHistogram, calculateMonthsDifference(repo.CreatedOn, asOf))
+			}
+			if !repo.UpdatedOn.IsZero() {
+				addToHistogram(stats.RepoInactivityHistogram, calculateMonthsDifference(repo.UpdatedOn, asOf))
+			}
+			continue
+		}
+
+		branches := branchLists[r]
+		stats.TotalBranches += len(branches)
+		if client.branchesTruncated(repo.FullName) {
+			stats.TruncatedRepos++
+		}
+
+		for b, branch := range branches {
+			excluded := exclusion.excludes(repo, branch)
+			if excluded {
+				stats.ExcludedBranches++
+			} else if stats.Adjusted {
+				stats.AdjustedBranches++
+			}
+
+			if branch.Target.Date.IsZero() {
+				stats.UnknownBranches++
+			} else if stale[r][b] {
+				stats.OldBranches++
+				if stats.Adjusted && !excluded {
+					stats.AdjustedOldBranches++
+				}
+			} else {
+				stats.RecentBranches++
+				if stats.Adjusted && !excluded {
+					stats.AdjustedRecentBranches++
+				}
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// allFailed returns the first of errs when none is nil, and nil otherwise,
+// including when errs is empty
+func allFailed(errs []error) error {
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
+
+// classifyStaleBranches evaluates policy.isStale for every branch of
+// branchLists, the branches of the repository at the same index, up to
+// maxConcurrency at a time, as it can cost commit lookups per branch. The
+// result is indexed like branchLists.
+func classifyStaleBranches(ctx context.Context, repos []Repository, branchLists [][]Branch, policy *stalePolicy, maxConcurrency int) [][]bool {
+	type branchRef struct{ repo, branch int }
+	var refs []branchRef
+	stale := make([][]bool, len(repos))
+	for r, branches := range branchLists {
+		stale[r] = make([]bool, len(branches))
+		for b := range branches {
+			refs = append(refs, branchRef{r, b})
+		}
+	}
+	forEachIndex(ctx, len(refs), maxConcurrency, func(i int) {
+		ref := refs[i]
+		stale[ref.repo][ref.branch] = policy.isStale(ctx, repos[ref.repo], branchLists[ref.repo][ref.branch])
+	})
+	return stale
+}
+
+// warnSampledSummary writes a warning to w when summary counts cover only part
+// of what was asked for: a repository listing that stopped at --max-repos, or
+// branch lists cut at --max-branches
+func warnSampledSummary(w io.Writer, stats *SummaryStats, client *BitbucketClient) {
+	if client.reposCapped {
+		fmt.Fprintf(w, "Warning: the repository listing stopped at --max-repos %d; summary counts cover only those repositories\n", client.maxRepos)
+	}
+	if stats.TruncatedRepos > 0 {
+		fmt.Fprintf(w, "Warning: %d repositories had more than --max-branches %d branches; their branch counts are lower bounds\n", stats.TruncatedRepos, client.maxBranches)
+	}
+}
+
+// displaySummaryStats displays the summary statistics
+func displaySummaryStats(stats *SummaryStats, target string, yellow, red, green, cyan func(a ...interface{}) string) {
+	fmt.Printf("\n%s\n", green("=== BITBUCKET WORKSPACE SUMMARY ==="))
+	fmt.Printf("\n%s\n", cyan("Repository Statistics:"))
+	fmt.Printf("  Total Repositories: %d\n", stats.TotalRepos)
+
+	recentReposDisplay := fmt.Sprintf("%d", stats.RecentRepos)
+	oldReposDisplay := fmt.Sprintf("%d", stats.OldRepos)
+	if stats.OldRepos > 0 {
+		oldReposDisplay = yellow(oldReposDisplay)
+	}
+
+	fmt.Printf("  Recent Repositories (accessed within %d months): %s\n", stats.RepoAgeMonths, recentReposDisplay)
+	fmt.Printf("  Old Repositories (no access for >%d months): %s\n", stats.RepoAgeMonths, oldReposDisplay)
+
+	if stats.TotalRepos > 0 {
+		oldRepoPercent := float64(stats.OldRepos) / float64(stats.TotalRepos) * 100
+		fmt.Printf("  Old Repository Percentage: %.1f%%\n", oldRepoPercent)
+	}
+	if prs := stats.PullRequests; prs != nil {
+		fmt.Printf("  Open Pull Requests: %d across %d repositories\n", prs.OpenPullRequests, prs.ReposWithOpenPRs)
+		staleWithPRs := fmt.Sprintf("%d", prs.StaleReposWithOpenPRs)
+		if prs.StaleReposWithOpenPRs > 0 {
+			staleWithPRs = cyan(staleWithPRs)
+		}
+		fmt.Printf("  Old Repositories With Open Pull Requests: %s\n", staleWithPRs)
+	}
+	if stats.TotalTags != nil {
+		fmt.Printf("  Total Tags: %d\n", *stats.TotalTags)
+	}
+
+	if stats.StaleReposByCreator != nil {
+		fmt.Printf("\n%s\n", cyan("Stale Repositories by Creator:"))
+		for _, count := range stats.StaleReposByCreator {
+			staleDisplay := fmt.Sprintf("%d", count.StaleRepos)
+			if count.StaleRepos > 0 {
+				staleDisplay = yellow(staleDisplay)
+			}
+			fmt.Printf("  %s: %s stale of %d repositories\n", count.Creator, staleDisplay, count.TotalRepos)
+		}
+	}
+
+	if stats.RepoAgeHistogram != nil {
+		fmt.Printf("\n%s\n", cyan("Repository Age (since creation):"))
+		displayHistogram(stats.RepoAgeHistogram, yellow)
+		fmt.Printf("\n%s\n", cyan("Repository Inactivity (since last update):"))
+		displayHistogram(stats.RepoInactivityHistogram, yellow)
+
+		// Branch statistics are skipped entirely in repository-only mode
+		displayRecommendations(stats, target, yellow, red, green, cyan)
+		return
+	}
+
+	fmt.Printf("\n%s\n", cyan("Branch Statistics:"))
+	fmt.Printf("  Total Branches: %d\n", stats.TotalBranches)
+
+	recentBranchesDisplay := fmt.Sprintf("%d", stats.RecentBranches)
+	oldBranchesDisplay := fmt.Sprintf("%d", stats.OldBranches)
+	if stats.OldBranches > 0 {
+		oldBranchesDisplay = red(oldBranchesDisplay)
+	}
+
+	fmt.Printf("  Recent Branches (updated within %s): %s\n", stats.BranchAge, recentBranchesDisplay)
+	fmt.Printf("  Old Branches (no updates for >%s): %s\n", stats.BranchAge, oldBranchesDisplay)
+	if stats.UnknownBranches > 0 {
+		fmt.Printf("  Branches With Unknown Date: %d\n", stats.UnknownBranches)
+	}
+
+	if stats.TotalBranches > 0 {
+		oldBranchPercent := float64(stats.OldBranches) / float64(stats.TotalBranches) * 100
+		fmt.Printf("  Old Branch Percentage: %.1f%%\n", oldBranchPercent)
+		avgBranchesPerRepo := float64(stats.TotalBranches) / float64(stats.TotalRepos)
+		fmt.Printf("  Average Branches per Repository: %.1f\n", avgBranchesPerRepo)
+	}
+
+	if stats.Adjusted {
+		fmt.Printf("\n%s\n", cyan("Cleanup Candidate Branches (excluding default/protected branches):"))
+		fmt.Printf("  Excluded Branches: %d\n", stats.ExcludedBranches)
+		fmt.Printf("  Candidate Branches: %d\n", stats.AdjustedBranches)
+		fmt.Printf("  Recent Candidate Branches: %d\n", stats.AdjustedRecentBranches)
+		adjustedOldDisplay := fmt.Sprintf("%d", stats.AdjustedOldBranches)
+		if stats.AdjustedOldBranches > 0 {
+			adjustedOldDisplay = red(adjustedOldDisplay)
+		}
+		fmt.Printf("  Old Candidate Branches: %s\n", adjustedOldDisplay)
+		if stats.AdjustedBranches > 0 {
+			fmt.Printf("  Old Candidate Branch Percentage: %.1f%%\n", float64(stats.AdjustedOldBranches)/float64(stats.AdjustedBranches)*100)
+			fmt.Printf("  Average Candidate Branches per Repository: %.1f\n", float64(stats.AdjustedBranches)/float64(stats.TotalRepos))
+		}
+	}
+
+	displayRecommendations(stats, target, yellow, red, green, cyan)
+}
+
+// displayHistogram renders histogram buckets as text bars
+func displayHistogram(buckets []HistogramBucket, yellow func(a ...interface{}) string) {
+	const maxBarWidth = 40
+
+	maxCount, labelWidth := 0, 0
+	for _, bucket := range buckets {
+		if bucket.Count > maxCount {
+			maxCount = bucket.Count
+		}
+		if len(bucket.Label) > labelWidth {
+			labelWidth = len(bucket.Label)
+		}
+	}
+
+	for _, bucket := range buckets {
+		width := 0
+		if maxCount > 0 {
+			width = bucket.Count * maxBarWidth / maxCount
+		}
+		if bucket.Count > 0 && width == 0 {
+			width = 1
+		}
+		fmt.Printf("  %-*s %s %d\n", labelWidth, bucket.Label, yellow(strings.Repeat("█", width)), bucket.Count)
+	}
+}
+
+// displayRecommendations prints the cleanup recommendations block
+func displayRecommendations(stats *SummaryStats, target string, yellow, red, green, cyan func(a ...interface{}) string) {
+	fmt.Printf("\n%s\n", cyan("Cleanup Recommendations:"))
+	recommendations := buildRecommendations(stats, target)
+	for _, rec := range recommendations {
+		switch rec.Type {
+		case recommendationStaleBranches:
+			fmt.Printf("  • Consider cleaning up %s old branches\n", red(fmt.Sprintf("%d", rec.Count)))
+			fmt.Printf("  • Use: %s\n", rec.SuggestedAction)
+		case recommendationStaleRepos:
+			fmt.Printf("  • Review %s repositories with no recent activity\n", yellow(fmt.Sprintf("%d", rec.Count)))
+		}
+	}
+	if len(recommendations) == 0 {
+		fmt.Printf("  • %s No cleanup needed - workspace is well maintained!\n", green("✓"))
+	}
+	fmt.Println()
+}
+
+// appendSummaryTrend appends one timestamped row of summary totals to a CSV
+// trend log, writing the header first if the file is new or empty
+func appendSummaryTrend(path string, stats *SummaryStats, target string) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		_, err = fmt.Fprintln(file, "Timestamp,Target,Total Repos,Recent Repos,Old Repos,Old Repo %,Total Branches,Recent Branches,Old Branches,Old Branch %")
+		if err != nil {
+			return err
+		}
+	}
+
+	oldRepoPercent := 0.0
+	if stats.TotalRepos > 0 {
+		oldRepoPercent = float64(stats.OldRepos) / float64(stats.TotalRepos) * 100
+	}
+	oldBranchPercent := 0.0
+	if stats.TotalBranches > 0 {
+		oldBranchPercent = float64(stats.OldBranches) / float64(stats.TotalBranches) * 100
+	}
+
+	_, err = fmt.Fprintf(file, "%s,%s,%d,%d,%d,%.1f,%d,%d,%d,%.1f\n",
+		asOf.Format(time.RFC3339),
+		escapeCSV(target),
+		stats.TotalRepos,
+		stats.RecentRepos,
+		stats.OldRepos,
+		oldRepoPercent,
+		stats.TotalBranches,
+		stats.RecentBranches,
+		stats.OldBranches,
+		oldBranchPercent)
+	return err
+}
+
+// calculateMonthsDifference calculates the accurate difference in months between two dates
+func calculateMonthsDifference(start, end time.Time) int {
+	years := end.Year() - start.Year()
+	months := int(end.Month()) - int(start.Month())
+	totalMonths := years*12 + months
+
+	// Adjust if the day hasn't been reached yet in the current month
+	if end.Day() < start.Day() {
+		totalMonths--
+	}
+
+	return totalMonths
 }
 
 // Parse exclude/include project filters
@@ -670,132 +3342,1166 @@ func parseRepoList(repoList string) []string {
 	if repoList == "" {
 		return nil
 	}
-	repos := strings.Split(repoList, ",")
-	for i := range repos {
-		repos[i] = strings.TrimSpace(repos[i])
+	repos := strings.Split(repoList, ",")
+	for i := range repos {
+		repos[i] = strings.TrimSpace(repos[i])
+	}
+	return repos
+}
+
+// mergeWorkspaces combines a comma-separated workspace setting with the
+// config's workspaces list, dropping blanks and duplicates
+func mergeWorkspaces(workspace string, more []string) []string {
+	var merged []string
+	seen := make(map[string]bool)
+	for _, name := range append(parseRepoList(workspace), more...) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		merged = append(merged, name)
+	}
+	return merged
+}
+
+// shouldSkipRepo determines if a repository should be skipped based on include/exclude project filters
+func shouldSkipRepo(repo Repository, includeList, excludeList []string) bool {
+	// Get project key or name for matching
+	projectKey := repo.Project.Key
+	projectName := repo.Project.Name
+
+	// Handle repositories not assigned to any project
+	if projectKey == "" && projectName == "" {
+		// If include list is specified and repo has no project, skip it
+		if len(includeList) > 0 {
+			return true // Skip - repo not in any project, but we only want specific projects
+		}
+		// If only exclude list is specified, don't skip repos with no project
+		return false
+	}
+
+	// If include list is specified, only include repos in those projects
+	if len(includeList) > 0 {
+		for _, included := range includeList {
+			if strings.EqualFold(projectKey, included) || strings.EqualFold(projectName, included) {
+				return false // Don't skip - it's in an included project
+			}
+		}
+		return true // Skip - not in any included project
+	}
+
+	// If no include list, check exclude list
+	for _, excluded := range excludeList {
+		if strings.EqualFold(projectKey, excluded) || strings.EqualFold(projectName, excluded) {
+			return true // Skip - it's in an excluded project
+		}
+	}
+
+	return false // Don't skip - not excluded
+}
+
+// descriptionFilter matches repositories by keywords in their description
+type descriptionFilter struct {
+	terms []string       // case-insensitive substrings, any of which may match
+	regex *regexp.Regexp // optional regular expression
+}
+
+// active reports whether any description criteria were given
+func (f *descriptionFilter) active() bool {
+	return len(f.terms) > 0 || f.regex != nil
+}
+
+// matches reports whether the repository description matches any criterion
+func (f *descriptionFilter) matches(repo Repository) bool {
+	if !f.active() {
+		return true
+	}
+	description := strings.ToLower(repo.Description)
+	for _, term := range f.terms {
+		if term != "" && strings.Contains(description, strings.ToLower(term)) {
+			return true
+		}
+	}
+	return f.regex != nil && f.regex.MatchString(repo.Description)
+}
+
+// nameFilter matches repository names against --filter and --filter-exclude
+// patterns, interpreted as case-insensitive globs or, with --regex, as
+// regular expressions
+type nameFilter struct {
+	include []*regexp.Regexp // any may match; none means every name is included
+	exclude []*regexp.Regexp
+}
+
+// newNameFilter compiles the include and exclude patterns
+func newNameFilter(include, exclude []string, useRegex bool) (*nameFilter, error) {
+	compile := func(patterns []string) ([]*regexp.Regexp, error) {
+		var compiled []*regexp.Regexp
+		for _, pattern := range patterns {
+			expr := pattern
+			if !useRegex {
+				expr = globToRegexp(pattern)
+			}
+			re, err := regexp.Compile("(?i)" + expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter pattern %q: %v", pattern, err)
+			}
+			compiled = append(compiled, re)
+		}
+		return compiled, nil
+	}
+
+	filter := &nameFilter{}
+	var err error
+	if filter.include, err = compile(include); err != nil {
+		return nil, err
+	}
+	if filter.exclude, err = compile(exclude); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// globToRegexp converts a glob (* and ? wildcards) into an anchored regular expression
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+	return expr.String()
+}
+
+// active reports whether any name patterns were given
+func (f *nameFilter) active() bool {
+	return len(f.include) > 0 || len(f.exclude) > 0
+}
+
+// matches reports whether the repository name passes the filter
+func (f *nameFilter) matches(repo Repository) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(repo.Name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(repo.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSize renders a repository size in bytes as B, KB, MB or GB
+func formatSize(bytes int64) string {
+	if bytes < 0 {
+		return "(unknown)"
+	}
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	value := float64(bytes) / unit
+	for _, suffix := range []string{"KB", "MB"} {
+		if value < unit {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return fmt.Sprintf("%.1f GB", value)
+}
+
+// sizeMB renders a repository size for the CSV Size (MB) column, empty when unknown
+func sizeMB(bytes int64) string {
+	if bytes < 0 {
+		return ""
+	}
+	return strconv.FormatFloat(float64(bytes)/(1024*1024), 'f', 1, 64)
+}
+
+// filterArchived drops archived repositories (--exclude-archived)
+func filterArchived(repos []Repository) []Repository {
+	var filtered []Repository
+	for _, repo := range repos {
+		if !repo.Archived {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// filterByOwner keeps only repositories whose owner username is one of owners
+// (--owner), ignoring case
+func filterByOwner(repos []Repository, owners []string, anon *anonymizer) []Repository {
+	if len(owners) == 0 {
+		return repos
+	}
+	var filtered []Repository
+	for _, repo := range repos {
+		if ownedByAny(repo, owners, anon) {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// ownedByAny reports whether repo's owner username is one of owners, ignoring
+// case. With --anonymize the listed owners are already pseudonyms, so owners
+// are compared by pseudonym, both as given and in lower case, the usual case
+// of usernames.
+func ownedByAny(repo Repository, owners []string, anon *anonymizer) bool {
+	for _, owner := range owners {
+		if anon == nil && strings.EqualFold(repo.Owner.Username, owner) {
+			return true
+		}
+		if anon != nil && (repo.Owner.Username == anon.pseudonym(owner) || repo.Owner.Username == anon.pseudonym(strings.ToLower(owner))) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterByName keeps only repositories whose name passes the filter
+func filterByName(repos []Repository, filter *nameFilter) []Repository {
+	if !filter.active() {
+		return repos
+	}
+	var filtered []Repository
+	for _, repo := range repos {
+		if filter.matches(repo) {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// filterByDescription keeps only repositories whose description matches
+func filterByDescription(repos []Repository, filter *descriptionFilter) []Repository {
+	if !filter.active() {
+		return repos
+	}
+	var filtered []Repository
+	for _, repo := range repos {
+		if filter.matches(repo) {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// dateFilter keeps repositories created or updated within a date range.
+// After bounds are inclusive and before bounds exclusive, so
+// --created-after 2023-01-01 --created-before 2024-01-01 is all of 2023.
+type dateFilter struct {
+	createdAfter, createdBefore time.Time
+	updatedAfter, updatedBefore time.Time
+}
+
+// newDateFilter parses the YYYY-MM-DD bounds of the date filter flags; empty ones are unset
+func newDateFilter(createdAfter, createdBefore, updatedAfter, updatedBefore string) (*dateFilter, error) {
+	filter := &dateFilter{}
+	bounds := []struct {
+		flag  string
+		value string
+		date  *time.Time
+	}{
+		{"--created-after", createdAfter, &filter.createdAfter},
+		{"--created-before", createdBefore, &filter.createdBefore},
+		{"--updated-after", updatedAfter, &filter.updatedAfter},
+		{"--updated-before", updatedBefore, &filter.updatedBefore},
+	}
+	for _, bound := range bounds {
+		if bound.value == "" {
+			continue
+		}
+		parsed, err := time.Parse("2006-01-02", bound.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s date %q (expected YYYY-MM-DD)", bound.flag, bound.value)
+		}
+		*bound.date = parsed
+	}
+	if !filter.createdAfter.IsZero() && !filter.createdBefore.IsZero() && !filter.createdAfter.Before(filter.createdBefore) {
+		return nil, fmt.Errorf("--created-after must be earlier than --created-before")
+	}
+	if !filter.updatedAfter.IsZero() && !filter.updatedBefore.IsZero() && !filter.updatedAfter.Before(filter.updatedBefore) {
+		return nil, fmt.Errorf("--updated-after must be earlier than --updated-before")
+	}
+	return filter, nil
+}
+
+func (f *dateFilter) active() bool {
+	return !f.createdAfter.IsZero() || !f.createdBefore.IsZero() || !f.updatedAfter.IsZero() || !f.updatedBefore.IsZero()
+}
+
+// within reports whether t lies in [after, before), ignoring unset bounds
+func within(t, after, before time.Time) bool {
+	return (after.IsZero() || !t.Before(after)) && (before.IsZero() || t.Before(before))
+}
+
+func (f *dateFilter) matches(repo Repository) bool {
+	return within(repo.CreatedOn, f.createdAfter, f.createdBefore) && within(repo.UpdatedOn, f.updatedAfter, f.updatedBefore)
+}
+
+func filterByDate(repos []Repository, filter *dateFilter) []Repository {
+	if !filter.active() {
+		return repos
+	}
+	var filtered []Repository
+	for _, repo := range repos {
+		if filter.matches(repo) {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// parseRatio parses a ratio given as a fraction (0.5) or percentage (50%)
+func parseRatio(value string) (float64, error) {
+	var ratio float64
+	if strings.HasSuffix(value, "%") {
+		if _, err := fmt.Sscanf(strings.TrimSuffix(value, "%"), "%g", &ratio); err != nil {
+			return 0, fmt.Errorf("invalid ratio %q", value)
+		}
+		ratio /= 100
+	} else if _, err := fmt.Sscanf(value, "%g", &ratio); err != nil {
+		return 0, fmt.Errorf("invalid ratio %q", value)
+	}
+	if ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("ratio %q must be between 0 and 1 (or 0%% and 100%%)", value)
+	}
+	return ratio, nil
+}
+
+// filterByStaleRatio classifies each repository's branches concurrently and
+// keeps only repositories whose stale-branch fraction exceeds minRatio. The
+// counts are attached to each kept repository for display.
+func filterByStaleRatio(ctx context.Context, repos []Repository, client *BitbucketClient, policy *stalePolicy, minRatio float64, maxConcurrency int) []Repository {
+	classified := make([]*RepoBranchStats, len(repos))
+	forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+		branches, err := client.getBranches(ctx, r.FullName)
+		if err != nil {
+			return
+		}
+		stats := &RepoBranchStats{Total: len(branches)}
+		for _, branch := range branches {
+			if policy.isStale(ctx, r, branch) {
+				stats.Stale++
+			}
+		}
+		classified[i] = stats
+	})
+
+	var filtered []Repository
+	for i, repo := range repos {
+		if classified[i] != nil && classified[i].Total > 0 && classified[i].StaleRatio() > minRatio {
+			repo.BranchStats = classified[i]
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// filterByCommitCount keeps only repositories whose commit count is within
+// [minCommits, maxCommits]. A bound of 0 means no bound. Counting is capped just
+// past the largest bound that matters, so large repositories stay cheap.
+// Repositories whose commits cannot be counted are kept rather than hidden.
+func filterByCommitCount(ctx context.Context, repos []Repository, client *BitbucketClient, minCommits, maxCommits, maxConcurrency int) []Repository {
+	if minCommits <= 0 && maxCommits <= 0 {
+		return repos
+	}
+
+	limit := minCommits
+	if maxCommits > 0 {
+		limit = maxCommits + 1
+	}
+
+	keep := make([]bool, len(repos))
+	forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+		count, _, err := client.getCommitCount(ctx, r.FullName, limit)
+		if err != nil {
+			keep[i] = true
+			return
+		}
+		keep[i] = (minCommits <= 0 || count >= minCommits) && (maxCommits <= 0 || count <= maxCommits)
+	})
+
+	var filtered []Repository
+	for i, repo := range repos {
+		if keep[i] {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// isEmptyRepository reports whether a repository has no content: a size of 0
+// or no branches at all
+func isEmptyRepository(ctx context.Context, repo Repository, provider Provider) (bool, error) {
+	if repo.Size == 0 {
+		return true, nil
+	}
+	branches, err := provider.getBranches(ctx, repo.FullName)
+	if err != nil {
+		return false, err
+	}
+	return len(branches) == 0, nil
+}
+
+// filterEmptyRepos keeps only empty repositories. Repositories whose branches
+// cannot be fetched are left out, since they can't be shown to be empty.
+func filterEmptyRepos(ctx context.Context, repos []Repository, provider Provider, maxConcurrency int) []Repository {
+	keep := make([]bool, len(repos))
+	forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+		empty, err := isEmptyRepository(ctx, r, provider)
+		keep[i] = err == nil && empty
+	})
+
+	var filtered []Repository
+	for i, repo := range repos {
+		if keep[i] {
+			filtered = append(filtered, repo)
+		}
+	}
+	return filtered
+}
+
+// outputEmptyRepos lists empty repositories with their creation date and
+// creator. Empty repositories have no commits to attribute, so the owner
+// stands in for the creator.
+func outputEmptyRepos(w io.Writer, repos []Repository, asCSV bool, bold, yellow func(a ...interface{}) string) error {
+	if asCSV {
+		if err := writeCSVHeader(w, "Repository Name", "Date Created", "Repo Age (months)", "Creator"); err != nil {
+			return err
+		}
+		for _, repo := range repos {
+			created, age := "", ""
+			if !repo.CreatedOn.IsZero() {
+				created = repo.CreatedOn.Format("2006-01-02 15:04:05")
+				age = strconv.Itoa(calculateMonthsDifference(repo.CreatedOn, asOf))
+			}
+			err := writeCSVRow(w,
+				repo.Name,
+				created,
+				age,
+				repo.Owner.DisplayName)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if len(repos) == 0 {
+		fmt.Println("\nNo empty repositories found")
+		return nil
 	}
-	return repos
+	fmt.Printf("\n%s\n", bold(fmt.Sprintf("Empty repositories (%d):", len(repos))))
+	for _, repo := range repos {
+		age := ""
+		if !repo.CreatedOn.IsZero() {
+			age = " " + yellow(fmt.Sprintf("(%d months old)", calculateMonthsDifference(repo.CreatedOn, asOf)))
+		}
+		fmt.Printf("  %s  created %s by %s%s\n",
+			repo.DisplayName(),
+			formatDate(repo.CreatedOn),
+			repo.Owner.DisplayName,
+			age)
+	}
+	return nil
 }
 
-// shouldSkipRepo determines if a repository should be skipped based on include/exclude project filters
-func shouldSkipRepo(repo Repository, includeList, excludeList []string) bool {
-	// Get project key or name for matching
-	projectKey := repo.Project.Key
-	projectName := repo.Project.Name
+// saveSnapshot writes a snapshot, exiting on failure
+func saveSnapshot(path string, snapshot *Snapshot) {
+	if err := writeSnapshot(path, snapshot); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing snapshot: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+}
 
-	// Handle repositories not assigned to any project
-	if projectKey == "" && projectName == "" {
-		// If include list is specified and repo has no project, skip it
-		if len(includeList) > 0 {
-			return true // Skip - repo not in any project, but we only want specific projects
+func main() {
+	// Start timing the operation
+	startTime := time.Now()
+
+	// Cancel in-flight requests on Ctrl-C so a scan stops promptly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var (
+		username             = flag.String("u", "", "Bitbucket username")
+		usernameAlt          = flag.String("username", "", "Bitbucket username")
+		appPassword          = flag.String("p", "", "Bitbucket app password")
+		appPasswordAlt       = flag.String("password", "", "Bitbucket app password")
+		accessToken          = flag.String("access-token", "", "Bitbucket OAuth 2.0 access token (used instead of username and app password)")
+		workspace            = flag.String("w", "", "Bitbucket workspace, or a comma-separated list (optional, defaults to username)")
+		workspaceAlt         = flag.String("workspace", "", "Bitbucket workspace, or a comma-separated list (optional)")
+		baseURL              = flag.String("base-url", "", "API base URL, e.g. https://bitbucket.example.com for Data Center (default: the provider's hosted service)")
+		providerName         = flag.String("provider", "", "Hosting service: bitbucket, github or gitlab (default bitbucket)")
+		repoName             = flag.String("r", "", "Repository name (optional, analyze only this repo)")
+		repoNameAlt          = flag.String("repo", "", "Repository name (optional)")
+		repoFile             = flag.String("repo-file", "", "Analyze only the repositories listed in this file, one per line (# starts a comment)")
+		excludeRepos         = flag.String("exclude", "", "Comma-separated list of project keys/names to exclude")
+		excludeReposAlt      = flag.String("e", "", "Comma-separated list of project keys/names to exclude")
+		includeRepos         = flag.String("include", "", "Comma-separated list of project keys/names to include (only these will be analyzed)")
+		includeReposAlt      = flag.String("i", "", "Comma-separated list of project keys/names to include (only these will be analyzed)")
+		anonymize            = flag.Bool("anonymize", false, "Replace people's names with pseudonyms in all output")
+		anonymizeSeed        = flag.String("anonymize-seed", "", "Seed for deterministic pseudonyms across runs (implies --anonymize)")
+		asOfDate             = flag.String("as-of", "", "Compute all ages relative to this date (YYYY-MM-DD) instead of now")
+		gracePeriod          = flag.String("stale-grace-period", "", "Don't flag branches created within this period even if their tip is old (e.g. 14d)")
+		backoffJitter        = flag.String("backoff-jitter", "full", "Retry backoff jitter: full (random delay up to the backoff) or none")
+		retryLogFile         = flag.String("retry-log", "", "Record every retried request to this file as JSON lines")
+		runStats             = flag.Bool("stats", false, "Print API calls, retries, cache hits and wall time to stderr after the run")
+		runStatsAlt          = flag.Bool("workers-stats", false, "Alias for --stats")
+		workers              = flag.Int("workers", defaultWorkers, "Number of repositories to process concurrently")
+		concurrency          = flag.Int("concurrency", 0, "Alias for --workers")
+		maxInFlight          = flag.Int("max-inflight", 0, "Maximum concurrent HTTP requests across all workers (default: same as --workers)")
+		validateOnly         = flag.Bool("validate", false, "Check the credentials and workspace with a single request, then exit")
+		saveCredentials      = flag.Bool("save-credentials", false, "Store the credentials in use in the OS keychain for later runs")
+		keyringService       = flag.String("keyring-service", "", "OS keychain service name for stored credentials (default bhunter)")
+		proxyURL             = flag.String("proxy", "", "Proxy URL for all requests, e.g. http://proxy:3128 (default: HTTP_PROXY/HTTPS_PROXY; NO_PROXY always applies)")
+		requestTimeout       = flag.Duration("timeout", 0, "Timeout for each whole request, including downloading the response (default 2m)")
+		dialTimeout          = flag.Duration("dial-timeout", 0, "Timeout for establishing a connection (default 10s)")
+		tlsTimeout           = flag.Duration("tls-handshake-timeout", 0, "Timeout for the TLS handshake (default 10s)")
+		headerTimeout        = flag.Duration("response-header-timeout", 0, "Timeout for receiving response headers once a request is sent (default 10s)")
+		connectTimeout       = flag.Duration("connect-timeout", 0, "Shorthand setting the dial, TLS handshake and response header timeouts")
+		fetchTimeout         = flag.Duration("fetch-timeout", 0, "Alias for --timeout")
+		cacheTTL             = flag.Duration("cache-ttl", 0, "Reuse API responses cached on disk for this long, e.g. 1h (default off)")
+		noCache              = flag.Bool("no-cache", false, "Bypass the response cache for this run")
+		clearCache           = flag.Bool("clear-cache", false, "Delete all cached API responses and exit")
+		rateLimit            = flag.Float64("rate-limit", 0, "Maximum requests per second across all workers (default: no cap, server rate limit headers are always honored)")
+		retryOn              = flag.String("retry-on", "", "Comma-separated conditions to retry on: network, 5xx, 429, none (default: network,5xx,429)")
+		role                 = flag.String("role", "", "Only list repositories where you have this role: owner, admin, contributor, member")
+		createdAfter         = flag.String("created-after", "", "Only repositories created on or after this date (YYYY-MM-DD)")
+		createdBefore        = flag.String("created-before", "", "Only repositories created before this date (YYYY-MM-DD)")
+		updatedAfter         = flag.String("updated-after", "", "Only repositories updated on or after this date (YYYY-MM-DD)")
+		updatedBefore        = flag.String("updated-before", "", "Only repositories updated before this date (YYYY-MM-DD)")
+		modifiedSince        = flag.String("repos-modified-since", "", "Only fetch repositories updated after this date (YYYY-MM-DD, filtered server-side)")
+		cursorFile           = flag.String("cursor-file", "", "Save the repository listing's next-page URL to this file after each page")
+		continueFrom         = flag.String("continue-from", "", "Resume repository listing from a cursor file written by --cursor-file")
+		maxRepoPages         = flag.Int("max-repo-pages", 0, "Stop listing repositories after this many pages (use with --cursor-file to chunk a scan)")
+		pageLen              = flag.Int("page-len", pageSize, "Results per page of repository and branch listings (1-100)")
+		maxRepos             = flag.Int("max-repos", 0, "Stop listing repositories after this many (default: no limit)")
+		maxBranches          = flag.Int("max-branches", 0, "Stop listing each repository's branches after this many (default: no limit)")
+		creatorPages         = flag.Int("creator-pages", defaultCreatorPages, "Pages of commits (100 each) searched for a repository's first commit before the owner is reported as its creator (0 = no limit)")
+		descContains         = flag.String("description-contains", "", "Comma-separated keywords; only include repositories whose description contains one (case-insensitive)")
+		filterRegex          = flag.Bool("regex", false, "Interpret --filter and --filter-exclude patterns as regular expressions")
+		descRegex            = flag.String("description-regex", "", "Only include repositories whose description matches this regular expression")
+		minCommits           = flag.Int("min-commits", 0, "Only include repositories with at least this many commits")
+		maxCommits           = flag.Int("max-commits", 0, "Only include repositories with at most this many commits")
+		minStaleRatio        = flag.String("min-stale-ratio", "", "Only include repositories whose stale-branch fraction exceeds this (e.g. 0.5 or 50%)")
+		onlyEmptyRepos       = flag.Bool("only-empty-repos", false, "List only empty repositories (size 0 or no branches) as deletion candidates")
+		hygiene              = flag.Bool("hygiene", false, "Report repositories missing a README or bitbucket-pipelines.yml on their default branch")
+		emailDomains         = flag.Bool("commit-email-domains", false, "Report the email domains of recent commits per repository, flagging non-corporate ones")
+		emailSample          = flag.Int("email-sample", defaultEmailSample, "Recent commits sampled per repository by --commit-email-domains")
+		corporateDomains     = flag.String("corporate-domains", "", "Comma-separated corporate email domains for --commit-email-domains")
+		duplicateBranches    = flag.Int("duplicate-branches", 0, "Report branch names that appear in more than this many repositories")
+		excludeArchived      = flag.Bool("exclude-archived", false, "Leave archived repositories out of the scan")
+		repoOnly             = flag.Bool("repo-only", false, "Show only repository information (no branch details)")
+		branchesOnly         = flag.Bool("branches-only", false, "With --csv, output one row per branch without repository metadata")
+		openRepo             = flag.Bool("open", false, "With -r, print the repository's web URL and open it in the default browser")
+		branchCreators       = flag.Bool("branch-creators", false, "Show who created each branch in the full display, from its first commit off the main branch (extra requests per branch)")
+		mergeBase            = flag.Bool("merge-base", false, "Show how long ago each stale branch diverged from the main branch (extra request per stale branch)")
+		commitStatsFlag      = flag.Bool("commit-stats", false, "Add total commits and the latest committer to CSV and JSON output (pages through each repository's commits)")
+		withTags             = flag.Bool("tags", false, "List tags with their commit dates and taggers in the display, CSV and summary")
+		withPRs              = flag.Bool("with-prs", false, "Show open pull request counts per repository (extra request per repository)")
+		checkMerged          = flag.Bool("check-merged", false, "Mark branches already merged into the main branch (extra request per branch)")
+		aheadBehind          = flag.Bool("ahead-behind", false, "Add each branch's commits ahead of and behind the main branch to CSV and JSON (extra requests per branch)")
+		safeDelete           = flag.Bool("safe-delete", false, "Like --output, but emit only branches with no commits ahead of the main branch, whatever their age")
+		preview              = flag.Bool("preview", false, "With --output, explain each candidate branch (last push, age, reason) and print a total instead of bare lines")
+		interactive          = flag.Bool("interactive", false, "With --output, ask keep/delete for each candidate branch and emit only the ones chosen for deletion")
+		mergedOnly           = flag.Bool("merged-only", false, "With --output, emit only branches already merged into the main branch, whatever their age")
+		hideRecent           = flag.Bool("hide-recent-branches", false, "In the full display, list only stale branches and note how many recent ones were hidden")
+		timeline             = flag.Bool("timeline", false, "Show a per-repository sparkline of monthly commit counts (extra commit requests)")
+		timelineMonths       = flag.Int("timeline-months", defaultTimelineMonths, "Months covered by --timeline")
+		noColor              = flag.Bool("no-color", false, "Disable colored output and use ASCII for sparklines")
+		forceColor           = flag.Bool("force-color", false, "Keep colors even when stdout is not a terminal or NO_COLOR is set")
+		sortBy               = flag.String("sort", "", "Order repositories by: name, created, updated, age (stalest first) or risk (highest first)")
+		reverseSort          = flag.Bool("reverse", false, "Reverse the --sort order")
+		groupBy              = flag.String("group-by", "", "Group the full display: creator or project (repositories under a header each, with subtotals)")
+		groupByProj          = flag.Bool("group-by-project", false, "Same as --group-by project")
+		branchAgeMonths      = flag.Int("branch-age-months", 0, "Months without a push after which a branch is old (default 6)")
+		olderThan            = flag.String("older-than", "", "Age without a push after which a branch is old, e.g. 18mo, 2y, 90d (replaces --branch-age-months)")
+		repoAgeMonths        = flag.Int("repo-age-months", 0, "Months without activity after which a repository is old (default 12)")
+		noCreator            = flag.Bool("no-creator", false, "Skip the first-commit creator lookup (fastest with --repo-only)")
+		output               = flag.Bool("o", false, "Output old branch names (see --branch-age-months) for piping to bkiller")
+		outputAlt            = flag.Bool("output", false, "Output old branch names (see --branch-age-months) for piping to bkiller")
+		outputTemplate       = flag.String("output-template", defaultOutputTemplate, "Line format for --output: {repo}, {repo_name}, {workspace}, {branch}, \\t")
+		csv                  = flag.Bool("csv", false, "Output repository information in CSV format")
+		outFile              = flag.String("out-file", "", "Write CSV, JSON, JSON lines or Markdown output to this file instead of stdout")
+		appendOut            = flag.Bool("append", false, "Append to --out-file instead of truncating it")
+		postURL              = flag.String("post-url", "", "POST the results as JSON (as with --json) to this URL after the scan")
+		delimiter            = flag.String("delimiter", ",", "CSV field separator: , ; or \\t")
+		summary              = flag.Bool("summary", false, "Show summary statistics (repos, branches, old branches)")
+		excludeDefault       = flag.Bool("exclude-default-branch", false, "Leave each repository's default branch out of adjusted summary branch counts")
+		excludeProtect       = flag.Bool("exclude-protected-branches", false, "Leave protected branches out of adjusted summary branch counts")
+		snapshotFile         = flag.String("snapshot", "", "Save a snapshot of all branches to this JSON file for later comparison")
+		diffAuthorFiles      = flag.String("diff-authors", "", "Compare two snapshots (old.json,new.json) by per-author stale branch counts")
+		repoAgeBuckets       = flag.String("repo-age-buckets", "", "Month boundaries for the --summary --repo-only age histogram (default 6,12,24)")
+		summaryCreators      = flag.Bool("summary-creators", false, "Look up creators during --summary and break stale repositories down by creator")
+		normalizeAuthors     = flag.Bool("normalize-authors", false, "Count names that differ only in case or whitespace as one person in per-author stats")
+		listStale            = flag.Bool("list", false, "With --summary, list the stale repositories and branches behind the counts")
+		trendFile            = flag.String("trend-file", "", "Append each --summary run's totals to this CSV file")
+		markdown             = flag.Bool("markdown", false, "Output results as a Markdown report with a repository table and old branches per repository")
+		htmlFile             = flag.String("html", "", "Write a self-contained HTML report with color-coded staleness to this file")
+		summaryJSON          = flag.Bool("summary-json", false, "Shorthand for --summary --json")
+		jsonOutput           = flag.Bool("json", false, "Output results as JSON (summary statistics with --summary, build details with --version)")
+		jsonLines            = flag.Bool("jsonl", false, "Stream results as JSON lines, one repository per line as soon as it is processed")
+		jsonLinesAlt         = flag.Bool("json-lines", false, "Alias for --jsonl")
+		noDeprecationWarning = flag.Bool("no-deprecation-warning", false, "Don't warn about app password deprecation")
+		failOnDeprecated     = flag.Bool("fail-on-deprecated", false, "Exit with an error when using an app password past its deprecation date")
+		quietProgress        = flag.Bool("quiet", false, "Don't print the scan progress counter to stderr")
+		verbose              = flag.Bool("verbose", false, "Print the HTTP request count and time for each repository to stderr")
+		configFile           = flag.String("config-file", "", "Load configuration from this file instead of searching the default locations")
+		configDir            = flag.String("config-dir", "", "Look for config files in this directory before the default locations")
+		noConfigFile         = flag.Bool("no-config-file", false, "Never read config files; use only flags and environment variables (or set BHUNTER_NO_CONFIG=1)")
+		createConfig         = flag.Bool("c", false, "Create a sample bhunter.yaml in the current directory")
+		createConfigAlt      = flag.Bool("config", false, "Create a sample bhunter.yaml in the current directory")
+		help                 = flag.Bool("h", false, "Show help")
+		helpAlt              = flag.Bool("help", false, "Show help")
+		versionFlag          = flag.Bool("version", false, "Show version information")
+	)
+
+	var protectRegexes stringListFlag
+	var protectGlobs stringListFlag
+	flag.Var(&protectGlobs, "protect", "Glob pattern for branch names that must never be reported for deletion, e.g. 'release/*' (repeatable)")
+	flag.Var(&protectRegexes, "protect-branch-regex", "Regular expression for branch names that must never be reported for deletion (repeatable)")
+	var nameIncludes, nameExcludes stringListFlag
+	flag.Var(&nameIncludes, "filter", "Only include repositories whose name matches this glob, e.g. svc-* (repeatable)")
+	flag.Var(&nameExcludes, "filter-exclude", "Exclude repositories whose name matches this glob (repeatable)")
+	var ownerNames stringListFlag
+	flag.Var(&ownerNames, "owner", "Only include repositories owned by this username, case-insensitive (repeatable)")
+	var postHeaderValues stringListFlag
+	flag.Var(&postHeaderValues, "post-header", "Header sent with --post-url, e.g. 'Authorization: Bearer token' (repeatable)")
+
+	flag.Parse()
+	if *summaryJSON {
+		*summary = true
+		*jsonOutput = true
+	}
+	if *jsonLinesAlt {
+		*jsonLines = true
+	}
+	// --post-url builds the --json output; without --json it is only posted
+	postOnly := *postURL != "" && !*jsonOutput
+	postHeaders, err := parsePostHeaders(postHeaderValues)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	if *postURL != "" {
+		if parsed, err := neturl.Parse(*postURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			fmt.Fprintf(os.Stderr, "Error: invalid --post-url %q (expected an http or https URL)\n", *postURL)
+			os.Exit(exitConfigError)
 		}
-		// If only exclude list is specified, don't skip repos with no project
-		return false
+		if *summary || *csv || *markdown || *jsonLines || *htmlFile != "" || *output || *outputAlt || *safeDelete {
+			fmt.Fprintf(os.Stderr, "Error: --post-url sends the --json results and cannot be combined with --summary, --csv, --markdown, --jsonl, --html, --output or --safe-delete\n")
+			os.Exit(exitConfigError)
+		}
+		if postOnly && *outFile != "" {
+			fmt.Fprintf(os.Stderr, "Error: --out-file with --post-url requires --json\n")
+			os.Exit(exitConfigError)
+		}
+		*jsonOutput = true
+	} else if len(postHeaderValues) > 0 {
+		fmt.Fprintf(os.Stderr, "Error: --post-header requires --post-url\n")
+		os.Exit(exitConfigError)
 	}
 
-	// If include list is specified, only include repos in those projects
-	if len(includeList) > 0 {
-		for _, included := range includeList {
-			if strings.EqualFold(projectKey, included) || strings.EqualFold(projectName, included) {
-				return false // Don't skip - it's in an included project
+	if *noColor && *forceColor {
+		fmt.Fprintf(os.Stderr, "Error: --no-color and --force-color can't be combined\n")
+		os.Exit(exitConfigError)
+	}
+	configureColor(*noColor, *forceColor, *csv || *jsonOutput || *jsonLines || *markdown || *output || *outputAlt || *safeDelete)
+
+	// Handle version flag
+	if *versionFlag {
+		info := getVersionInfo()
+		if *jsonOutput {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(info)
+			return
+		}
+		fmt.Printf("bhunter version %s\n", info.Version)
+		if info.Commit != "unknown" {
+			fmt.Printf("Commit: %s\n", info.Commit)
+		}
+		if info.Date != "unknown" {
+			fmt.Printf("Built: %s\n", info.Date)
+		}
+		fmt.Printf("Go: %s\n", info.GoVersion)
+		fmt.Printf("Platform: %s\n", info.Platform)
+		return
+	}
+
+	if *help || *helpAlt {
+		printUsage()
+		return
+	}
+
+	// Untrusted checkouts may carry a bhunter.yaml; CI can opt out of the search
+	skipConfigFile := *noConfigFile || os.Getenv("BHUNTER_NO_CONFIG") == "1"
+	if skipConfigFile && (*configDir != "" || *configFile != "") {
+		fmt.Fprintf(os.Stderr, "Error: --config-dir and --config-file cannot be combined with --no-config-file\n")
+		os.Exit(exitConfigError)
+	}
+
+	// Comparing snapshots is offline and needs no credentials
+	if *diffAuthorFiles != "" {
+		files := parseRepoList(*diffAuthorFiles)
+		if len(files) != 2 {
+			fmt.Fprintf(os.Stderr, "Error: --diff-authors expects two snapshot files: old.json,new.json\n")
+			os.Exit(exitConfigError)
+		}
+		before, err := loadSnapshot(files[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		after, err := loadSnapshot(files[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		// Only author aliases are needed from the config here
+		var aliases map[string]string
+		if !skipConfigFile {
+			fileConfig, err := loadConfig(*configFile, *configDir)
+			if err == nil {
+				aliases = fileConfig.AuthorAliases
+			} else if !errors.Is(err, errNoConfigFile) {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitConfigError)
 			}
 		}
-		return true // Skip - not in any included project
+		displayAuthorDiff(before, after, 10, newAuthorNormalizer(*normalizeAuthors, aliases),
+			color.New(color.FgRed).SprintFunc(),
+			color.New(color.FgGreen).SprintFunc(),
+			color.New(color.FgCyan, color.Bold).SprintFunc())
+		return
 	}
 
-	// If no include list, check exclude list
-	for _, excluded := range excludeList {
-		if strings.EqualFold(projectKey, excluded) || strings.EqualFold(projectName, excluded) {
-			return true // Skip - it's in an excluded project
+	if *createConfig || *createConfigAlt {
+		createSampleConfigFile()
+		return
+	}
+	if *clearCache {
+		if err := clearResponseCache(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error clearing cache: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		fmt.Println("Response cache cleared")
+		return
+	}
+	if *cacheTTL < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --cache-ttl must not be negative\n")
+		os.Exit(exitConfigError)
+	}
+	// Use the long form flags if short form is empty
+	if *username == "" && *usernameAlt != "" {
+		*username = *usernameAlt
+	}
+	if *appPassword == "" && *appPasswordAlt != "" {
+		*appPassword = *appPasswordAlt
+	}
+	if *workspace == "" && *workspaceAlt != "" {
+		*workspace = *workspaceAlt
+	}
+	if *repoName == "" && *repoNameAlt != "" {
+		*repoName = *repoNameAlt
+	}
+	if *excludeRepos == "" && *excludeReposAlt != "" {
+		*excludeRepos = *excludeReposAlt
+	}
+	if *includeReposAlt != "" && *includeRepos == "" {
+		*includeRepos = *includeReposAlt
+	}
+
+	// Handle output flag
+	isOutputMode := *output || *outputAlt || *safeDelete
+	// Machine-readable and summary output skip the progress chatter
+	quiet := *csv || *summary || *jsonOutput || *jsonLines || *markdown
+
+	protection, err := newBranchProtection(defaultProtectedBranches, protectRegexes)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	protection.addGlobs(protectGlobs)
+
+	var repoFileNames []string
+	if *repoFile != "" {
+		if *repoName != "" {
+			fmt.Fprintf(os.Stderr, "Error: --repo-file cannot be combined with -r/--repo\n")
+			os.Exit(exitConfigError)
+		}
+		repoFileNames, err = readRepoFile(*repoFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading repository file: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	if *openRepo && *repoName == "" && *repoNameAlt == "" {
+		fmt.Fprintf(os.Stderr, "Error: --open requires -r/--repo\n")
+		os.Exit(exitConfigError)
+	}
+
+	if *branchesOnly && (!*csv || *repoOnly) {
+		fmt.Fprintf(os.Stderr, "Error: --branches-only requires --csv and cannot be combined with --repo-only\n")
+		os.Exit(exitConfigError)
+	}
+
+	exclusion := &branchCountExclusion{defaultBranch: *excludeDefault}
+	if *excludeProtect {
+		exclusion.protection = protection
+	}
+
+	ageBuckets := defaultRepoAgeBuckets
+	if *repoAgeBuckets != "" {
+		ageBuckets, err = parseBuckets(*repoAgeBuckets)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --repo-age-buckets: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	if *trendFile != "" && !*summary {
+		fmt.Fprintf(os.Stderr, "Error: --trend-file requires --summary\n")
+		os.Exit(exitConfigError)
+	}
+
+	if *listStale && !*summary {
+		fmt.Fprintf(os.Stderr, "Error: --list requires --summary\n")
+		os.Exit(exitConfigError)
+	}
+
+	if *jsonOutput && (*csv || *onlyEmptyRepos || *hygiene || *emailDomains || *duplicateBranches > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --json can't be combined with --csv, --only-empty-repos, --hygiene, --commit-email-domains or --duplicate-branches\n")
+		os.Exit(exitConfigError)
+	}
+	if *jsonLines && (*jsonOutput || *csv || *markdown || *summary || *sortBy != "" || *onlyEmptyRepos || *hygiene || *emailDomains || *duplicateBranches > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --jsonl can't be combined with --json, --csv, --markdown, --summary, --sort, --only-empty-repos, --hygiene, --commit-email-domains or --duplicate-branches\n")
+		os.Exit(exitConfigError)
+	}
+	if *htmlFile != "" && (*csv || *jsonOutput || *jsonLines || *markdown || *summary || *onlyEmptyRepos || *hygiene || *emailDomains || *duplicateBranches > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --html can't be combined with --csv, --json, --markdown, --summary, --only-empty-repos, --hygiene, --commit-email-domains or --duplicate-branches\n")
+		os.Exit(exitConfigError)
+	}
+	if *markdown && (*csv || *jsonOutput || *summary || *onlyEmptyRepos || *hygiene || *emailDomains || *duplicateBranches > 0) {
+		fmt.Fprintf(os.Stderr, "Error: --markdown can't be combined with --csv, --json, --summary, --only-empty-repos, --hygiene, --commit-email-domains or --duplicate-branches\n")
+		os.Exit(exitConfigError)
+	}
+
+	if *asOfDate != "" {
+		parsed, err := time.Parse("2006-01-02", *asOfDate)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --as-of date %q (expected YYYY-MM-DD)\n", *asOfDate)
+			os.Exit(exitConfigError)
+		}
+		// Treat the date as the end of that day so commits made on it count as not yet old
+		asOf = parsed.Add(24*time.Hour - time.Second)
+	}
+
+	var gracePeriodAge ageThreshold
+	if *gracePeriod != "" {
+		gracePeriodAge, err = parseAgeThreshold(*gracePeriod)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --stale-grace-period: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	var olderThanAge ageThreshold
+	if *olderThan != "" {
+		if *branchAgeMonths != 0 {
+			fmt.Fprintf(os.Stderr, "Error: --older-than and --branch-age-months cannot be used together\n")
+			os.Exit(exitConfigError)
+		}
+		olderThanAge, err = parseAgeThreshold(*olderThan)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --older-than: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	if *concurrency != 0 {
+		workersSet := false
+		flag.Visit(func(f *flag.Flag) {
+			workersSet = workersSet || f.Name == "workers"
+		})
+		if workersSet {
+			fmt.Fprintf(os.Stderr, "Error: --workers and --concurrency cannot be used together\n")
+			os.Exit(exitConfigError)
+		}
+		*workers = *concurrency
+	}
+	if *workers < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --workers must be at least 1\n")
+		os.Exit(exitConfigError)
+	}
+	if *maxInFlight < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-inflight must be at least 1\n")
+		os.Exit(exitConfigError)
+	}
+	if *maxInFlight == 0 {
+		*maxInFlight = *workers
+	}
+	if *rateLimit < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --rate-limit must not be negative\n")
+		os.Exit(exitConfigError)
+	}
+	if *requestTimeout < 0 || *dialTimeout < 0 || *tlsTimeout < 0 || *headerTimeout < 0 || *connectTimeout < 0 || *fetchTimeout < 0 {
+		fmt.Fprintf(os.Stderr, "Error: timeouts must not be negative\n")
+		os.Exit(exitConfigError)
+	}
+
+	csvDelimiter, err = parseDelimiter(*delimiter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+
+	// CSV and JSON output go to out, which --out-file redirects to a file
+	var out io.Writer = os.Stdout
+	if *appendOut && *outFile == "" {
+		fmt.Fprintf(os.Stderr, "Error: --append requires --out-file\n")
+		os.Exit(exitConfigError)
+	}
+	if *outFile != "" {
+		if !*csv && !*jsonOutput && !*jsonLines && !*markdown {
+			fmt.Fprintf(os.Stderr, "Error: --out-file requires --csv, --json, --jsonl or --markdown\n")
+			os.Exit(exitConfigError)
+		}
+		mode := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if *appendOut {
+			mode = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		file, err := os.OpenFile(*outFile, mode, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error opening output file: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		if info, err := file.Stat(); err == nil && *appendOut && info.Size() > 0 {
+			csvAppending = true
+		}
+		outputFile = file
+		out = file
+	}
+	// --post-url collects the JSON results to send once they are complete,
+	// still writing them to out when --json was asked for too
+	var posted *bytes.Buffer
+	jsonOut := out
+	if *postURL != "" {
+		posted = &bytes.Buffer{}
+		jsonOut = posted
+		if !postOnly {
+			jsonOut = io.MultiWriter(out, posted)
+		}
+	}
+
+	jitter, err := parseBackoffJitter(*backoffJitter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+
+	repoNameFilter, err := newNameFilter(nameIncludes, nameExcludes, *filterRegex)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+
+	descFilter := &descriptionFilter{terms: parseRepoList(*descContains)}
+	if *descRegex != "" {
+		descFilter.regex, err = regexp.Compile(*descRegex)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --description-regex: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	repoDateFilter, err := newDateFilter(*createdAfter, *createdBefore, *updatedAfter, *updatedBefore)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+
+	var staleRatio float64
+	if *minStaleRatio != "" {
+		staleRatio, err = parseRatio(*minStaleRatio)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --min-stale-ratio: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	var sortKey string
+	if *sortBy != "" {
+		sortKey, err = parseSortKey(*sortBy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	} else if *reverseSort {
+		fmt.Fprintf(os.Stderr, "Error: --reverse requires --sort\n")
+		os.Exit(exitConfigError)
+	}
+	if sortKey == "risk" && *repoOnly {
+		fmt.Fprintf(os.Stderr, "Error: --sort risk needs branch details and cannot be combined with --repo-only\n")
+		os.Exit(exitConfigError)
+	}
+
+	var roleFilter string
+	if *role != "" {
+		roleFilter, err = parseRole(*role)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+
+	var modifiedSinceDate time.Time
+	if *modifiedSince != "" {
+		parsed, err := time.Parse("2006-01-02", *modifiedSince)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: invalid --repos-modified-since date %q (expected YYYY-MM-DD)\n", *modifiedSince)
+			os.Exit(exitConfigError)
 		}
+		modifiedSinceDate = parsed
 	}
 
-	return false // Don't skip - not excluded
-}
+	if *onlyEmptyRepos && (*repoName != "" || *summary || *branchesOnly || *snapshotFile != "") {
+		fmt.Fprintf(os.Stderr, "Error: --only-empty-repos lists the whole workspace and can't be combined with -r, --summary, --branches-only or --snapshot\n")
+		os.Exit(exitConfigError)
+	}
 
-func main() {
-	// Start timing the operation
-	startTime := time.Now()
+	if *hygiene && (*repoName != "" || *summary || *branchesOnly || *snapshotFile != "" || *onlyEmptyRepos) {
+		fmt.Fprintf(os.Stderr, "Error: --hygiene audits the whole workspace and can't be combined with -r, --summary, --branches-only, --snapshot or --only-empty-repos\n")
+		os.Exit(exitConfigError)
+	}
 
-	var (
-		username        = flag.String("u", "", "Bitbucket username")
-		usernameAlt     = flag.String("username", "", "Bitbucket username")
-		appPassword     = flag.String("p", "", "Bitbucket app password")
-		appPasswordAlt  = flag.String("password", "", "Bitbucket app password")
-		workspace       = flag.String("w", "", "Bitbucket workspace (optional, defaults to username)")
-		workspaceAlt    = flag.String("workspace", "", "Bitbucket workspace (optional)")
-		repoName        = flag.String("r", "", "Repository name (optional, analyze only this repo)")
-		repoNameAlt     = flag.String("repo", "", "Repository name (optional)")
-		excludeRepos    = flag.String("exclude", "", "Comma-separated list of project keys/names to exclude")
-		excludeReposAlt = flag.String("e", "", "Comma-separated list of project keys/names to exclude")
-		includeRepos    = flag.String("include", "", "Comma-separated list of project keys/names to include (only these will be analyzed)")
-		includeReposAlt = flag.String("i", "", "Comma-separated list of project keys/names to include (only these will be analyzed)")
-		repoOnly        = flag.Bool("repo-only", false, "Show only repository information (no branch details)")
-		output          = flag.Bool("o", false, "Output old branch names (>6 months) for piping to bkiller")
-		outputAlt       = flag.Bool("output", false, "Output old branch names (>6 months) for piping to bkiller")
-		csv             = flag.Bool("csv", false, "Output repository information in CSV format")
-		summary         = flag.Bool("summary", false, "Show summary statistics (repos, branches, old branches)")
-		createConfig    = flag.Bool("c", false, "Create sample config file")
-		createConfigAlt = flag.Bool("config", false, "Create sample config file")
-		help            = flag.Bool("h", false, "Show help")
-		helpAlt         = flag.Bool("help", false, "Show help")
-		versionFlag     = flag.Bool("version", false, "Show version information")
-	)
+	if *emailDomains && (*repoName != "" || *summary || *branchesOnly || *snapshotFile != "" || *onlyEmptyRepos || *hygiene) {
+		fmt.Fprintf(os.Stderr, "Error: --commit-email-domains reports on the whole workspace and can't be combined with -r, --summary, --branches-only, --snapshot, --only-empty-repos or --hygiene\n")
+		os.Exit(exitConfigError)
+	}
+	if *duplicateBranches < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --duplicate-branches must be at least 1\n")
+		os.Exit(exitConfigError)
+	}
+	if *duplicateBranches > 0 && (*repoName != "" || *summary || *branchesOnly || *snapshotFile != "" || *onlyEmptyRepos || *hygiene || *emailDomains) {
+		fmt.Fprintf(os.Stderr, "Error: --duplicate-branches compares the whole workspace and can't be combined with -r, --summary, --branches-only, --snapshot, --only-empty-repos, --hygiene or --commit-email-domains\n")
+		os.Exit(exitConfigError)
+	}
+	if *emailSample < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --email-sample must be at least 1\n")
+		os.Exit(exitConfigError)
+	}
 
-	flag.Parse()
+	if *maxRepoPages < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-repo-pages must be at least 1\n")
+		os.Exit(exitConfigError)
+	}
+	if *maxRepoPages > 0 && *cursorFile == "" && *continueFrom == "" {
+		fmt.Fprintf(os.Stderr, "Error: --max-repo-pages requires --cursor-file or --continue-from so the scan can be resumed\n")
+		os.Exit(exitConfigError)
+	}
+	if *pageLen < 1 || *pageLen > pageSize {
+		fmt.Fprintf(os.Stderr, "Error: --page-len must be between 1 and %d\n", pageSize)
+		os.Exit(exitConfigError)
+	}
+	if *maxRepos < 0 || *maxBranches < 0 || *creatorPages < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --max-repos, --max-branches and --creator-pages must not be negative\n")
+		os.Exit(exitConfigError)
+	}
 
-	// Handle version flag
-	if *versionFlag {
-		fmt.Printf("bhunter version %s\n", version)
-		if commit != "unknown" {
-			fmt.Printf("Commit: %s\n", commit)
+	if *groupByProj {
+		if *groupBy != "" && *groupBy != "project" {
+			fmt.Fprintf(os.Stderr, "Error: --group-by-project and --group-by %s cannot be used together\n", *groupBy)
+			os.Exit(exitConfigError)
 		}
-		if date != "unknown" {
-			fmt.Printf("Built: %s\n", date)
-		}
-		return
+		*groupBy = "project"
 	}
-
-	if *help || *helpAlt {
-		printUsage()
-		return
+	switch *groupBy {
+	case "":
+	case "creator":
+		if quiet || *noCreator || *repoName != "" {
+			fmt.Fprintf(os.Stderr, "Error: --group-by creator needs the full display of all repositories with creators (not --csv, --summary, --no-creator or -r)\n")
+			os.Exit(exitConfigError)
+		}
+	case "project":
+		if quiet || *repoName != "" {
+			fmt.Fprintf(os.Stderr, "Error: --group-by project needs the full display of all repositories (not --csv, --summary or -r)\n")
+			os.Exit(exitConfigError)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Error: invalid --group-by %q (valid: creator, project)\n", *groupBy)
+		os.Exit(exitConfigError)
 	}
 
-	if *createConfig || *createConfigAlt {
-		createSampleConfigFile()
-		return
+	if *safeDelete && *mergedOnly {
+		fmt.Fprintf(os.Stderr, "Error: --safe-delete and --merged-only cannot be used together\n")
+		os.Exit(exitConfigError)
 	}
-	// Use the long form flags if short form is empty
-	if *username == "" && *usernameAlt != "" {
-		*username = *usernameAlt
+	selection := selectStale
+	if *mergedOnly {
+		selection = selectMerged
+	} else if *safeDelete {
+		selection = selectNotAhead
 	}
-	if *appPassword == "" && *appPasswordAlt != "" {
-		*appPassword = *appPasswordAlt
+	if *mergedOnly && !isOutputMode {
+		fmt.Fprintf(os.Stderr, "Error: --merged-only requires --output\n")
+		os.Exit(exitConfigError)
 	}
-	if *workspace == "" && *workspaceAlt != "" {
-		*workspace = *workspaceAlt
+	if *preview && !isOutputMode {
+		fmt.Fprintf(os.Stderr, "Error: --preview requires --output\n")
+		os.Exit(exitConfigError)
 	}
-	if *repoName == "" && *repoNameAlt != "" {
-		*repoName = *repoNameAlt
+	if *interactive {
+		if !isOutputMode || *preview {
+			fmt.Fprintf(os.Stderr, "Error: --interactive requires --output and can't be combined with --preview\n")
+			os.Exit(exitConfigError)
+		}
+		if !stdinIsTerminal() {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", errNotInteractive)
+			os.Exit(exitConfigError)
+		}
 	}
-	if *excludeRepos == "" && *excludeReposAlt != "" {
-		*excludeRepos = *excludeReposAlt
+
+	if *timelineMonths < 1 {
+		fmt.Fprintf(os.Stderr, "Error: --timeline-months must be at least 1\n")
+		os.Exit(exitConfigError)
 	}
-	if *includeReposAlt != "" && *includeRepos == "" {
-		*includeRepos = *includeReposAlt
+	if *minCommits < 0 || *maxCommits < 0 || (*maxCommits > 0 && *minCommits > *maxCommits) {
+		fmt.Fprintf(os.Stderr, "Error: invalid commit range (--min-commits %d, --max-commits %d)\n", *minCommits, *maxCommits)
+		os.Exit(exitConfigError)
 	}
 
-	// Handle output flag
-	isOutputMode := *output || *outputAlt
-
 	var config *Config // Try to load from config file first
-	if *username == "" || *appPassword == "" {
-		fileConfig, err := loadConfigFromFile()
+	// An explicitly named config file is always loaded; discovered ones only
+	// when the credentials aren't all on the command line
+	if *configFile != "" || (!skipConfigFile && *accessToken == "" && (*username == "" || *appPassword == "")) {
+		fileConfig, err := loadConfig(*configFile, *configDir)
 		if err == nil {
 			config = fileConfig
-			if !isOutputMode && !*csv && !*summary {
+			if !isOutputMode && !quiet {
 				fmt.Printf("Loaded configuration from file\n")
 			}
+		} else if !errors.Is(err, errNoConfigFile) {
+			// A config file exists but is broken - don't silently fall back
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
 		}
 	}
 
@@ -809,56 +4515,325 @@ func main() {
 	if *appPassword != "" {
 		config.AppPassword = *appPassword
 	}
+	if *accessToken != "" {
+		config.AccessToken = *accessToken
+	}
+	if *baseURL != "" {
+		config.BaseURL = *baseURL
+	}
+	if *providerName != "" {
+		config.Provider = *providerName
+	}
+	if *proxyURL != "" {
+		config.Proxy = *proxyURL
+	}
+	provider, err := parseProvider(config.Provider)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
 	if *workspace != "" {
+		// Workspaces from the command line replace the configured ones
 		config.Workspace = *workspace
+		config.Workspaces = nil
+	}
+	if *retryOn != "" {
+		config.RetryOn = *retryOn
+	}
+	if *branchAgeMonths != 0 {
+		config.BranchAgeMonths = *branchAgeMonths
+	}
+	if *repoAgeMonths != 0 {
+		config.RepoAgeMonths = *repoAgeMonths
+	}
+	// Configured protected branches extend the command line set
+	protection.addGlobs(config.ProtectedBranches)
+	if config.BranchAgeMonths < 0 || config.RepoAgeMonths < 0 {
+		fmt.Fprintf(os.Stderr, "Error: --branch-age-months and --repo-age-months must be positive\n")
+		os.Exit(exitConfigError)
+	}
+	if config.BranchAgeMonths == 0 {
+		config.BranchAgeMonths = defaultBranchAgeMonths
+	}
+	if config.RepoAgeMonths == 0 {
+		config.RepoAgeMonths = defaultRepoAgeMonths
+	}
+	if *keyringService != "" {
+		config.KeyringService = *keyringService
+	}
+	if config.KeyringService == "" {
+		config.KeyringService = defaultKeyringService
 	}
 	// Validate required fields
-	if config.Username == "" || config.AppPassword == "" {
-		if !isOutputMode {
-			fmt.Println("Error: Username and app password are required")
-			fmt.Println("\nOptions:")
-			fmt.Println("1. Use command line: bhunter -u username -p app_password")
-			fmt.Println("2. Create config file: bhunter -c")
-			fmt.Println("3. Use environment variables: BITBUCKET_USERNAME, BITBUCKET_APP_PASSWORD, BITBUCKET_WORKSPACE")
-			fmt.Println("\nFor help: bhunter -h")
-		}
-		// Fallback to environment variables
+	if config.AccessToken == "" && (config.Username == "" || config.AppPassword == "") {
+		// Fallback to environment variables, then the OS keychain
+		envToken := os.Getenv(providerTokenEnv[provider])
 		envUsername := os.Getenv("BITBUCKET_USERNAME")
 		envPassword := os.Getenv("BITBUCKET_APP_PASSWORD")
 		envWorkspace := os.Getenv("BITBUCKET_WORKSPACE")
-		if envUsername != "" && envPassword != "" {
-			config.Username = envUsername
-			config.AppPassword = envPassword
+		if envToken != "" || (envUsername != "" && envPassword != "") {
+			if envToken != "" {
+				config.AccessToken = envToken
+			} else {
+				config.Username = envUsername
+				config.AppPassword = envPassword
+			}
 			if envWorkspace != "" {
 				config.Workspace = envWorkspace
+				config.Workspaces = nil
 			}
-			if !isOutputMode && !*csv && !*summary {
+			if !isOutputMode && !quiet {
 				fmt.Println("\nUsing environment variables...")
 			}
+		} else if loadKeyringCredentials(config.KeyringService, provider, config) {
+			if envWorkspace != "" && config.Workspace == "" && len(config.Workspaces) == 0 {
+				config.Workspace = envWorkspace
+			}
+			if !isOutputMode && !quiet {
+				fmt.Println("Using credentials from the OS keychain...")
+			}
 		} else {
-			os.Exit(1)
+			if !isOutputMode {
+				fmt.Println("Error: An access token, or a username and app password, are required")
+				fmt.Println("\nOptions:")
+				fmt.Println("1. Use command line: bhunter -u username -p app_password, or bhunter --access-token token -w workspace")
+				fmt.Println("2. Create config file: bhunter -c")
+				fmt.Println("3. Use environment variables: BITBUCKET_ACCESS_TOKEN or BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD, plus BITBUCKET_WORKSPACE")
+				fmt.Println("4. Store them in the OS keychain: bhunter -u username -p app_password --save-credentials")
+				fmt.Println("\nFor help: bhunter -h")
+			}
+			os.Exit(exitConfigError)
+		}
+	}
+	if *saveCredentials {
+		if err := saveKeyringCredentials(config.KeyringService, provider, config); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "Saved credentials to the OS keychain (service %s)\n", config.KeyringService)
+		}
+	}
+	workspaces := mergeWorkspaces(config.Workspace, config.Workspaces)
+	if len(workspaces) > 0 {
+		config.Workspace = workspaces[0]
+	}
+	var client *BitbucketClient
+	if provider != providerBitbucket && config.AccessToken == "" {
+		fmt.Fprintf(os.Stderr, "Error: --provider %s requires an access token (--access-token, access_token in the config file or %s)\n", provider, providerTokenEnv[provider])
+		os.Exit(exitConfigError)
+	}
+	if config.AccessToken != "" {
+		// A token has no username to default the workspace to
+		workspaceName := config.Workspace
+		if workspaceName == "" {
+			workspaceName = config.Username
+		}
+		if workspaceName == "" {
+			fmt.Fprintf(os.Stderr, "Error: a workspace is required with access token authentication (-w or workspace in the config file)\n")
+			os.Exit(exitConfigError)
+		}
+		client = NewBitbucketClientWithToken(config.AccessToken, workspaceName)
+	} else {
+		// Only app passwords are being deprecated
+		deprecated, err := checkAppPasswordDeprecation(config, *noDeprecationWarning)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		if deprecated && *failOnDeprecated {
+			fmt.Fprintf(os.Stderr, "Error: app password authentication is past its deprecation date (--fail-on-deprecated)\n")
+			os.Exit(exitConfigError)
+		}
+		client = NewBitbucketClient(config.Username, config.AppPassword, config.Workspace)
+	}
+	if err := client.setProvider(provider, config.BaseURL); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	service := providerNames[provider]
+	if _, ok := client.flavor.(dataCenterFlavor); ok {
+		service = "Bitbucket Data Center"
+	}
+	err = flavorFlagError(client.flavor, service, []flavorFeature{
+		{"--with-prs", *withPRs, cloudOnly},
+		{"--merge-base", *mergeBase, findsMergeBases},
+		{"--check-merged", *checkMerged, findsMergeBases},
+		{"--merged-only", *mergedOnly, findsMergeBases},
+		{"--hygiene", *hygiene, cloudOnly},
+		{"--ahead-behind", *aheadBehind, comparesBranches},
+		{"--safe-delete", *safeDelete, comparesBranches},
+		{"--stale-grace-period", !gracePeriodAge.isZero(), listsBranchCommits},
+		{"--branch-creators", *branchCreators, listsBranchCommits},
+		{"--owner", len(ownerNames) > 0, reportsOwners},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	if len(workspaces) > 0 {
+		client.setWorkspaces(workspaces)
+	}
+	if err := client.setProxy(config.Proxy); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	timeouts, err := parseHTTPTimeouts(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitConfigError)
+	}
+	// Command line timeouts override the config file; the specific flags win
+	// over the --connect-timeout shorthand and --timeout over --fetch-timeout
+	if *connectTimeout > 0 {
+		timeouts.dial = *connectTimeout
+		timeouts.tlsHandshake = *connectTimeout
+		timeouts.responseHeader = *connectTimeout
+	}
+	for _, override := range []struct {
+		value time.Duration
+		field *time.Duration
+	}{
+		{*fetchTimeout, &timeouts.request},
+		{*requestTimeout, &timeouts.request},
+		{*dialTimeout, &timeouts.dial},
+		{*tlsTimeout, &timeouts.tlsHandshake},
+		{*headerTimeout, &timeouts.responseHeader},
+	} {
+		if override.value > 0 {
+			*override.field = override.value
+		}
+	}
+	client.setTimeouts(timeouts)
+	client.setWorkers(*workers)
+	client.setMaxInFlight(*maxInFlight)
+	client.limiter = newRateLimiter(*rateLimit)
+	client.showStats = *runStats || *runStatsAlt
+	client.pageLen = *pageLen
+	client.maxRepos = *maxRepos
+	client.maxBranches = *maxBranches
+	client.creatorPages = *creatorPages
+	if *cacheTTL > 0 && !*noCache {
+		client.cache, err = newResponseCache(*cacheTTL, client.cacheIdentity())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+	}
+	client.role = roleFilter
+	client.jitter = jitter
+	if *retryLogFile != "" {
+		client.retryLog, err = newRetryLogger(*retryLogFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating retry log: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		defer client.retryLog.Close()
+	}
+	if (*cursorFile != "" || *continueFrom != "") && len(client.workspaces) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: --cursor-file and --continue-from work with a single workspace\n")
+		os.Exit(exitConfigError)
+	}
+	if *cursorFile != "" || *continueFrom != "" {
+		// Resuming keeps updating the same cursor file unless told otherwise
+		client.cursor = &listingCursor{path: *cursorFile, maxPages: *maxRepoPages}
+		if *continueFrom != "" {
+			if client.cursor.path == "" {
+				client.cursor.path = *continueFrom
+			}
+			client.cursor.resumeURL, err = loadCursor(*continueFrom)
+			if err == nil {
+				err = validateCursor(client.cursor.resumeURL, client.flavor, client.baseURL, client.workspace)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitConfigError)
+			}
+		}
+	}
+	policy := &stalePolicy{
+		client:      client,
+		branchAge:   monthsAge(config.BranchAgeMonths),
+		repoMonths:  config.RepoAgeMonths,
+		gracePeriod: gracePeriodAge,
+		withPRs:     *withPRs,
+	}
+	if *olderThan != "" {
+		policy.branchAge = olderThanAge
+	}
+	normalizer := newAuthorNormalizer(*normalizeAuthors, config.AuthorAliases)
+	if *anonymize || *anonymizeSeed != "" {
+		client.anonymizer, err = newAnonymizer(*anonymizeSeed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error initializing anonymizer: %v\n", err)
+			os.Exit(exitConfigError)
 		}
 	}
-	client := NewBitbucketClient(config.Username, config.AppPassword, config.Workspace)
 
-	if !isOutputMode && !*csv && !*summary {
-		fmt.Printf("Connecting to Bitbucket workspace: %s\n", client.workspace)
+	// fetchRepositories lists the workspace, honoring --repos-modified-since,
+	// or looks up the repositories named in --repo-file
+	fetchRepositories := func() ([]Repository, error) {
+		if len(repoFileNames) > 0 {
+			return client.getRepositoriesByName(ctx, repoFileNames, *workers), nil
+		}
+		if !modifiedSinceDate.IsZero() {
+			return client.getRepositoriesModifiedSince(ctx, modifiedSinceDate)
+		}
+		return client.getRepositories(ctx, "")
+	}
+	if config.RetryOn != "" {
+		policy, err := parseRetryOn(config.RetryOn)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		client.retryOn = policy
+	}
+	if config.MaxRetries != nil {
+		if *config.MaxRetries < 0 {
+			fmt.Fprintf(os.Stderr, "Error: max_retries must not be negative\n")
+			os.Exit(exitConfigError)
+		}
+		client.maxRetries = *config.MaxRetries
+	}
+	if config.RetryBaseDelay != "" {
+		delay, err := time.ParseDuration(config.RetryBaseDelay)
+		if err != nil || delay <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: invalid retry_base_delay %q (expected a duration such as 500ms or 2s)\n", config.RetryBaseDelay)
+			os.Exit(exitConfigError)
+		}
+		client.retryBaseDelay = delay
+	}
+
+	if *validateOnly {
+		os.Exit(validateCredentials(ctx, client, os.Stdout))
+	}
+
+	if !isOutputMode && !quiet {
+		if len(client.workspaces) > 1 {
+			fmt.Printf("Connecting to %s workspaces: %s\n", providerNames[client.provider], strings.Join(client.workspaces, ", "))
+		} else {
+			fmt.Printf("Connecting to %s workspace: %s\n", providerNames[client.provider], client.workspace)
+		}
 	}
 
 	// Handle output mode (for piping to bkiller)
 	if isOutputMode {
+		var outputRepos []Repository
 		if *repoName != "" {
 			// Single repository
-			repo, err := client.getRepository(*repoName)
+			repo, err := client.getRepository(ctx, *repoName)
 			if err != nil {
-				os.Exit(1)
+				os.Exit(exitCodeForError(err))
+			}
+			if repoDateFilter.matches(*repo) && len(filterByOwner([]Repository{*repo}, ownerNames, client.anonymizer)) > 0 {
+				outputRepos = []Repository{*repo}
 			}
-			outputOldBranches(*repo, client)
 		} else {
 			// All repositories
-			repos, err := client.getRepositories()
+			repos, err := fetchRepositories()
 			if err != nil {
-				os.Exit(1)
+				os.Exit(exitCodeForError(err))
 			}
 
 			// Parse filters for output mode
@@ -868,13 +4843,49 @@ func main() {
 			// Filter repositories in output mode too
 			for _, repo := range repos {
 				if !shouldSkipRepo(repo, includeList, excludeList) {
-					outputOldBranches(repo, client)
+					outputRepos = append(outputRepos, repo)
 				}
 			}
+			if *excludeArchived {
+				outputRepos = filterArchived(outputRepos)
+			}
+			outputRepos = filterByOwner(outputRepos, ownerNames, client.anonymizer)
+			outputRepos = filterByName(outputRepos, repoNameFilter)
+			outputRepos = filterByDescription(outputRepos, descFilter)
+			outputRepos = filterByDate(outputRepos, repoDateFilter)
+			outputRepos = filterByCommitCount(ctx, outputRepos, client, *minCommits, *maxCommits, *workers)
+			if *minStaleRatio != "" {
+				outputRepos = filterByStaleRatio(ctx, outputRepos, client, policy, staleRatio, *workers)
+			}
+		}
+
+		if *interactive {
+			// Prompts go to stderr so only the chosen branches reach bkiller
+			var candidates []branchCandidate
+			for _, repo := range outputRepos {
+				candidates = append(candidates, oldBranchCandidates(ctx, repo, client, protection, policy, selection)...)
+			}
+			selected := selectBranchesInteractively(candidates, *outputTemplate, os.Stdin, os.Stderr, os.Stdout)
+			fmt.Fprintf(os.Stderr, "\n%d of %d branches selected for deletion\n", selected, len(candidates))
+		} else {
+			candidates := 0
+			for _, repo := range outputRepos {
+				candidates += outputOldBranches(ctx, repo, client, *outputTemplate, protection, policy, selection, *preview)
+			}
+			if *preview {
+				fmt.Printf("\n%d branches would be sent to bkiller\n", candidates)
+			}
 		}
-		// Don't show timing in output mode (used for piping)
+		// Don't show timing in output mode (used for piping); failures go to stderr
+		exitIfPartial(client)
 		return
 	}
+	csvCols := csvColumns{displayName: len(config.NameMap) > 0, workspace: len(client.workspaces) > 1, openPRs: *withPRs, commitStats: *commitStatsFlag, tags: *withTags, aheadBehind: *aheadBehind, truncated: *maxBranches > 0}
+	dispOpts := displayOptions{repoOnly: *repoOnly, mergeBase: *mergeBase, hideRecent: *hideRecent, ascii: *noColor, sortBranches: *sortBy != "", checkMerged: *checkMerged, protection: protection, withPRs: *withPRs, commitStats: *commitStatsFlag && *verbose, tags: *withTags, riskScore: *verbose, creators: *branchCreators}
+	if *timeline {
+		dispOpts.timeline = *timelineMonths
+	}
+
 	yellow := color.New(color.FgYellow).SprintFunc()
 	red := color.New(color.FgRed).SprintFunc()
 	bold := color.New(color.Bold).SprintFunc()
@@ -889,64 +4900,157 @@ func main() {
 	}
 	// If specific repo requested, fetch only that repo
 	if *repoName != "" {
-		if !*csv && !*summary {
+		if !quiet {
 			fmt.Printf("Fetching repository: %s (%s)\n", *repoName, outputMode)
 		}
-		repo, err := client.getRepository(*repoName)
+		repo, err := client.getRepository(ctx, *repoName)
 		if err != nil {
-			if !*csv && !*summary {
+			exitIfInterrupted(ctx)
+			if !quiet {
 				fmt.Printf("Error fetching repository '%s': %v\n", *repoName, err)
 				fmt.Println("\nTip: Repository name is case-sensitive. Try listing all repos first:")
 				fmt.Println("     bhunter --repo-only")
 			}
-			os.Exit(1)
+			os.Exit(exitCodeForError(err))
+		}
+
+		if !repoDateFilter.matches(*repo) {
+			fmt.Fprintf(os.Stderr, "Repository %s is outside the created/updated date range\n", repo.FullName)
+			exitIfPartial(client)
+			return
+		}
+		if len(filterByOwner([]Repository{*repo}, ownerNames, client.anonymizer)) == 0 {
+			fmt.Fprintf(os.Stderr, "Repository %s isn't owned by %s\n", repo.FullName, strings.Join(ownerNames, ", "))
+			exitIfPartial(client)
+			return
+		}
+
+		nameRepository(repo, config.NameMap)
+		if !quiet {
+			fmt.Printf("\nFound repository: %s\n", repo.DisplayName())
+			if repo.RenamedFrom != "" {
+				fmt.Printf("Note: '%s' has been renamed or moved to %s\n", repo.RenamedFrom, repo.FullName)
+			}
 		}
 
-		if !*csv && !*summary {
-			fmt.Printf("\nFound repository: %s\n", repo.Name)
+		if *openRepo {
+			repoURL := repo.Links.HTML.Href
+			if repoURL == "" {
+				repoURL = client.flavor.repositoryWebURL(client.baseURL, repo.FullName)
+			}
+			fmt.Println(repoURL)
+			// On headless systems printing the URL is all we can do
+			if err := openInBrowser(repoURL); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: couldn't open a browser: %v\n", err)
+			}
+			exitIfPartial(client)
+			return
 		}
-		// Get creator for single repository
-		creator := "(unable to determine)"
-		firstCommit, err := client.getFirstCommit(repo.FullName)
-		if err == nil && firstCommit.Author.User.DisplayName != "" {
-			creator = firstCommit.Author.User.DisplayName
+
+		if *snapshotFile != "" {
+			saveSnapshot(*snapshotFile, buildSnapshot(ctx, []Repository{*repo}, client, policy, *workers))
+			exitIfPartial(client)
+			return
 		}
+		// Get creator for single repository through the same pipeline as the multi-repo path
+		resolveCreator := !*noCreator && !*branchesOnly && (!*summary || *summaryCreators)
+		result := processRepositoriesConcurrently(ctx, []Repository{*repo}, client, 1, resolveCreator, !*repoOnly, nil)[0]
+		exitIfInterrupted(ctx)
 
 		if *summary {
 			// Create a slice with just this repository for summary calculation
 			repos := []Repository{*repo}
-			stats, err := calculateSummaryStats(repos, client)
-			if err != nil {
-				fmt.Printf("Error calculating summary statistics: %v\n", err)
-				os.Exit(1)
+			stats, err := calculateSummaryStats(ctx, repos, client, policy, exclusion, *repoOnly, ageBuckets, *workers)
+			exitOnSummaryError(err)
+			warnSampledSummary(os.Stderr, stats, client)
+			if *summaryCreators {
+				addCreatorBreakdown(stats, []RepositoryResult{result}, policy, normalizer)
+			}
+			if *listStale {
+				addStaleLists(ctx, stats, repos, client, policy, *repoOnly)
+			}
+			if *withPRs {
+				addPullRequestStats(ctx, stats, repos, client, policy)
+			}
+			if *withTags {
+				addTagStats(ctx, stats, repos, client, *workers)
+			}
+			if *trendFile != "" {
+				if err := appendSummaryTrend(*trendFile, stats, repo.FullName); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing trend file: %v\n", err)
+					os.Exit(exitConfigError)
+				}
+			}
+			if *jsonOutput {
+				if err := outputSummaryJSON(out, stats, repo.FullName); err != nil {
+					fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+					os.Exit(exitConfigError)
+				}
+			} else {
+				displaySummaryStats(stats, repo.FullName, yellow, red, green, cyan)
+				if *listStale {
+					displayStaleLists(stats, *repoOnly, yellow, red, cyan)
+				}
+			}
+		} else if *jsonLines {
+			if err := outputResultJSONLine(ctx, out, result, client, policy, *repoOnly, *commitStatsFlag, *aheadBehind); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+				os.Exit(exitConfigError)
+			}
+		} else if *jsonOutput {
+			if err := outputResultsJSON(ctx, jsonOut, []RepositoryResult{result}, client, policy, *repoOnly, *commitStatsFlag, *aheadBehind); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+				os.Exit(exitConfigError)
+			}
+			if posted != nil {
+				if err := client.postResults(ctx, *postURL, postHeaders, posted.Bytes()); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					os.Exit(exitAPIError)
+				}
 			}
-			displaySummaryStats(stats, yellow, red, green, cyan)
+		} else if *markdown {
+			exitOnMarkdownError(outputResultsMarkdown(ctx, out, repo.FullName, []RepositoryResult{result}, client, policy, *repoOnly))
+		} else if *htmlFile != "" {
+			stats, err := calculateSummaryStats(ctx, []Repository{*repo}, client, policy, exclusion, *repoOnly, ageBuckets, *workers)
+			exitOnSummaryError(err)
+			warnSampledSummary(os.Stderr, stats, client)
+			saveHTMLReport(*htmlFile, buildHTMLReport(ctx, repo.FullName, []RepositoryResult{result}, client, policy, stats, *repoOnly))
+		} else if *csv && *branchesOnly {
+			exitOnCSVError(outputBranchesCSVHeader(out, *checkMerged, *aheadBehind))
+			exitOnCSVError(outputBranchesCSV(ctx, out, result, client, policy, *checkMerged, *aheadBehind))
 		} else if *csv {
-			outputCSVHeader()
-			outputRepositoryCSV(*repo, creator, client, *repoOnly)
+			exitOnCSVError(outputCSVHeader(out, csvCols))
+			exitOnCSVError(outputRepositoryCSV(ctx, out, result, client, policy, *repoOnly, csvCols))
 		} else {
-			displayRepositoryInfo(*repo, creator, client, yellow, red, bold, green, cyan, *repoOnly)
+			displayRepositoryInfo(ctx, result, client, policy, yellow, red, bold, green, cyan, dispOpts)
+		}
+		if *verbose {
+			printRepoCost(client, *repo)
 		}
 
 		// Show elapsed time for single repository analysis
 		elapsed := time.Since(startTime)
-		if !*csv && !*summary {
+		if !quiet {
 			fmt.Printf("\nOperation completed in %v\n", elapsed)
 		}
+		exitIfPartial(client)
 		return
 	}
 	// Otherwise, fetch all repositories
-	if !*csv && !*summary {
+	if !quiet {
 		fmt.Printf("Fetching repositories (%s)...\n", outputMode)
 	}
-	repos, err := client.getRepositories()
+	repos, err := fetchRepositories()
 	if err != nil {
-		if !*csv && !*summary {
+		exitIfInterrupted(ctx)
+		if !quiet {
 			fmt.Printf("Error fetching repositories: %v\n", err)
 		}
-		os.Exit(1)
+		os.Exit(exitCodeForError(err))
 	}
 
+	applyNameMap(repos, config.NameMap)
+
 	// Parse filters and apply repository filtering
 	excludeList := parseRepoList(*excludeRepos)
 	includeList := parseRepoList(*includeRepos)
@@ -966,7 +5070,7 @@ func main() {
 		}
 	}
 
-	if !*csv && !*summary && filteredCount > 0 {
+	if !quiet && filteredCount > 0 {
 		if len(includeList) > 0 {
 			fmt.Printf("Filtered to %d repositories from included projects\n", len(filteredRepos))
 		} else {
@@ -975,38 +5079,281 @@ func main() {
 	}
 	repos = filteredRepos
 
-	if !*csv && !*summary {
+	if *excludeArchived {
+		beforeCount := len(repos)
+		repos = filterArchived(repos)
+		if !quiet {
+			fmt.Printf("Excluded %d archived repositories\n", beforeCount-len(repos))
+		}
+	}
+
+	if len(ownerNames) > 0 {
+		beforeCount := len(repos)
+		repos = filterByOwner(repos, ownerNames, client.anonymizer)
+		if !quiet {
+			fmt.Printf("Excluded %d repositories not owned by %s\n", beforeCount-len(repos), strings.Join(ownerNames, ", "))
+		}
+	}
+
+	if repoNameFilter.active() {
+		beforeCount := len(repos)
+		repos = filterByName(repos, repoNameFilter)
+		if !quiet {
+			fmt.Printf("Excluded %d repositories not matching the name filter\n", beforeCount-len(repos))
+		}
+	}
+
+	if descFilter.active() {
+		beforeCount := len(repos)
+		repos = filterByDescription(repos, descFilter)
+		if !quiet {
+			fmt.Printf("Excluded %d repositories not matching the description filter\n", beforeCount-len(repos))
+		}
+	}
+
+	if repoDateFilter.active() {
+		beforeCount := len(repos)
+		repos = filterByDate(repos, repoDateFilter)
+		if !quiet {
+			fmt.Printf("Excluded %d repositories outside the created/updated date range\n", beforeCount-len(repos))
+		}
+	}
+
+	if *minCommits > 0 || *maxCommits > 0 {
+		if !quiet {
+			fmt.Printf("Counting commits to apply commit range filter...\n")
+		}
+		beforeCount := len(repos)
+		repos = filterByCommitCount(ctx, repos, client, *minCommits, *maxCommits, *workers)
+		if !quiet {
+			fmt.Printf("Excluded %d repositories outside the commit range\n", beforeCount-len(repos))
+		}
+	}
+
+	if *minStaleRatio != "" {
+		if !quiet {
+			fmt.Printf("Classifying branches to apply stale ratio filter...\n")
+		}
+		beforeCount := len(repos)
+		repos = filterByStaleRatio(ctx, repos, client, policy, staleRatio, *workers)
+		if !quiet {
+			fmt.Printf("Excluded %d repositories at or below a %.0f%% stale branch ratio\n", beforeCount-len(repos), staleRatio*100)
+		}
+	}
+
+	if *onlyEmptyRepos {
+		if !*csv {
+			fmt.Printf("Checking %d repositories for content...\n", len(repos))
+		}
+		exitOnCSVError(outputEmptyRepos(out, filterEmptyRepos(ctx, repos, client, *workers), *csv, bold, yellow))
+		if !*csv {
+			fmt.Printf("\nOperation completed in %v\n", time.Since(startTime))
+		}
+		exitIfPartial(client)
+		return
+	}
+
+	if *duplicateBranches > 0 {
+		if !*csv {
+			fmt.Printf("Fetching branches of %d repositories...\n", len(repos))
+		}
+		spreads := findDuplicateBranches(ctx, repos, client, protection, *duplicateBranches, *workers)
+		exitOnCSVError(outputDuplicateBranches(out, spreads, *duplicateBranches, *csv, bold, cyan))
+		if !*csv {
+			fmt.Printf("\nOperation completed in %v\n", time.Since(startTime))
+		}
+		exitIfPartial(client)
+		return
+	}
+
+	if *emailDomains {
+		classifier := &domainClassifier{corporate: config.CorporateDomains}
+		if *corporateDomains != "" {
+			classifier.corporate = parseRepoList(*corporateDomains)
+		}
+		if !*csv {
+			fmt.Printf("Sampling up to %d recent commits from %d repositories...\n", *emailSample, len(repos))
+		}
+		exitOnCSVError(outputEmailDomains(out, collectEmailDomains(ctx, repos, client, *emailSample, *workers), classifier, *csv, bold, red, yellow))
+		if !*csv {
+			fmt.Printf("\nOperation completed in %v\n", time.Since(startTime))
+		}
+		exitIfPartial(client)
+		return
+	}
+
+	if *hygiene {
+		if !*csv {
+			fmt.Printf("Checking %d repositories for a README and %s...\n", len(repos), pipelineConfigFile)
+		}
+		exitOnCSVError(outputHygiene(out, checkHygiene(ctx, repos, client, *workers), *csv, bold, green, red))
+		if !*csv {
+			fmt.Printf("\nOperation completed in %v\n", time.Since(startTime))
+		}
+		exitIfPartial(client)
+		return
+	}
+
+	if *snapshotFile != "" {
+		if !quiet {
+			fmt.Printf("Fetching branches for snapshot of %d repositories...\n", len(repos))
+		}
+		saveSnapshot(*snapshotFile, buildSnapshot(ctx, repos, client, policy, *workers))
+		if !quiet {
+			fmt.Printf("Snapshot written to %s\n", *snapshotFile)
+		}
+		exitIfPartial(client)
+		return
+	}
+
+	if *jsonLines {
+		// Each repository is written as soon as it has been processed, in
+		// completion order, rather than after the whole scan
+		err := streamResultsJSONLines(ctx, out, repos, client, policy, *workers, !*noCreator, *repoOnly, *commitStatsFlag, *aheadBehind)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		exitIfInterrupted(ctx)
+		exitIfPartial(client)
+		return
+	}
+
+	if !quiet {
 		fmt.Printf("\nFound %d repositories:\n", len(repos))
-		// Process repositories concurrently for creator lookup
-		fmt.Printf("Processing creator information concurrently...\n")
+		if !*noCreator && !*branchesOnly {
+			// Process repositories concurrently for creator lookup
+			fmt.Printf("Processing creator information concurrently...\n")
+		}
+	}
+	// The summary only shows creators with --summary-creators, so skip the commit lookups
+	resolveCreators := !*noCreator && !*branchesOnly && (!*summary || *summaryCreators)
+	var repoResults []RepositoryResult
+	if resolveCreators || !*repoOnly {
+		// Branches are fetched in the same worker pool, ahead of the serial output loops
+		// Progress goes to stderr, and only alongside the human-readable display
+		var progress io.Writer
+		if !quiet && !*quietProgress {
+			progress = os.Stderr
+		}
+		repoResults = processRepositoriesConcurrently(ctx, repos, client, *workers, resolveCreators, !*repoOnly, progress)
+	} else {
+		repoResults = unresolvedCreatorResults(repos)
+	}
+	if *withPRs {
+		prefetchPullRequestCounts(ctx, repos, client, *workers)
+	}
+	if *commitStatsFlag && !*summary {
+		prefetchCommitStats(ctx, repos, client, *workers)
 	}
-	repoResults := processRepositoriesConcurrently(repos, client, 10) // Max 10 concurrent requests
+	exitIfInterrupted(ctx)
 
 	// Handle summary mode first
 	if *summary {
-		stats, err := calculateSummaryStats(repos, client)
-		if err != nil {
-			fmt.Printf("Error calculating summary statistics: %v\n", err)
-			os.Exit(1)
+		stats, err := calculateSummaryStats(ctx, repos, client, policy, exclusion, *repoOnly, ageBuckets, *workers)
+		exitIfInterrupted(ctx)
+		exitOnSummaryError(err)
+		warnSampledSummary(os.Stderr, stats, client)
+		if *summaryCreators {
+			addCreatorBreakdown(stats, repoResults, policy, normalizer)
+		}
+		if *listStale {
+			addStaleLists(ctx, stats, repos, client, policy, *repoOnly)
+		}
+		if *withPRs {
+			addPullRequestStats(ctx, stats, repos, client, policy)
+		}
+		if *withTags {
+			addTagStats(ctx, stats, repos, client, *workers)
+		}
+		if *trendFile != "" {
+			if err := appendSummaryTrend(*trendFile, stats, client.workspaceLabel()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing trend file: %v\n", err)
+				os.Exit(exitConfigError)
+			}
+		}
+		if *jsonOutput {
+			if err := outputSummaryJSON(out, stats, client.workspaceLabel()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+				os.Exit(exitConfigError)
+			}
+			exitIfPartial(client)
+			return
+		}
+		displaySummaryStats(stats, client.workspaceLabel(), yellow, red, green, cyan)
+		if *listStale {
+			displayStaleLists(stats, *repoOnly, yellow, red, cyan)
+		}
+		if *verbose {
+			for _, repo := range repos {
+				printRepoCost(client, repo)
+			}
 		}
-		displaySummaryStats(stats, yellow, red, green, cyan)
 
 		// Show elapsed time for summary
 		elapsed := time.Since(startTime)
 		fmt.Printf("Operation completed in %v\n", elapsed)
+		exitIfPartial(client)
 		return
 	}
 
+	if sortKey == "risk" {
+		sortResultsByRisk(ctx, repoResults, policy, *reverseSort, *workers)
+	} else if sortKey != "" {
+		sortResults(repoResults, sortKey, *reverseSort)
+	}
+
 	// Handle CSV output
-	if *csv {
-		outputCSVHeader()
-		for _, result := range repoResults {
-			outputRepositoryCSV(result.Repository, result.Creator, client, *repoOnly)
+	if *csv && *branchesOnly {
+		exitOnCSVError(outputBranchesCSVHeader(out, *checkMerged, *aheadBehind))
+	} else if *csv {
+		exitOnCSVError(outputCSVHeader(out, csvCols))
+	}
+	if *jsonOutput {
+		if err := outputResultsJSON(ctx, jsonOut, repoResults, client, policy, *repoOnly, *commitStatsFlag, *aheadBehind); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing JSON: %v\n", err)
+			os.Exit(exitConfigError)
+		}
+		if posted != nil {
+			if err := client.postResults(ctx, *postURL, postHeaders, posted.Bytes()); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(exitAPIError)
+			}
 		}
+		exitIfPartial(client)
+		return
+	}
+	if *markdown {
+		exitOnMarkdownError(outputResultsMarkdown(ctx, out, client.workspaceLabel(), repoResults, client, policy, *repoOnly))
+		exitIfPartial(client)
+		return
+	}
+	if *htmlFile != "" {
+		// The summary block at the top of the report uses the same statistics as --summary
+		stats, err := calculateSummaryStats(ctx, repos, client, policy, exclusion, *repoOnly, ageBuckets, *workers)
+		exitOnSummaryError(err)
+		warnSampledSummary(os.Stderr, stats, client)
+		saveHTMLReport(*htmlFile, buildHTMLReport(ctx, client.workspaceLabel(), repoResults, client, policy, stats, *repoOnly))
+		exitIfPartial(client)
+		return
+	}
+	if *groupBy == "creator" {
+		displayResultGroups(ctx, "Creator", groupByCreator(repoResults, normalizer), client, policy, dispOpts, *verbose, yellow, red, bold, green, cyan)
+	} else if *groupBy == "project" {
+		displayResultGroups(ctx, "Project", groupByProject(repoResults), client, policy, dispOpts, *verbose, yellow, red, bold, green, cyan)
 	} else {
-		// Display results in original order
 		for _, result := range repoResults {
-			displayRepositoryInfo(result.Repository, result.Creator, client, yellow, red, bold, green, cyan, *repoOnly)
+			exitIfInterrupted(ctx)
+			if *csv && *branchesOnly {
+				exitOnCSVError(outputBranchesCSV(ctx, out, result, client, policy, *checkMerged, *aheadBehind))
+			} else if *csv {
+				exitOnCSVError(outputRepositoryCSV(ctx, out, result, client, policy, *repoOnly, csvCols))
+			} else {
+				displayRepositoryInfo(ctx, result, client, policy, yellow, red, bold, green, cyan, dispOpts)
+			}
+			if *verbose {
+				printRepoCost(client, result.Repository)
+			}
 		}
 	}
 
@@ -1015,4 +5362,5 @@ func main() {
 	if !*csv {
 		fmt.Printf("\nOperation completed in %v\n", elapsed)
 	}
+	exitIfPartial(client)
 }
@@ -0,0 +1,659 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a Bitbucket Cloud client whose requests go to handler
+func newTestClient(t *testing.T, handler http.Handler) *BitbucketClient {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	client := NewBitbucketClient("user", "password", "acme")
+	client.baseURL = server.URL
+	client.maxRetries = 0
+	return client
+}
+
+// commitPages serves a Cloud commit listing split into pages, newest first,
+// each linking to the next, and counts the pages requested
+func commitPages(t *testing.T, pages [][]Commit, requests *int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		page := 0
+		if p := r.URL.Query().Get("page"); p != "" {
+			fmt.Sscanf(p, "%d", &page)
+		}
+		if page >= len(pages) {
+			http.NotFound(w, r)
+			return
+		}
+		response := map[string]interface{}{"values": pages[page]}
+		if page+1 < len(pages) {
+			response["next"] = fmt.Sprintf("http://%s%s?pagelen=100&page=%d", r.Host, r.URL.Path, page+1)
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func testCommit(hash, author string, date time.Time) Commit {
+	var commit Commit
+	commit.Hash = hash
+	commit.Date = date
+	commit.Author.Raw = author + " <" + hash + "@example.com>"
+	return commit
+}
+
+func TestLookupFirstCommitFollowsPages(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	pages := [][]Commit{
+		{testCommit("c5", "Eve", day(5)), testCommit("c4", "Dan", day(4))},
+		{testCommit("c3", "Cat", day(3)), testCommit("c2", "Bob", day(2))},
+		{testCommit("c1", "Ann", day(1))},
+	}
+	requests := 0
+	client := newTestClient(t, commitPages(t, pages, &requests))
+
+	commit, err := client.lookupFirstCommit(context.Background(), "acme/api")
+	if err != nil {
+		t.Fatalf("lookupFirstCommit: %v", err)
+	}
+	if commit.Hash != "c1" || commitAuthorName(commit) != "Ann" {
+		t.Errorf("first commit = %s by %s, want c1 by Ann", commit.Hash, commitAuthorName(commit))
+	}
+	if requests != 3 {
+		t.Errorf("made %d requests, want 3", requests)
+	}
+}
+
+func TestLookupFirstCommitStopsAtPageLimit(t *testing.T) {
+	pages := make([][]Commit, 5)
+	for i := range pages {
+		pages[i] = []Commit{testCommit(fmt.Sprintf("c%d", i), "Ann", time.Date(2020, 1, 10-i, 0, 0, 0, 0, time.UTC))}
+	}
+	requests := 0
+	client := newTestClient(t, commitPages(t, pages, &requests))
+	client.creatorPages = 2
+
+	if _, err := client.lookupFirstCommit(context.Background(), "acme/api"); !errors.Is(err, errHistoryTooLong) {
+		t.Errorf("lookupFirstCommit error = %v, want errHistoryTooLong", err)
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+}
+
+func TestLookupFirstCommitEmptyRepository(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, commitPages(t, [][]Commit{{}}, &requests))
+
+	if _, err := client.lookupFirstCommit(context.Background(), "acme/api"); !errors.Is(err, errNoCommits) {
+		t.Errorf("lookupFirstCommit error = %v, want errNoCommits", err)
+	}
+}
+
+func TestLookupFirstCommitOrdersByDate(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC) }
+	// A merged-in history dated before the root, and a tie on the last page
+	pages := [][]Commit{
+		{testCommit("c5", "Eve", day(6)), testCommit("c4", "Dan", day(1))},
+		{testCommit("c3", "Cat", day(4)), testCommit("c2", "Bob", day(1))},
+		{testCommit("c1", "Ann", day(2))},
+	}
+	requests := 0
+	client := newTestClient(t, commitPages(t, pages, &requests))
+
+	commit, err := client.lookupFirstCommit(context.Background(), "acme/api")
+	if err != nil {
+		t.Fatalf("lookupFirstCommit: %v", err)
+	}
+	if commit.Hash != "c2" {
+		t.Errorf("first commit = %s, want c2", commit.Hash)
+	}
+}
+
+func TestDataCenterRepositoryDetails(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/projects/PROJ/repos", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"isLastPage": true, "values": [
+			{"slug": "api", "name": "API", "project": {"key": "PROJ", "name": "Project"}},
+			{"slug": "empty", "name": "Empty", "project": {"key": "PROJ", "name": "Project"}}]}`)
+	})
+	mux.HandleFunc("/projects/PROJ/repos/api/branches/default", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"displayId": "develop"}`)
+	})
+	mux.HandleFunc("/projects/PROJ/repos/api/branches", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("orderBy") != "MODIFICATION" || r.URL.Query().Get("limit") != "1" {
+			t.Errorf("latest branch query = %s", r.URL.RawQuery)
+		}
+		fmt.Fprint(w, `{"isLastPage": true, "values": [{"displayId": "feature", "latestCommit": "abc",
+			"metadata": {"com.atlassian.bitbucket.server.bitbucket-branch:latest-commit-metadata":
+				{"authorTimestamp": 1700000000000}}}]}`)
+	})
+	mux.HandleFunc("/projects/PROJ/repos/empty/branches", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"isLastPage": true, "values": []}`)
+	})
+	// An empty repository has no default branch, which Data Center answers with 404
+	client := newTestClient(t, mux)
+	client.flavor = dataCenterFlavor{}
+	client.workspace = "PROJ"
+
+	repos, err := client.getRepositories(context.Background(), "")
+	if err != nil {
+		t.Fatalf("getRepositories: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("got %d repositories, want 2", len(repos))
+	}
+	api, empty := repos[0], repos[1]
+	if api.MainBranch.Name != "develop" || !api.UpdatedOn.Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("api main branch %q updated %v, want develop updated %v", api.MainBranch.Name, api.UpdatedOn, time.UnixMilli(1700000000000))
+	}
+	if !api.CreatedOn.IsZero() {
+		t.Errorf("api created %v, want unknown", api.CreatedOn)
+	}
+	if empty.MainBranch.Name != "" || !empty.UpdatedOn.IsZero() {
+		t.Errorf("empty main branch %q updated %v, want neither", empty.MainBranch.Name, empty.UpdatedOn)
+	}
+	var report strings.Builder
+	if client.failures.report(&report) != 0 {
+		t.Errorf("recorded failures, want none:\n%s", report.String())
+	}
+
+	created, age := dateColumns(api.CreatedOn)
+	if created != "" || age != "" {
+		t.Errorf("CSV created %q age %q, want both empty", created, age)
+	}
+	if date, months := jsonDate(api.CreatedOn); date != nil || months != nil {
+		t.Errorf("JSON created %v age %v, want null", date, months)
+	}
+}
+
+func TestBranchesWithoutDateFallBackToTipCommit(t *testing.T) {
+	var commitRequests []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/projects/PROJ/repos/api/branches", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"isLastPage": true, "values": [
+			{"displayId": "dated", "latestCommit": "d1", "metadata": {
+				"com.atlassian.bitbucket.server.bitbucket-branch:latest-commit-metadata": {"authorTimestamp": 1600000000000}}},
+			{"displayId": "undated", "latestCommit": "u1"},
+			{"displayId": "broken", "latestCommit": "b1"}]}`)
+	})
+	mux.HandleFunc("/projects/PROJ/repos/api/commits/", func(w http.ResponseWriter, r *http.Request) {
+		commitRequests = append(commitRequests, r.URL.Path)
+		if strings.HasSuffix(r.URL.Path, "/u1") {
+			fmt.Fprint(w, `{"id": "u1", "author": {"name": "jdoe", "displayName": "Jane Doe"}, "authorTimestamp": 1500000000000}`)
+			return
+		}
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	client := newTestClient(t, mux)
+	client.flavor = dataCenterFlavor{}
+
+	branches, err := client.getBranches(context.Background(), "PROJ/api")
+	if err != nil {
+		t.Fatalf("getBranches: %v", err)
+	}
+	if len(branches) != 3 {
+		t.Fatalf("got %d branches, want 3", len(branches))
+	}
+	dated, undated, broken := branches[0], branches[1], branches[2]
+	if !dated.Target.Date.Equal(time.UnixMilli(1600000000000)) {
+		t.Errorf("dated branch date %v, want its own", dated.Target.Date)
+	}
+	if !undated.Target.Date.Equal(time.UnixMilli(1500000000000)) || undated.AuthorName() != "Jane Doe" {
+		t.Errorf("undated branch date %v author %q, want the tip commit's", undated.Target.Date, undated.AuthorName())
+	}
+	if !broken.Target.Date.IsZero() {
+		t.Errorf("broken branch date %v, want unknown", broken.Target.Date)
+	}
+	if len(commitRequests) != 2 {
+		t.Errorf("looked up %d tip commits, want 2: %v", len(commitRequests), commitRequests)
+	}
+
+	// A date that couldn't be resolved is neither stale nor shown as 0001-01-01
+	if isStaleBranch(broken, monthsAge(1)) {
+		t.Error("branch without a date is stale, want not")
+	}
+	if date, age := dateColumns(broken.Target.Date); date != "" || age != "" {
+		t.Errorf("CSV date %q age %q, want both empty", date, age)
+	}
+	if !isStaleBranch(undated, monthsAge(1)) {
+		t.Error("branch dated from its 2017 tip commit isn't stale, want stale")
+	}
+}
+
+func TestGracePeriodOnlyFallsBackToTipOnError(t *testing.T) {
+	old := asOf.AddDate(-2, 0, 0)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repositories/acme/api/commits/recent":
+			fmt.Fprintf(w, `{"values": [{"hash": "r", "date": %q}]}`, asOf.AddDate(0, 0, -3).Format(time.RFC3339))
+		case "/repositories/acme/api/commits/old":
+			fmt.Fprintf(w, `{"values": [{"hash": "o", "date": %q}]}`, old.Format(time.RFC3339))
+		case "/repositories/acme/api/commits/pointer":
+			fmt.Fprint(w, `{"values": []}`)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	policy := &stalePolicy{client: client, branchAge: monthsAge(6), gracePeriod: ageThreshold{days: 14}}
+	repo := Repository{FullName: "acme/api"}
+	repo.MainBranch.Name = "main"
+
+	tests := []struct {
+		branch string
+		want   bool
+	}{
+		{"recent", false},  // cut from an old commit within the grace period
+		{"old", true},      // its own commits are old too
+		{"pointer", false}, // no commits of its own, so it can't be dated
+		{"broken", true},   // the lookup failed, so its tip date decides
+	}
+	for _, tt := range tests {
+		var branch Branch
+		branch.Name, branch.Target.Date = tt.branch, old
+		if got := policy.isStale(context.Background(), repo, branch); got != tt.want {
+			t.Errorf("%s: stale = %v, want %v", tt.branch, got, tt.want)
+		}
+	}
+}
+
+func TestBranchFirstCommitStopsAtPageLimit(t *testing.T) {
+	pages := make([][]Commit, 5)
+	for i := range pages {
+		pages[i] = []Commit{testCommit(fmt.Sprintf("c%d", i), "Ann", time.Date(2020, 1, 10-i, 0, 0, 0, 0, time.UTC))}
+	}
+	requests := 0
+	client := newTestClient(t, commitPages(t, pages, &requests))
+	client.creatorPages = 2
+	repo := Repository{FullName: "acme/api"}
+	repo.MainBranch.Name = "main"
+
+	if _, err := client.getBranchFirstCommit(context.Background(), repo, "feature"); !errors.Is(err, errHistoryTooLong) {
+		t.Errorf("getBranchFirstCommit error = %v, want errHistoryTooLong", err)
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+
+	// Without a main branch there's nothing to exclude, so nothing is fetched
+	repo.MainBranch.Name = ""
+	if _, err := client.getBranchFirstCommit(context.Background(), repo, "feature"); !errors.Is(err, errNoMainBranch) {
+		t.Errorf("getBranchFirstCommit error = %v, want errNoMainBranch", err)
+	}
+	if requests != 2 {
+		t.Errorf("made %d requests, want 2", requests)
+	}
+}
+
+func TestMarkCreatorsRecordsFailures(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repositories/acme/api/commits/broken" {
+			http.Error(w, "boom", http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"values": [{"hash": "b", "author": {"raw": "Bob <b@example.com>"}},
+			{"hash": "a", "author": {"raw": "Ann <a@example.com>"}}]}`)
+	}))
+	repo := Repository{FullName: "acme/api"}
+	repo.MainBranch.Name = "main"
+	branches := []Branch{{Name: "main"}, {Name: "feature"}, {Name: "broken"}}
+
+	marked := client.markCreators(context.Background(), repo, branches)
+	if marked[0].Creator != "" || marked[1].Creator != "Ann" || marked[2].Creator != "" {
+		t.Errorf("creators = %q, %q, %q, want \"\", Ann, \"\"", marked[0].Creator, marked[1].Creator, marked[2].Creator)
+	}
+	var report strings.Builder
+	if client.failures.report(&report) != 1 || !strings.Contains(report.String(), "broken") {
+		t.Errorf("failure report = %q, want the broken branch", report.String())
+	}
+}
+
+// connectionCountingServer serves a small JSON body after a short delay, so
+// concurrent requests overlap, and counts the connections clients open
+func connectionCountingServer(tb testing.TB, opened *atomic.Int32) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, `{"values": []}`)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			opened.Add(1)
+		}
+	}
+	server.Start()
+	tb.Cleanup(server.Close)
+	return server
+}
+
+func TestTransportSizedForWorkers(t *testing.T) {
+	for _, workers := range []int{1, 8, 32} {
+		transport := newTransport(workers, defaultHTTPTimeouts, nil)
+		if transport.MaxIdleConnsPerHost != workers || transport.MaxConnsPerHost != workers*2 || transport.MaxIdleConns != workers*2 {
+			t.Errorf("%d workers: idle per host %d, per host %d, idle %d, want %d, %d, %d", workers,
+				transport.MaxIdleConnsPerHost, transport.MaxConnsPerHost, transport.MaxIdleConns, workers, workers*2, workers*2)
+		}
+	}
+
+	// Rounds of requests from every worker reuse the first round's
+	// connections; the default transport keeps only two idle ones per host
+	const workers, rounds = 8, 5
+	var opened atomic.Int32
+	server := connectionCountingServer(t, &opened)
+	client := NewBitbucketClient("user", "password", "acme")
+	client.maxRetries = 0
+	client.setMaxInFlight(workers)
+	client.setWorkers(workers)
+	for round := 0; round < rounds; round++ {
+		forEachIndex(context.Background(), workers, workers, func(int) {
+			if _, err := client.makeRequest(context.Background(), server.URL); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+	if n := opened.Load(); n > workers {
+		t.Errorf("opened %d connections for %d rounds of %d requests, want at most %d", n, rounds, workers, workers)
+	}
+}
+
+func BenchmarkConcurrentRequests(b *testing.B) {
+	const workers = 16
+	var opened atomic.Int32
+	server := connectionCountingServer(b, &opened)
+	client := NewBitbucketClient("user", "password", "acme")
+	client.maxRetries = 0
+	client.setMaxInFlight(workers)
+	client.setWorkers(workers)
+	b.ResetTimer()
+	forEachIndex(context.Background(), b.N, workers, func(int) {
+		if _, err := client.makeRequest(context.Background(), server.URL); err != nil {
+			b.Error(err)
+		}
+	})
+	b.ReportMetric(float64(opened.Load()), "conns")
+}
+
+func TestCommitStatsStopAtLimit(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/commits") && r.URL.Query().Get("pagelen") == "1" {
+			fmt.Fprint(w, `{"values": [{"hash": "z", "author": {"raw": "Zoe <z@example.com>"}}]}`)
+			return
+		}
+		requests++
+		// An endless history, pageSize commits at a time
+		commits := make([]Commit, pageSize)
+		response := map[string]interface{}{
+			"values": commits,
+			"next":   fmt.Sprintf("http://%s%s?pagelen=%d&page=%d", r.Host, r.URL.Path, pageSize, requests+1),
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+
+	stats := lookupCommitStats(context.Background(), Repository{FullName: "acme/huge"}, client)
+	if stats.err != nil || stats.total != commitStatsLimit || !stats.capped || stats.lastAuthor != "Zoe" {
+		t.Errorf("stats = %+v, want %d capped, by Zoe", stats, commitStatsLimit)
+	}
+	if got, want := stats.totalText(), fmt.Sprintf("%d+", commitStatsLimit); got != want {
+		t.Errorf("total shown as %q, want %q", got, want)
+	}
+	if want := commitStatsLimit / pageSize; requests != want {
+		t.Errorf("made %d listing requests, want %d", requests, want)
+	}
+}
+
+func TestMaxReposSavesCursor(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Three pages of two repositories, whatever page length was asked for
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		response := map[string]interface{}{"values": []map[string]string{
+			{"full_name": fmt.Sprintf("acme/r%d", page*2-1)},
+			{"full_name": fmt.Sprintf("acme/r%d", page*2)},
+		}}
+		if page < 3 {
+			response["next"] = fmt.Sprintf("http://%s%s?page=%d", r.Host, r.URL.Path, page+1)
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	client.pageLen = 2
+
+	tests := []struct {
+		maxRepos int
+		cursor   string // page the next run resumes at
+	}{
+		{2, "page=2"}, // the cap used all of the first page
+		{3, "page=2"}, // the cap fell inside the second page, so it's listed again
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "scan.cursor")
+		client.cursor = &listingCursor{path: path}
+		client.maxRepos = tt.maxRepos
+
+		repos, err := client.getRepositories(context.Background(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(repos) != tt.maxRepos || !client.reposCapped {
+			t.Errorf("--max-repos %d: listed %d, capped %v", tt.maxRepos, len(repos), client.reposCapped)
+		}
+		saved, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("--max-repos %d: no cursor saved: %v", tt.maxRepos, err)
+		}
+		if !strings.HasSuffix(strings.TrimSpace(string(saved)), tt.cursor) {
+			t.Errorf("--max-repos %d: cursor %q, want it to end with %s", tt.maxRepos, saved, tt.cursor)
+		}
+	}
+}
+
+func TestWarnSampledSummary(t *testing.T) {
+	client := NewBitbucketClient("user", "password", "acme")
+	client.maxRepos, client.maxBranches = 20, 10
+
+	var warnings strings.Builder
+	warnSampledSummary(&warnings, &SummaryStats{TotalRepos: 20}, client)
+	if warnings.Len() != 0 {
+		t.Errorf("warned %q for a listing that wasn't capped", warnings.String())
+	}
+
+	client.reposCapped = true
+	warnSampledSummary(&warnings, &SummaryStats{TotalRepos: 20, TruncatedRepos: 3}, client)
+	for _, want := range []string{"--max-repos 20", "3 repositories had more than --max-branches 10"} {
+		if !strings.Contains(warnings.String(), want) {
+			t.Errorf("warnings %q don't mention %q", warnings.String(), want)
+		}
+	}
+}
+
+func TestNameRepositoryKeepsAlias(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	repo := &Repository{Name: "api", FullName: "acme/api"}
+	nameRepository(repo, map[string]string{"ACME/API": "Payments API"})
+	if got := repo.DisplayName(); got != "Payments API" {
+		t.Errorf("DisplayName() = %q, want Payments API", got)
+	}
+
+	policy := &stalePolicy{client: client, branchAge: monthsAge(6), repoMonths: 12}
+	out := buildRepositoryJSON(context.Background(), RepositoryResult{Repository: *repo}, client, policy, true, false, false)
+	if out.DisplayName != "Payments API" {
+		t.Errorf("display_name = %q, want Payments API", out.DisplayName)
+	}
+}
+
+func TestCreatorBreakdownAgreesWithOldRepos(t *testing.T) {
+	client := NewBitbucketClient("user", "password", "acme")
+	policy := &stalePolicy{client: client, branchAge: monthsAge(6), repoMonths: 12}
+	results := []RepositoryResult{
+		{Repository: Repository{FullName: "acme/idle", UpdatedOn: asOf.AddDate(-2, 0, 0)}, Creator: "Ann"},
+		{Repository: Repository{FullName: "acme/active", UpdatedOn: asOf}, Creator: "Ann"},
+		// A Data Center repository whose details couldn't be fetched
+		{Repository: Repository{FullName: "ACME/unknown"}, Creator: "Bob"},
+	}
+	repos := make([]Repository, len(results))
+	for i, result := range results {
+		repos[i] = result.Repository
+	}
+
+	stats, err := calculateSummaryStats(context.Background(), repos, client, policy, nil, true, defaultRepoAgeBuckets, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addCreatorBreakdown(stats, results, policy, nil)
+	stale := 0
+	for _, count := range stats.StaleReposByCreator {
+		stale += count.StaleRepos
+	}
+	if stats.OldRepos != 1 || stale != stats.OldRepos {
+		t.Errorf("stale by creator add up to %d, old repositories %d, want 1 and 1", stale, stats.OldRepos)
+	}
+}
+
+func TestSummaryStatsFailWhenNoBranchesList(t *testing.T) {
+	repos := []Repository{{FullName: "acme/api"}, {FullName: "acme/web"}}
+	for _, listed := range []string{"", "/repositories/acme/web/refs/branches"} {
+		client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != listed {
+				http.Error(w, "boom", http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, `{"values": []}`)
+		}))
+		policy := &stalePolicy{client: client, branchAge: monthsAge(6), repoMonths: 12}
+
+		stats, err := calculateSummaryStats(context.Background(), repos, client, policy, nil, false, defaultRepoAgeBuckets, 2)
+		if listed == "" {
+			if err == nil || exitCodeForError(err) != exitAPIError {
+				t.Errorf("with no branch lists, error = %v, want an API error", err)
+			}
+			continue
+		}
+		if err != nil || stats.TotalRepos != 2 {
+			t.Errorf("with one branch list, stats = %+v, error = %v, want both repositories counted", stats, err)
+		}
+	}
+}
+
+func TestEscapeMarkdown(t *testing.T) {
+	tests := []struct{ value, want string }{
+		{"plain", "plain"},
+		{"a|b", `a\|b`},
+		{`C:\repos\api`, `C:\\repos\\api`},
+		{`ends with \`, `ends with \\`},
+		{`\|`, `\\\|`},
+		{"two\nlines", "two lines"},
+	}
+	for _, tt := range tests {
+		if got := escapeMarkdown(tt.value); got != tt.want {
+			t.Errorf("escapeMarkdown(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownLeavesUnknownDatesBlank(t *testing.T) {
+	client := NewBitbucketClient("user", "password", "acme")
+	policy := &stalePolicy{client: client, branchAge: monthsAge(6), repoMonths: 12}
+	// A Data Center repository has no creation date
+	repo := Repository{Name: "api", FullName: "PROJ/api"}
+	results := []RepositoryResult{{Repository: repo, Creator: "Ann"}}
+
+	var out strings.Builder
+	outputResultsMarkdown(context.Background(), &out, "PROJ", results, client, policy, true)
+	if strings.Contains(out.String(), "0001-01-01") {
+		t.Errorf("report shows the zero date:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "| api |  | Ann |  |  |  |") {
+		t.Errorf("report doesn't leave the unknown dates and age blank:\n%s", out.String())
+	}
+}
+
+func TestHTMLReportLeavesUnknownAgeBlank(t *testing.T) {
+	client := NewBitbucketClient("user", "password", "acme")
+	policy := &stalePolicy{client: client, branchAge: monthsAge(6), repoMonths: 12}
+	results := []RepositoryResult{{Repository: Repository{Name: "api", FullName: "PROJ/api"}}}
+	report := buildHTMLReport(context.Background(), "PROJ", results, client, policy, &SummaryStats{TotalRepos: 1}, true)
+
+	var out strings.Builder
+	if err := htmlTemplate.Execute(&out, report); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `<td>(unknown date)</td><td>(unknown date)</td><td class="num">-</td>`) {
+		t.Errorf("report doesn't show the unknown dates and age as such:\n%s", out.String())
+	}
+}
+
+// failingWriter fails every write after the first n
+type failingWriter struct{ n int }
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestStreamResultsJSONLines(t *testing.T) {
+	var branchRequests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		branchRequests.Add(1)
+		fmt.Fprint(w, `{"values": [{"name": "main", "target": {"hash": "a", "date": "2020-01-01T00:00:00Z"}}]}`)
+	}))
+	policy := &stalePolicy{client: client, branchAge: monthsAge(6), repoMonths: 12}
+	var repos []Repository
+	for i := 0; i < 20; i++ {
+		repos = append(repos, Repository{Name: fmt.Sprintf("r%d", i), FullName: fmt.Sprintf("acme/r%d", i)})
+	}
+
+	var out strings.Builder
+	if err := streamResultsJSONLines(context.Background(), &out, repos, client, policy, 4, false, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != len(repos) {
+		t.Fatalf("wrote %d lines, want %d", len(lines), len(repos))
+	}
+	seen := map[string]bool{}
+	for _, line := range lines {
+		var repo RepositoryJSON
+		if err := json.Unmarshal([]byte(line), &repo); err != nil {
+			t.Fatalf("line %q: %v", line, err)
+		}
+		if len(repo.Branches) != 1 || !repo.Branches[0].Stale {
+			t.Errorf("%s: branches %+v, want one stale branch", repo.FullName, repo.Branches)
+		}
+		seen[repo.FullName] = true
+	}
+	if len(seen) != len(repos) {
+		t.Errorf("wrote %d distinct repositories, want %d", len(seen), len(repos))
+	}
+
+	// A failed write stops the stream instead of scanning the rest
+	branchRequests.Store(0)
+	client.branches = map[string][]Branch{}
+	err := streamResultsJSONLines(context.Background(), &failingWriter{n: 2}, repos, client, policy, 1, false, false, false, false)
+	if err == nil || err.Error() != "disk full" {
+		t.Errorf("error = %v, want disk full", err)
+	}
+	if n := branchRequests.Load(); n != 3 {
+		t.Errorf("listed branches of %d repositories after the failure, want 3", n)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// markdownEscaper escapes backslashes, which would otherwise escape the
+// character after them, and pipes, which would start a new column
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "|", "\\|")
+
+// escapeMarkdown makes a value safe for a Markdown table cell: backslashes and
+// pipes are escaped and newlines, which would end the row, become spaces
+func escapeMarkdown(value string) string {
+	value = markdownEscaper.Replace(value)
+	return strings.Join(strings.Fields(value), " ")
+}
+
+// markdownRow writes one Markdown table row, escaping every cell
+func markdownRow(w io.Writer, cells ...string) {
+	for i, cell := range cells {
+		cells[i] = escapeMarkdown(cell)
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+}
+
+// markdownHeader writes a table header and its separator row
+func markdownHeader(w io.Writer, columns ...string) {
+	markdownRow(w, columns...)
+	fmt.Fprintf(w, "|%s\n", strings.Repeat("---|", len(columns)))
+}
+
+// outputResultsMarkdown writes the results to w as a Markdown document: a table
+// of repositories and, unless repoOnly, a table of old branches for each
+// repository that has any. The document is written in one go once all
+// branches have been looked up, and the write error returned.
+func outputResultsMarkdown(ctx context.Context, w io.Writer, target string, results []RepositoryResult, client *BitbucketClient, policy *stalePolicy, repoOnly bool) error {
+	var doc strings.Builder
+	writeMarkdownReport(ctx, &doc, target, results, client, policy, repoOnly)
+	_, err := io.WriteString(w, doc.String())
+	return err
+}
+
+// writeMarkdownReport renders the document for outputResultsMarkdown
+func writeMarkdownReport(ctx context.Context, w io.Writer, target string, results []RepositoryResult, client *BitbucketClient, policy *stalePolicy, repoOnly bool) {
+	fmt.Fprintf(w, "# Bitbucket Repository Report: %s\n\n", escapeMarkdown(target))
+	fmt.Fprintf(w, "Generated %s. Repositories are old after %d months without access, branches after %s without a push.\n\n",
+		asOf.Format("2006-01-02"), policy.repoMonths, policy.branchAge)
+
+	fmt.Fprintf(w, "## Repositories (%d)\n\n", len(results))
+	markdownHeader(w, "Repository", "Owner", "Creator", "Created", "Last Access", "Age (months)")
+	for _, result := range results {
+		repo := result.Repository
+		created, age := dateColumns(repo.CreatedOn)
+		updated, _ := dateColumns(repo.UpdatedOn)
+		markdownRow(w, repo.DisplayName(), repo.Owner.DisplayName, result.creatorLabel(), created, updated, age)
+	}
+	if repoOnly {
+		return
+	}
+
+	fmt.Fprintf(w, "\n## Old Branches\n")
+	found := false
+	for _, result := range results {
+		repo := result.Repository
+		branches, err := result.branches(ctx, client)
+		if err != nil {
+			fmt.Fprintf(w, "\n### %s\n\n_Error fetching branches: %s_\n", escapeMarkdown(repo.DisplayName()), escapeMarkdown(err.Error()))
+			continue
+		}
+
+		var old []Branch
+		for _, branch := range branches {
+			if policy.isStale(ctx, repo, branch) {
+				old = append(old, branch)
+			}
+		}
+		if len(old) == 0 {
+			continue
+		}
+
+		found = true
+		fmt.Fprintf(w, "\n### %s\n\n", escapeMarkdown(repo.DisplayName()))
+		markdownHeader(w, "Branch", "Last Pushed", "Last Pushed By", "Age (months)")
+		for _, branch := range old {
+			pushed, age := dateColumns(branch.Target.Date)
+			markdownRow(w, branch.Name, pushed, branch.AuthorName(), age)
+		}
+	}
+	if !found {
+		fmt.Fprintf(w, "\nNo old branches.\n")
+	}
+}
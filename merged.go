@@ -0,0 +1,37 @@
+package main
+
+import "context"
+
+// markMerged returns a copy of branches with Merged filled in for every
+// branch except the main branch itself. A branch is merged when its tip is
+// an ancestor of the main branch, i.e. the merge base of the two is the
+// branch tip. That costs one merge-base request per branch, cached by the
+// client. Branches whose status can't be determined keep a nil Merged.
+func (c *BitbucketClient) markMerged(ctx context.Context, repo Repository, branches []Branch) []Branch {
+	marked := make([]Branch, len(branches))
+	copy(marked, branches)
+
+	mainHash := ""
+	for _, branch := range branches {
+		if branch.Name == repo.MainBranch.Name {
+			mainHash = branch.Target.Hash
+		}
+	}
+	if mainHash == "" {
+		return marked
+	}
+
+	for i := range marked {
+		branch := &marked[i]
+		if branch.Name == repo.MainBranch.Name || branch.Target.Hash == "" {
+			continue
+		}
+		base, err := c.getMergeBase(ctx, repo.FullName, branch.Target.Hash, mainHash)
+		if err != nil {
+			continue
+		}
+		merged := base.Hash == branch.Target.Hash
+		branch.Merged = &merged
+	}
+	return marked
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strconv"
+	"strings"
+)
+
+// Provider is what the report is built on: listing and looking up
+// repositories, listing their branches and finding their first commit.
+// BitbucketClient implements it for every --provider, building each hosting
+// service's requests and decoding its responses through an apiFlavor, so
+// code that only needs these, such as the empty repository and duplicate
+// branch reports, takes a Provider. Lookups beyond them go through optional
+// flavor interfaces or Bitbucket Cloud endpoints; flavorFlagError rejects
+// the flags that need them where they're missing.
+type Provider interface {
+	getRepositories(ctx context.Context, query string) ([]Repository, error)
+	getRepository(ctx context.Context, repoName string) (*Repository, error)
+	getBranches(ctx context.Context, repoFullName string) ([]Branch, error)
+	getFirstCommit(ctx context.Context, repoFullName string) (*Commit, error)
+}
+
+var _ Provider = (*BitbucketClient)(nil)
+
+// Hosting services selected with --provider
+const (
+	providerBitbucket = "bitbucket"
+	providerGitHub    = "github"
+	providerGitLab    = "gitlab"
+)
+
+// validProviders are the values accepted by --provider
+var validProviders = []string{providerBitbucket, providerGitHub, providerGitLab}
+
+// Default API base URLs of the hosted GitHub and GitLab services
+const (
+	defaultGitHubBaseURL = "https://api.github.com"
+	defaultGitLabBaseURL = "https://gitlab.com/api/v4"
+)
+
+// providerNames are the display names of the providers
+var providerNames = map[string]string{
+	providerBitbucket: "Bitbucket",
+	providerGitHub:    "GitHub",
+	providerGitLab:    "GitLab",
+}
+
+// providerTokenEnv names the environment variable holding each provider's
+// access token, read when no credentials are configured
+var providerTokenEnv = map[string]string{
+	providerBitbucket: "BITBUCKET_ACCESS_TOKEN",
+	providerGitHub:    "GITHUB_TOKEN",
+	providerGitLab:    "GITLAB_TOKEN",
+}
+
+// parseProvider validates a --provider value; empty means Bitbucket
+func parseProvider(provider string) (string, error) {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if provider == "" {
+		return providerBitbucket, nil
+	}
+	for _, valid := range validProviders {
+		if provider == valid {
+			return provider, nil
+		}
+	}
+	return "", fmt.Errorf("invalid provider %q (valid: %s)", provider, strings.Join(validProviders, ", "))
+}
+
+// flavorForProvider picks the API flavor of a provider and normalizes its
+// base URL. An empty base URL selects the provider's hosted service; for
+// Bitbucket a custom one may point at Data Center (see flavorForBaseURL).
+func flavorForProvider(provider, baseURL string) (apiFlavor, string, error) {
+	var flavor apiFlavor
+	switch provider {
+	case providerGitHub:
+		flavor = githubFlavor{}
+		if baseURL == "" {
+			baseURL = defaultGitHubBaseURL
+		}
+	case providerGitLab:
+		flavor = gitlabFlavor{}
+		if baseURL == "" {
+			baseURL = defaultGitLabBaseURL
+		}
+	default:
+		if baseURL == "" {
+			return cloudFlavor{}, defaultBaseURL, nil
+		}
+		return flavorForBaseURL(baseURL)
+	}
+
+	baseURL = strings.TrimRight(baseURL, "/")
+	parsed, err := neturl.Parse(baseURL)
+	if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return nil, "", fmt.Errorf("invalid base URL %q", baseURL)
+	}
+	return flavor, baseURL, nil
+}
+
+// flavorFeature is an option that needs more than every flavor provides
+type flavorFeature struct {
+	flag    string // as shown in the error, e.g. "--with-prs"
+	enabled bool
+	// supported reports whether a flavor can serve the feature
+	supported func(flavor apiFlavor) bool
+}
+
+// cloudOnly is supported by Bitbucket Cloud only: pull requests and file
+// listings use endpoints the other APIs lay out differently
+func cloudOnly(flavor apiFlavor) bool {
+	_, ok := flavor.(cloudFlavor)
+	return ok
+}
+
+// listsBranchCommits is supported by flavors that can list the commits on one
+// branch but not another
+func listsBranchCommits(flavor apiFlavor) bool {
+	_, ok := flavor.(branchCommitsFlavor)
+	return ok
+}
+
+// findsMergeBases is supported by flavors that can look up the merge base of
+// two commits, which --merge-base, --check-merged and --merged-only rely on
+func findsMergeBases(flavor apiFlavor) bool {
+	_, ok := flavor.(mergeBaseFlavor)
+	return ok
+}
+
+// comparesBranches is supported by flavors that can count the commits one
+// branch has that another lacks
+func comparesBranches(flavor apiFlavor) bool {
+	_, compares := flavor.(compareFlavor)
+	return compares || listsBranchCommits(flavor)
+}
+
+// reportsOwners is supported by flavors whose repository listings name an
+// owner; Data Center repositories belong to projects instead
+func reportsOwners(flavor apiFlavor) bool {
+	_, dataCenter := flavor.(dataCenterFlavor)
+	return !dataCenter
+}
+
+// flavorFlagError returns an error naming the enabled features flavor doesn't
+// support, or nil, so they fail at startup rather than per repository
+func flavorFlagError(flavor apiFlavor, service string, features []flavorFeature) error {
+	var unsupported []string
+	for _, feature := range features {
+		if feature.enabled && !feature.supported(flavor) {
+			unsupported = append(unsupported, feature.flag)
+		}
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s not supported by %s", strings.Join(unsupported, ", "), service)
+}
+
+// pageSize is the number of results requested per page, and the most every
+// supported API allows. --page-len lowers it for repository and branch
+// listings.
+const pageSize = 100
+
+// limitedPageLen is the page length for a listing capped at limit results
+// (0 = no cap), so a small cap doesn't fetch a full page only to discard it
+func limitedPageLen(pageLen, limit int) int {
+	if limit > 0 && limit < pageLen {
+		return limit
+	}
+	return pageLen
+}
+
+// nextPageNumberURL returns pageURL with its page parameter advanced, or ""
+// when the page had fewer results than its per_page parameter asked for.
+// GitHub and GitLab announce further pages only in response headers, which
+// makeRequest doesn't return, so a full page costs one extra request when it
+// happens to be the last.
+func nextPageNumberURL(pageURL string, count int) (string, error) {
+	parsed, err := neturl.Parse(pageURL)
+	if err != nil {
+		return "", err
+	}
+	values := parsed.Query()
+	perPage, err := strconv.Atoi(values.Get("per_page"))
+	if err != nil || perPage < 1 {
+		perPage = pageSize
+	}
+	if count < perPage {
+		return "", nil
+	}
+	page, err := strconv.Atoi(values.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	values.Set("page", strconv.Itoa(page+1))
+	parsed.RawQuery = values.Encode()
+	return parsed.String(), nil
+}
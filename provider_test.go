@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestFlavorFlagError(t *testing.T) {
+	features := []flavorFeature{
+		{"--with-prs", true, cloudOnly},
+		{"--safe-delete", true, listsBranchCommits},
+		{"--hygiene", false, cloudOnly},
+	}
+	if err := flavorFlagError(cloudFlavor{}, "Bitbucket", features); err != nil {
+		t.Errorf("Cloud: %v, want no error", err)
+	}
+	err := flavorFlagError(dataCenterFlavor{}, "Bitbucket Data Center", features)
+	if err == nil || err.Error() != "--with-prs not supported by Bitbucket Data Center" {
+		t.Errorf("Data Center: %v, want --with-prs rejected", err)
+	}
+	err = flavorFlagError(githubFlavor{}, "GitHub", features)
+	if err == nil || err.Error() != "--with-prs, --safe-delete not supported by GitHub" {
+		t.Errorf("GitHub: %v, want --with-prs and --safe-delete rejected", err)
+	}
+}
+
+func TestCommitCountThroughGitHubFlavor(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/acme/empty/commits":
+			// GitHub's answer for a repository without commits
+			http.Error(w, `{"message": "Git Repository is empty."}`, http.StatusConflict)
+		case r.URL.Path == "/repos/acme/api/commits":
+			fmt.Fprint(w, `[{"sha": "b"}, {"sha": "a"}]`)
+		default:
+			t.Errorf("unexpected request for %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	client.flavor = githubFlavor{}
+
+	if count, complete, err := client.getCommitCount(context.Background(), "acme/api", 0); err != nil || count != 2 || !complete {
+		t.Errorf("commit count: %d, %v, %v, want 2 and complete", count, complete, err)
+	}
+	if count, _, err := client.getCommitCount(context.Background(), "acme/empty", 0); err != nil || count != 0 {
+		t.Errorf("empty repository: %d, %v, want 0", count, err)
+	}
+	if _, err := client.getLatestCommit(context.Background(), "acme/empty"); !errors.Is(err, errNoCommits) {
+		t.Errorf("latest commit of empty repository: %v, want errNoCommits", err)
+	}
+}
+
+func TestMaxBranchesTruncationOnGitHub(t *testing.T) {
+	var branchRequests int
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/commits/") {
+			fmt.Fprint(w, `{"sha": "x", "commit": {"author": {"name": "Ann", "date": "2020-01-01T00:00:00Z"}}}`)
+			return
+		}
+		// /repos/acme/<n>/branches lists n branches
+		branchRequests++
+		var total int
+		fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/repos/acme/"), "%d", &total)
+		perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		var values []string
+		for i := (page - 1) * perPage; i < min(page*perPage, total); i++ {
+			values = append(values, fmt.Sprintf(`{"name": "b%d", "commit": {"sha": "s%d"}}`, i, i))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(values, ","))
+	}))
+	client.flavor = githubFlavor{}
+	client.maxBranches = 2
+
+	tests := []struct {
+		pageLen, branches int
+		truncated         bool
+		requests          int
+	}{
+		{pageSize, 1, false, 1},
+		{pageSize, 2, false, 1}, // a page of 2 when 3 were asked for is the last
+		{pageSize, 3, true, 1},
+		{2, 2, false, 2}, // the full first page has an empty follow-up
+		{2, 4, true, 2},
+	}
+	for _, tt := range tests {
+		branchRequests = 0
+		client.pageLen = tt.pageLen
+		branches, truncated, err := client.fetchBranches(context.Background(), fmt.Sprintf("acme/%d", tt.branches))
+		if err != nil {
+			t.Fatalf("%d branches: %v", tt.branches, err)
+		}
+		if len(branches) != min(tt.branches, 2) || truncated != tt.truncated || branchRequests != tt.requests {
+			t.Errorf("%d branches, page length %d: got %d, truncated %v in %d requests, want %d, %v in %d",
+				tt.branches, tt.pageLen, len(branches), truncated, branchRequests, min(tt.branches, 2), tt.truncated, tt.requests)
+		}
+	}
+}
+
+func TestFilterByOwner(t *testing.T) {
+	owned := func(name, owner string) Repository {
+		repo := Repository{Name: name}
+		repo.Owner.Username = owner
+		return repo
+	}
+	names := func(repos []Repository) string {
+		var list []string
+		for _, repo := range repos {
+			list = append(list, repo.Name)
+		}
+		return strings.Join(list, ",")
+	}
+	repos := []Repository{owned("api", "platform-team"), owned("web", "infra"), owned("docs", "")}
+	if got := names(filterByOwner(repos, []string{"Platform-Team"}, nil)); got != "api" {
+		t.Errorf("filtered to %q, want api", got)
+	}
+
+	// Listed owners are pseudonyms with --anonymize
+	anon, err := newAnonymizer("seed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	anonymized := make([]Repository, len(repos))
+	copy(anonymized, repos)
+	for i := range anonymized {
+		anon.repository(&anonymized[i])
+	}
+	if got := names(filterByOwner(anonymized, []string{"Platform-Team", "infra"}, anon)); got != "api,web" {
+		t.Errorf("filtered anonymized repositories to %q, want api,web", got)
+	}
+
+	if err := flavorFlagError(dataCenterFlavor{}, "Bitbucket Data Center", []flavorFeature{{"--owner", true, reportsOwners}}); err == nil {
+		t.Error("--owner accepted for Data Center, whose repositories have no owner")
+	}
+}
+
+func TestValidateShowsAuthenticatedAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		flavor   apiFlavor
+		apiPath  string
+		userPath string
+		body     string
+		want     string
+	}{
+		{"cloud", cloudFlavor{}, "", "/user", `{"username": "jdoe", "display_name": "J Doe"}`, "Username:  jdoe\n"},
+		{"github", githubFlavor{}, "", "/user", `{"login": "octocat"}`, "Username:  octocat\n"},
+		{"gitlab", gitlabFlavor{}, "", "/user", `{"username": "tanuki"}`, "Username:  tanuki\n"},
+		{"data center", dataCenterFlavor{}, dataCenterAPIPath, "/plugins/servlet/applinks/whoami", "jdoe\n", "Username:  jdoe\n"},
+		{"lookup refused", cloudFlavor{}, "", "/nowhere", "", "Username:  user (account lookup failed: API request failed with status: 403)\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == tt.userPath:
+					fmt.Fprint(w, tt.body)
+				case strings.HasSuffix(r.URL.Path, "/user"), strings.HasSuffix(r.URL.Path, "/whoami"):
+					http.Error(w, "forbidden", http.StatusForbidden)
+				default:
+					fmt.Fprint(w, `[]`)
+				}
+			}))
+			client.flavor = tt.flavor
+			client.baseURL += tt.apiPath
+
+			var out strings.Builder
+			code := validateCredentials(context.Background(), client, &out)
+			if !strings.Contains(out.String(), tt.want) {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+			if code != 0 {
+				t.Errorf("exit code = %d, want 0", code)
+			}
+		})
+	}
+}
+
+func TestRepositoryWebURL(t *testing.T) {
+	tests := []struct {
+		flavor  apiFlavor
+		baseURL string
+		want    string
+	}{
+		{cloudFlavor{}, defaultBaseURL, "https://bitbucket.org/acme/api"},
+		{dataCenterFlavor{}, "https://git.example.com/bitbucket/rest/api/1.0", "https://git.example.com/bitbucket/projects/acme/repos/api/browse"},
+		{githubFlavor{}, defaultGitHubBaseURL, "https://github.com/acme/api"},
+		{githubFlavor{}, "https://github.example.com/api/v3", "https://github.example.com/acme/api"},
+		{gitlabFlavor{}, defaultGitLabBaseURL, "https://gitlab.com/acme/api"},
+	}
+	for _, tt := range tests {
+		if got := tt.flavor.repositoryWebURL(tt.baseURL, "acme/api"); got != tt.want {
+			t.Errorf("repositoryWebURL(%s) = %s, want %s", tt.baseURL, got, tt.want)
+		}
+	}
+}
+
+func TestMergeBaseThroughFlavor(t *testing.T) {
+	requests := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/repositories/acme/api/merge-base/f1..m1" {
+			t.Errorf("unexpected request for %s", r.URL)
+		}
+		fmt.Fprint(w, `{"hash": "b1", "date": "2024-01-02T00:00:00Z"}`)
+	}))
+
+	base, err := client.getMergeBase(context.Background(), "acme/api", "f1", "m1")
+	if err != nil || base.Hash != "b1" {
+		t.Errorf("Cloud merge base = %+v, %v, want b1", base, err)
+	}
+
+	for _, flavor := range []apiFlavor{dataCenterFlavor{}, githubFlavor{}, gitlabFlavor{}} {
+		client.flavor = flavor
+		if findsMergeBases(flavor) {
+			t.Errorf("%T finds merge bases, want it rejected at startup", flavor)
+		}
+		if _, err := client.getMergeBase(context.Background(), "acme/api", "f2", "m1"); !errors.Is(err, errLookupUnsupported) {
+			t.Errorf("%T merge base error = %v, want errLookupUnsupported", flavor, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("made %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	neturl "net/url"
+	"strings"
+	"testing"
+)
+
+func TestBasicAuthThroughProxy(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A forward proxy sees the absolute URL of the request it relays
+		proxied = append(proxied, r.URL.String())
+		if got, want := r.Header.Get("Proxy-Authorization"), "Basic "+base64.StdEncoding.EncodeToString([]byte("puser:ppass")); got != want {
+			t.Errorf("Proxy-Authorization = %q, want %q", got, want)
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "password" {
+			t.Errorf("Bitbucket credentials = %q, %q, %v, want user and password", user, password, ok)
+		}
+		fmt.Fprint(w, `{"values": []}`)
+	}))
+	t.Cleanup(proxy.Close)
+
+	client := NewBitbucketClient("user", "password", "acme")
+	client.baseURL = "http://bitbucket.example.com/2.0"
+	client.maxRetries = 0
+	if err := client.setProxy("http://puser:ppass@" + strings.TrimPrefix(proxy.URL, "http://")); err != nil {
+		t.Fatal(err)
+	}
+	client.setWorkers(2)
+
+	if _, err := client.makeRequest(context.Background(), client.baseURL+"/repositories/acme"); err != nil {
+		t.Fatal(err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://bitbucket.example.com/2.0/repositories/acme" {
+		t.Errorf("proxy relayed %v, want the repository listing", proxied)
+	}
+}
+
+func TestExplicitProxyHonoursNoProxy(t *testing.T) {
+	t.Setenv("NO_PROXY", ".internal.example.com,10.0.0.0/8")
+	selectProxy, err := newProxyFunc("proxy.example.com:3128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url  string
+		want string // empty for a direct connection
+	}{
+		{"https://api.bitbucket.org/2.0/user", "http://proxy.example.com:3128"},
+		{"https://bitbucket.internal.example.com/rest/api/1.0", ""},
+		{"http://10.1.2.3:7990/rest/api/1.0", ""},
+		{"http://127.0.0.1:7990/rest/api/1.0", ""},
+	}
+	for _, tt := range tests {
+		target, _ := neturl.Parse(tt.url)
+		got, err := selectProxy(&http.Request{URL: target})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.url, err)
+		}
+		gotProxy := ""
+		if got != nil {
+			gotProxy = got.String()
+		}
+		if gotProxy != tt.want {
+			t.Errorf("%s: proxy %q, want %q", tt.url, gotProxy, tt.want)
+		}
+	}
+}
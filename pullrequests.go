@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// PullRequestStats summarizes open pull requests across the scanned
+// repositories (--with-prs)
+type PullRequestStats struct {
+	OpenPullRequests      int `json:"open_pull_requests"`
+	ReposWithOpenPRs      int `json:"repos_with_open_prs"`
+	StaleReposWithOpenPRs int `json:"stale_repos_with_open_prs"` // archive candidates that still need review
+}
+
+// getOpenPullRequestCount returns the number of open pull requests in a
+// repository. The API's size field gives the total from a single small page;
+// if it is missing the pages are counted instead. Counts are cached per client.
+func (c *BitbucketClient) getOpenPullRequestCount(ctx context.Context, repoFullName string) (int, error) {
+	c.pullRequestMu.Lock()
+	count, ok := c.pullRequestCounts[repoFullName]
+	c.pullRequestMu.Unlock()
+	if ok {
+		return count, nil
+	}
+
+	count = 0
+	url := fmt.Sprintf("%s/repositories/%s/pullrequests?state=OPEN&pagelen=50", c.baseURL, repoFullName)
+	for url != "" {
+		data, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return 0, err
+		}
+
+		var response struct {
+			Size   *int              `json:"size"`
+			Values []json.RawMessage `json:"values"`
+			Next   string            `json:"next"`
+		}
+		if err := json.Unmarshal(data, &response); err != nil {
+			return 0, err
+		}
+
+		if response.Size != nil {
+			count = *response.Size
+			break
+		}
+		count += len(response.Values)
+		url = response.Next
+	}
+
+	c.pullRequestMu.Lock()
+	c.pullRequestCounts[repoFullName] = count
+	c.pullRequestMu.Unlock()
+
+	return count, nil
+}
+
+// prefetchPullRequestCounts looks up the open pull request counts of repos
+// concurrently, so later display and CSV output is served from the cache
+func prefetchPullRequestCounts(ctx context.Context, repos []Repository, client *BitbucketClient, maxConcurrency int) {
+	forEachRepo(ctx, repos, maxConcurrency, func(_ int, r Repository) {
+		client.getOpenPullRequestCount(ctx, r.FullName)
+	})
+}
+
+// addPullRequestStats totals the open pull requests of repos. Repositories
+// whose count couldn't be fetched are left out.
+func addPullRequestStats(ctx context.Context, stats *SummaryStats, repos []Repository, client *BitbucketClient, policy *stalePolicy) {
+	prs := &PullRequestStats{}
+	for _, repo := range repos {
+		count, err := client.getOpenPullRequestCount(ctx, repo.FullName)
+		if err != nil || count == 0 {
+			continue
+		}
+		prs.OpenPullRequests += count
+		prs.ReposWithOpenPRs++
+		if policy.isOldRepo(repo) {
+			prs.StaleReposWithOpenPRs++
+		}
+	}
+	stats.PullRequests = prs
+}
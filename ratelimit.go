@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitLowWater is the remaining request budget at which all requests
+// pause until the rate limit window resets
+const rateLimitLowWater = 5
+
+// rateLimiter paces requests shared by every goroutine using a client. It
+// spaces requests to an optional requests-per-second cap, and pauses all of
+// them when the server's rate limit headers report the budget is nearly spent.
+type rateLimiter struct {
+	mu          sync.Mutex
+	interval    time.Duration // minimum gap between requests (0 = no cap)
+	next        time.Time     // earliest start of the next request under the cap
+	pausedUntil time.Time     // set when the server budget runs low
+}
+
+// newRateLimiter returns a limiter capped at perSecond requests per second, or
+// only following server headers when perSecond is 0
+func newRateLimiter(perSecond float64) *rateLimiter {
+	limiter := &rateLimiter{}
+	if perSecond > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	return limiter
+}
+
+// wait blocks until the next request may start or ctx is cancelled
+func (l *rateLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	start := time.Now()
+	if l.pausedUntil.After(start) {
+		start = l.pausedUntil
+	}
+	if l.interval > 0 {
+		if l.next.After(start) {
+			start = l.next
+		}
+		l.next = start.Add(l.interval)
+	}
+	l.mu.Unlock()
+
+	return sleepContext(ctx, time.Until(start))
+}
+
+// observe reads X-RateLimit-Remaining and X-RateLimit-Reset from a response
+// and pauses all requests until the reset when the budget is nearly spent.
+// The reset may be a Unix timestamp or a number of seconds from now.
+func (l *rateLimiter) observe(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining > rateLimitLowWater {
+		return
+	}
+	reset, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset"), 64)
+	if err != nil || reset <= 0 {
+		return
+	}
+
+	var resetAt time.Time
+	if reset > 1e9 {
+		sec, frac := math.Modf(reset)
+		resetAt = time.Unix(int64(sec), int64(frac*1e9))
+	} else {
+		resetAt = time.Now().Add(time.Duration(reset * float64(time.Second)))
+	}
+
+	l.mu.Lock()
+	if resetAt.After(l.pausedUntil) {
+		l.pausedUntil = resetAt
+	}
+	l.mu.Unlock()
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// readRepoFile reads the repository names listed in a --repo-file, one per
+// line as repo or workspace/repo. Blank lines and everything after a # are
+// ignored, and repeated names are only read once.
+func readRepoFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var names []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, _, _ := strings.Cut(scanner.Text(), "#")
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s lists no repositories", path)
+	}
+	return names, nil
+}
+
+// getRepositoriesByName looks up each named repository, up to workers at a
+// time, and returns them in the order given. A repository that can't be
+// fetched is recorded as a failure and left out rather than ending the run.
+func (c *BitbucketClient) getRepositoriesByName(ctx context.Context, names []string, workers int) []Repository {
+	found := make([]*Repository, len(names))
+	forEachIndex(ctx, len(names), workers, func(i int) {
+		repo, err := c.getRepository(ctx, names[i])
+		if err != nil {
+			c.failures.record(names[i], "repository lookup", err)
+			return
+		}
+		found[i] = repo
+	})
+
+	var repos []Repository
+	for _, repo := range found {
+		if repo != nil {
+			repos = append(repos, *repo)
+		}
+	}
+	return repos
+}
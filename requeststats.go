@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// repoRequestCost is the number of HTTP requests made for one repository and
+// the time spent in them
+type repoRequestCost struct {
+	requests int
+	elapsed  time.Duration
+}
+
+// requestStats attributes HTTP requests to repositories by their URL, so
+// --verbose can show which repositories drive the cost of a scan, and keeps
+// the run totals shown by --stats. It is safe for concurrent use.
+type requestStats struct {
+	mu     sync.Mutex
+	prefix string // baseURL + "/repositories/"
+	repos  map[string]*repoRequestCost
+
+	started     time.Time
+	calls       atomic.Int64 // HTTP requests sent, including retries
+	retries     atomic.Int64
+	cacheHits   atomic.Int64
+	cacheMisses atomic.Int64
+}
+
+func newRequestStats(baseURL string) *requestStats {
+	return &requestStats{prefix: baseURL + "/repositories/", repos: make(map[string]*repoRequestCost), started: time.Now()}
+}
+
+// record counts a request against the repository in its URL. Workspace-level
+// requests, such as listing repositories, aren't attributed to any repository.
+func (s *requestStats) record(url string, elapsed time.Duration) {
+	path, ok := strings.CutPrefix(url, s.prefix)
+	if !ok {
+		return
+	}
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) < 2 || parts[1] == "" {
+		return
+	}
+	fullName := parts[0] + "/" + parts[1]
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cost, ok := s.repos[fullName]
+	if !ok {
+		cost = &repoRequestCost{}
+		s.repos[fullName] = cost
+	}
+	cost.requests++
+	cost.elapsed += elapsed
+}
+
+// costOf returns the requests recorded so far for a repository
+func (s *requestStats) costOf(fullName string) repoRequestCost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cost, ok := s.repos[fullName]; ok {
+		return *cost
+	}
+	return repoRequestCost{}
+}
+
+// printRepoCost prints a repository's request count and time spent in requests
+// to stderr, so it doesn't mix with CSV or piped output
+func printRepoCost(client *BitbucketClient, repo Repository) {
+	cost := client.requestStats.costOf(repo.FullName)
+	fmt.Fprintf(os.Stderr, "repo %s: %d requests, %v elapsed\n", repo.FullName, cost.requests, cost.elapsed.Round(time.Millisecond))
+}
+
+// printTotals prints the run totals for --stats: API calls, retries, cache
+// hits and misses (when the cache is on) and wall time, to help size
+// --workers, --max-inflight and --rate-limit
+func (s *requestStats) printTotals(w io.Writer, cacheEnabled bool) {
+	elapsed := time.Since(s.started)
+	calls := s.calls.Load()
+	fmt.Fprintf(w, "\nRun statistics:\n")
+	fmt.Fprintf(w, "  API calls: %d (%.1f per second)\n", calls, float64(calls)/elapsed.Seconds())
+	fmt.Fprintf(w, "  Retries: %d\n", s.retries.Load())
+	if cacheEnabled {
+		fmt.Fprintf(w, "  Cache: %d hits, %d misses\n", s.cacheHits.Load(), s.cacheMisses.Load())
+	} else {
+		fmt.Fprintf(w, "  Cache: off\n")
+	}
+	fmt.Fprintf(w, "  Wall time: %v\n", elapsed.Round(time.Millisecond))
+}
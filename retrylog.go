@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// retryLogEntry is one line of the --retry-log file
+type retryLogEntry struct {
+	Time      time.Time `json:"time"`
+	URL       string    `json:"url"`
+	Attempt   int       `json:"attempt"`
+	Status    int       `json:"status,omitempty"` // HTTP status, absent for network errors
+	Error     string    `json:"error,omitempty"`
+	BackoffMs int64     `json:"backoff_ms,omitempty"`
+	Outcome   string    `json:"outcome"` // retrying, succeeded or failed
+}
+
+// retryLogger writes retried requests to a file as JSON lines. It is safe for
+// concurrent use, and a nil logger discards everything.
+type retryLogger struct {
+	mu      sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// newRetryLogger creates (or truncates) the retry log file
+func newRetryLogger(path string) (*retryLogger, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &retryLogger{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// record logs one attempt of a request that was, or is about to be, retried
+func (l *retryLogger) record(url string, attempt int, err error, backoff time.Duration, outcome string) {
+	if l == nil {
+		return
+	}
+
+	entry := retryLogEntry{
+		Time:      time.Now(),
+		URL:       url,
+		Attempt:   attempt,
+		BackoffMs: backoff.Milliseconds(),
+		Outcome:   outcome,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			entry.Status = apiErr.StatusCode
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.encoder.Encode(entry)
+}
+
+// Close closes the retry log file
+func (l *retryLogger) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.file.Close()
+}
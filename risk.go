@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// Inactivity risk scoring. A repository's score is the sum of three weighted
+// parts, so the weights add up to the maximum score of 100:
+//   - how long the repository has gone without activity, growing linearly
+//     until riskInactivityMonths
+//   - the fraction of its branches that are stale
+//   - whether it has open pull requests, which in an inactive repository
+//     are usually abandoned work
+const (
+	riskWeightInactivity = 50
+	riskWeightStale      = 30
+	riskWeightOpenPRs    = 20
+	riskInactivityMonths = 24 // months without activity that earn the full inactivity weight
+)
+
+// riskScore combines the inputs into a score from 0 (active) to 100
+func riskScore(monthsInactive, staleBranches, totalBranches, openPRs int) int {
+	inactivity := math.Min(float64(monthsInactive)/riskInactivityMonths, 1)
+	score := riskWeightInactivity * math.Max(inactivity, 0)
+	if totalBranches > 0 {
+		score += riskWeightStale * float64(staleBranches) / float64(totalBranches)
+	}
+	if openPRs > 0 {
+		score += riskWeightOpenPRs
+	}
+	return int(math.Round(score))
+}
+
+// riskScore returns the inactivity risk score of a repository. Branches come
+// from the client's cache when they have already been listed. Open pull
+// requests only count with --with-prs, which already looks them up; the count
+// is cached per repository and counts as none when it can't be determined.
+func (p *stalePolicy) riskScore(ctx context.Context, repo Repository) (int, error) {
+	branches, err := p.client.getBranches(ctx, repo.FullName)
+	if err != nil {
+		return 0, err
+	}
+	stale := 0
+	for _, branch := range branches {
+		if p.isStale(ctx, repo, branch) {
+			stale++
+		}
+	}
+	openPRs := 0
+	if p.withPRs {
+		if count, err := p.client.getOpenPullRequestCount(ctx, repo.FullName); err == nil {
+			openPRs = count
+		}
+	}
+	monthsInactive := 0 // an unknown last update adds no inactivity risk
+	if !repo.UpdatedOn.IsZero() {
+		monthsInactive = calculateMonthsDifference(repo.UpdatedOn, asOf)
+	}
+	return riskScore(monthsInactive, stale, len(branches), openPRs), nil
+}
+
+// sortResultsByRisk orders results for --sort risk, highest score first, or
+// lowest first with reverse. Scores are computed up to maxConcurrency
+// repositories at a time. Repositories whose score can't be computed sort
+// last either way.
+func sortResultsByRisk(ctx context.Context, results []RepositoryResult, policy *stalePolicy, reverse bool, maxConcurrency int) {
+	computed := make([]int, len(results))
+	forEachIndex(ctx, len(results), maxConcurrency, func(i int) {
+		score, err := policy.riskScore(ctx, results[i].Repository)
+		if err != nil {
+			score = -1
+		}
+		computed[i] = score
+	})
+	scores := make(map[string]int, len(results))
+	for i, result := range results {
+		scores[result.Repository.FullName] = computed[i]
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := scores[results[i].Repository.FullName], scores[results[j].Repository.FullName]
+		if a < 0 || b < 0 {
+			return a >= 0 && b < 0
+		}
+		if reverse {
+			return a < b
+		}
+		return a > b
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSortResultsByRisk(t *testing.T) {
+	var prRequests atomic.Int32
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/pullrequests") {
+			prRequests.Add(1)
+		}
+		fmt.Fprint(w, `{"values": [{"name": "main", "target": {"hash": "a", "date": "2020-01-01T00:00:00Z"}}]}`)
+	}))
+	policy := &stalePolicy{client: client, branchAge: monthsAge(6), repoMonths: 12}
+
+	repo := func(name string, updated time.Time) RepositoryResult {
+		return RepositoryResult{Repository: Repository{Name: name, FullName: "acme/" + name, UpdatedOn: updated}}
+	}
+	results := []RepositoryResult{
+		repo("active", asOf),
+		repo("unknown", time.Time{}),
+		repo("idle", asOf.AddDate(-3, 0, 0)),
+	}
+
+	sortResultsByRisk(context.Background(), results, policy, false, 4)
+	var order []string
+	for _, result := range results {
+		order = append(order, result.Repository.Name)
+	}
+	// An unknown last update adds no inactivity, so it ties with the active one
+	if got := strings.Join(order, ","); got != "idle,active,unknown" {
+		t.Errorf("order = %s, want idle,active,unknown", got)
+	}
+	if n := prRequests.Load(); n != 0 {
+		t.Errorf("made %d pull request requests without --with-prs, want 0", n)
+	}
+}
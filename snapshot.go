@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// Snapshot is a point-in-time record of a workspace's branches, saved with
+// --snapshot so later runs can be compared against it
+type Snapshot struct {
+	Workspace    string               `json:"workspace"`
+	TakenAt      time.Time            `json:"taken_at"`
+	Repositories []SnapshotRepository `json:"repositories"`
+}
+
+// SnapshotRepository holds the branches of one repository in a snapshot
+type SnapshotRepository struct {
+	FullName string           `json:"full_name"`
+	Branches []SnapshotBranch `json:"branches"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// SnapshotBranch is a branch as recorded in a snapshot
+type SnapshotBranch struct {
+	Name       string    `json:"name"`
+	Author     string    `json:"author"`
+	LastPushed time.Time `json:"last_pushed"`
+	Stale      bool      `json:"stale"`
+}
+
+// buildSnapshot fetches the branches of every repository concurrently and
+// records them in a snapshot, keeping the repositories in their given order
+func buildSnapshot(ctx context.Context, repos []Repository, client *BitbucketClient, policy *stalePolicy, maxConcurrency int) *Snapshot {
+	snapshot := &Snapshot{
+		Workspace:    client.workspaceLabel(),
+		TakenAt:      asOf,
+		Repositories: make([]SnapshotRepository, len(repos)),
+	}
+
+	forEachRepo(ctx, repos, maxConcurrency, func(i int, r Repository) {
+		entry := SnapshotRepository{FullName: r.FullName, Branches: []SnapshotBranch{}}
+		branches, err := client.getBranches(ctx, r.FullName)
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		for _, branch := range branches {
+			entry.Branches = append(entry.Branches, SnapshotBranch{
+				Name:       branch.Name,
+				Author:     branch.AuthorName(),
+				LastPushed: branch.Target.Date,
+				Stale:      policy.isStale(ctx, r, branch),
+			})
+		}
+		snapshot.Repositories[i] = entry
+	})
+
+	return snapshot
+}
+
+// writeSnapshot saves a snapshot as JSON
+func writeSnapshot(path string, snapshot *Snapshot) error {
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadSnapshot reads a snapshot written by writeSnapshot
+func loadSnapshot(path string) (*Snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot %s: %w", path, err)
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	return &snapshot, nil
+}
+
+// staleBranchesByAuthor counts stale branches per tip-commit author
+func staleBranchesByAuthor(snapshot *Snapshot, normalizer *authorNormalizer) map[string]int {
+	counts := make(map[string]int)
+	for _, repo := range snapshot.Repositories {
+		for _, branch := range repo.Branches {
+			if branch.Stale {
+				author := normalizer.canonical(branch.Author)
+				if author == "" {
+					author = "(unknown)"
+				}
+				counts[author]++
+			}
+		}
+	}
+	return counts
+}
+
+// AuthorDelta is the change in one author's stale-branch count between snapshots
+type AuthorDelta struct {
+	Author string
+	Before int
+	After  int
+	Delta  int
+}
+
+// diffAuthors computes per-author stale-branch deltas between two snapshots,
+// sorted from the biggest increase to the biggest decrease. Authors whose
+// count did not change are omitted.
+func diffAuthors(before, after *Snapshot, normalizer *authorNormalizer) []AuthorDelta {
+	beforeCounts := staleBranchesByAuthor(before, normalizer)
+	afterCounts := staleBranchesByAuthor(after, normalizer)
+
+	authors := make(map[string]bool)
+	for author := range beforeCounts {
+		authors[author] = true
+	}
+	for author := range afterCounts {
+		authors[author] = true
+	}
+
+	var deltas []AuthorDelta
+	for author := range authors {
+		delta := AuthorDelta{
+			Author: author,
+			Before: beforeCounts[author],
+			After:  afterCounts[author],
+		}
+		delta.Delta = delta.After - delta.Before
+		if delta.Delta != 0 {
+			deltas = append(deltas, delta)
+		}
+	}
+
+	sort.Slice(deltas, func(i, j int) bool {
+		if deltas[i].Delta != deltas[j].Delta {
+			return deltas[i].Delta > deltas[j].Delta
+		}
+		return deltas[i].Author < deltas[j].Author
+	})
+	return deltas
+}
+
+// displayAuthorDiff prints the biggest per-author increases and decreases in
+// stale branches between two snapshots
+func displayAuthorDiff(before, after *Snapshot, limit int, normalizer *authorNormalizer, red, green, cyan func(a ...interface{}) string) {
+	deltas := diffAuthors(before, after, normalizer)
+
+	fmt.Printf("\n%s\n", cyan("Stale Branch Changes by Author:"))
+	fmt.Printf("  From: %s (%s)\n", formatDate(before.TakenAt), before.Workspace)
+	fmt.Printf("  To:   %s (%s)\n", formatDate(after.TakenAt), after.Workspace)
+
+	if len(deltas) == 0 {
+		fmt.Println("\n  No changes in stale branch counts")
+		return
+	}
+
+	fmt.Printf("\n%s\n", cyan("Biggest Increases:"))
+	shown := 0
+	for _, d := range deltas {
+		if d.Delta <= 0 || shown == limit {
+			break
+		}
+		fmt.Printf("  %s: %d -> %d (%s)\n", d.Author, d.Before, d.After, red(fmt.Sprintf("+%d", d.Delta)))
+		shown++
+	}
+	if shown == 0 {
+		fmt.Println("  (none)")
+	}
+
+	fmt.Printf("\n%s\n", cyan("Biggest Decreases:"))
+	shown = 0
+	for i := len(deltas) - 1; i >= 0; i-- {
+		d := deltas[i]
+		if d.Delta >= 0 || shown == limit {
+			break
+		}
+		fmt.Printf("  %s: %d -> %d (%s)\n", d.Author, d.Before, d.After, green(fmt.Sprintf("%d", d.Delta)))
+		shown++
+	}
+	if shown == 0 {
+		fmt.Println("  (none)")
+	}
+	fmt.Println()
+}
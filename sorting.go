@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// validSortKeys are the values accepted by --sort
+var validSortKeys = []string{"name", "created", "updated", "age", "risk"}
+
+// parseSortKey validates a --sort value
+func parseSortKey(key string) (string, error) {
+	key = strings.ToLower(strings.TrimSpace(key))
+	for _, valid := range validSortKeys {
+		if key == valid {
+			return key, nil
+		}
+	}
+	return "", fmt.Errorf("invalid --sort %q (valid: %s)", key, strings.Join(validSortKeys, ", "))
+}
+
+// sortResults orders results in place by key:
+//   - name: repository name, A to Z
+//   - created: creation date, oldest first
+//   - updated: last activity, most recent first
+//   - age: time since last activity, longest inactive first
+//
+// risk needs each repository's branches and is sorted by sortResultsByRisk
+// instead. reverse flips the order. The sort is stable, so repositories with equal
+// keys keep their API order either way.
+func sortResults(results []RepositoryResult, key string, reverse bool) {
+	less := func(a, b Repository) bool {
+		switch key {
+		case "name":
+			return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+		case "created":
+			return a.CreatedOn.Before(b.CreatedOn)
+		case "updated":
+			return a.UpdatedOn.After(b.UpdatedOn)
+		default: // age
+			return a.UpdatedOn.Before(b.UpdatedOn)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if reverse {
+			return less(results[j].Repository, results[i].Repository)
+		}
+		return less(results[i].Repository, results[j].Repository)
+	})
+}
+
+// sortBranchesByPush returns the branches ordered by last push, stalest first,
+// with branches of unknown date last. The input slice is shared with the
+// client's branch cache, so a sorted copy is returned.
+func sortBranchesByPush(branches []Branch) []Branch {
+	sorted := make([]Branch, len(branches))
+	copy(sorted, branches)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Target.Date, sorted[j].Target.Date
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+	return sorted
+}
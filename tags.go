@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Tag is a repository tag as returned by the refs API. Annotated tags carry
+// their own tagger; lightweight tags only point at a commit.
+type Tag struct {
+	Name   string `json:"name"`
+	Tagger struct {
+		Raw  string `json:"raw"` // "Name <email>" of an annotated tag's tagger
+		User struct {
+			DisplayName string `json:"display_name"`
+		} `json:"user"`
+	} `json:"tagger"`
+	Target struct {
+		Hash   string    `json:"hash"`
+		Date   time.Time `json:"date"`
+		Author struct {
+			User struct {
+				DisplayName string `json:"display_name"`
+			} `json:"user"`
+		} `json:"author"`
+	} `json:"target"`
+}
+
+// TaggerName names who created a tag: the tagger of an annotated tag, or the
+// author of the tagged commit for lightweight tags
+func (t Tag) TaggerName() string {
+	if t.Tagger.User.DisplayName != "" {
+		return t.Tagger.User.DisplayName
+	}
+	if name := rawAuthorName(t.Tagger.Raw); name != "" {
+		return name
+	}
+	return t.Target.Author.User.DisplayName
+}
+
+// getTags lists all tags of a repository. Results are cached per client, so
+// the display, CSV and summary share one listing.
+func (c *BitbucketClient) getTags(ctx context.Context, repoFullName string) ([]Tag, error) {
+	c.tagsMu.Lock()
+	cached, ok := c.tags[repoFullName]
+	c.tagsMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	var allTags []Tag
+	url := c.flavor.tagsURL(c.baseURL, repoFullName)
+	for url != "" {
+		data, err := c.makeRequest(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		tags, next, err := c.flavor.parseTags(data, url)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range tags {
+			c.anonymizer.tag(&tags[i])
+		}
+		allTags = append(allTags, tags...)
+		url = next
+	}
+
+	// As with branches, resolve missing target dates from the tagged commit
+	for i := range allTags {
+		if allTags[i].Target.Date.IsZero() && allTags[i].Target.Hash != "" {
+			commit, err := c.getCommit(ctx, repoFullName, allTags[i].Target.Hash)
+			if err == nil {
+				allTags[i].Target.Date = commit.Date
+				if allTags[i].Target.Author.User.DisplayName == "" {
+					allTags[i].Target.Author.User.DisplayName = commitAuthorName(commit)
+				}
+			}
+		}
+	}
+
+	c.tagsMu.Lock()
+	c.tags[repoFullName] = allTags
+	c.tagsMu.Unlock()
+
+	return allTags, nil
+}
+
+// displayTags prints the tag section of the full repository display
+func displayTags(ctx context.Context, repo Repository, client *BitbucketClient, cyan func(a ...interface{}) string) {
+	fmt.Println("\n  Tags:")
+	tags, err := client.getTags(ctx, repo.FullName)
+	if err != nil {
+		fmt.Printf("    Error fetching tags: %v\n", err)
+		return
+	}
+	if len(tags) == 0 {
+		fmt.Println("    (no tags)")
+		return
+	}
+	for _, tag := range tags {
+		fmt.Printf("    %s\n", cyan("Tag: "+tag.Name))
+		fmt.Printf("      Commit Date: %s\n", formatDate(tag.Target.Date))
+		fmt.Printf("      Tagger: %s\n", tag.TaggerName())
+	}
+}
+
+// addTagStats totals the tags of repos concurrently. Repositories whose tags
+// couldn't be fetched are left out.
+func addTagStats(ctx context.Context, stats *SummaryStats, repos []Repository, client *BitbucketClient, maxConcurrency int) {
+	var mu sync.Mutex
+	total := 0
+	forEachRepo(ctx, repos, maxConcurrency, func(_ int, r Repository) {
+		tags, err := client.getTags(ctx, r.FullName)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		total += len(tags)
+		mu.Unlock()
+	})
+
+	stats.TotalTags = &total
+}
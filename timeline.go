@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// defaultTimelineMonths is how many months --timeline covers
+const defaultTimelineMonths = 12
+
+// maxTimelinePages bounds the commit pages read per repository for --timeline,
+// so very busy repositories stay cheap. Months beyond the cap show as empty.
+const maxTimelinePages = 20
+
+// Sparkline levels, lowest first. The lowest level is only used for months
+// without commits.
+var (
+	sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+	sparkASCII  = []rune("_.-=+*#@")
+)
+
+// monthsAgo returns how many calendar months before asOf t falls
+func monthsAgo(t time.Time) int {
+	return (asOf.Year()-t.Year())*12 + int(asOf.Month()-t.Month())
+}
+
+// getMonthlyCommitCounts counts a repository's commits in each of the last
+// months calendar months, oldest first. Commits come newest first, so paging
+// stops at the first page that reaches past the window.
+func (c *BitbucketClient) getMonthlyCommitCounts(ctx context.Context, repoFullName string, months int) ([]int, error) {
+	counts := make([]int, months)
+	url := c.flavor.commitsURL(c.baseURL, repoFullName, pageSize)
+
+	for page := 0; url != "" && page < maxTimelinePages; page++ {
+		data, err := c.makeCommitsRequest(ctx, url)
+		if errors.Is(err, errNoCommits) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		commits, next, err := c.flavor.parseCommits(data, url)
+		if err != nil {
+			return nil, err
+		}
+
+		url = next
+		for _, commit := range commits {
+			ago := monthsAgo(commit.Date)
+			if ago >= months {
+				url = ""
+				continue
+			}
+			if ago >= 0 {
+				counts[months-1-ago]++
+			}
+		}
+	}
+
+	return counts, nil
+}
+
+// sparkline renders counts as one character per value, scaled to the largest
+func sparkline(counts []int, ascii bool) string {
+	levels := sparkBlocks
+	if ascii {
+		levels = sparkASCII
+	}
+
+	peak := 0
+	for _, count := range counts {
+		peak = max(peak, count)
+	}
+
+	line := make([]rune, len(counts))
+	for i, count := range counts {
+		level := 0
+		if count > 0 {
+			// Any commits at all rise above the empty level
+			level = (count*(len(levels)-1) + peak - 1) / peak
+		}
+		line[i] = levels[level]
+	}
+	return string(line)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// validateCredentials implements --validate: it prints the account the
+// credentials authenticate as and the workspaces in use, checks each
+// workspace with checkWorkspaceAccess and returns the exit code. An account
+// that can't be looked up falls back to the configured username, as the
+// workspace checks decide whether the credentials work. Rejected credentials and missing workspaces are
+// configuration errors; an unreachable API leaves the question open and
+// exits with exitAPIError.
+func validateCredentials(ctx context.Context, client *BitbucketClient, w io.Writer) int {
+	fmt.Fprintf(w, "Provider:  %s (%s)\n", providerNames[client.provider], client.baseURL)
+	username, err := client.currentUser(ctx)
+	if err != nil {
+		configured := client.username
+		if client.accessToken != "" {
+			configured = "(access token)"
+		}
+		username = fmt.Sprintf("%s (account lookup failed: %v)", configured, err)
+	}
+	fmt.Fprintf(w, "Username:  %s\n", username)
+
+	workspaces := client.workspaces
+	if len(workspaces) == 0 {
+		workspaces = []string{client.workspace}
+	}
+	code := 0
+	for _, workspace := range workspaces {
+		err := client.checkWorkspaceAccess(ctx, workspace)
+		if err == nil {
+			fmt.Fprintf(w, "Workspace: %s - OK\n", workspace)
+			continue
+		}
+		fmt.Fprintf(w, "Workspace: %s - FAILED: %s\n", workspace, describeValidationError(err))
+		if exitCodeForError(err) == exitAPIError {
+			code = max(code, exitAPIError)
+		} else {
+			code = max(code, exitConfigError)
+		}
+	}
+	if code == 0 {
+		fmt.Fprintln(w, "Credentials are valid")
+	}
+	return code
+}
+
+// checkWorkspaceAccess makes a single authenticated request for a
+// one-repository page of the workspace's listing. It bypasses the response
+// cache and retries, so a cached listing can't hide revoked credentials and a
+// failure is reported at once.
+func (c *BitbucketClient) checkWorkspaceAccess(ctx context.Context, workspace string) error {
+	url, err := c.flavor.repositoriesURL(c.baseURL, workspace, "", "", 1)
+	if err != nil {
+		return err
+	}
+	_, _, err = c.doRequest(ctx, url)
+	return err
+}
+
+// currentUser makes a single request for the account the credentials
+// authenticate as, bypassing the cache and retries as checkWorkspaceAccess
+// does
+func (c *BitbucketClient) currentUser(ctx context.Context) (string, error) {
+	data, _, err := c.doRequest(ctx, c.flavor.currentUserURL(c.baseURL))
+	if err != nil {
+		return "", err
+	}
+	return c.flavor.parseCurrentUser(data)
+}
+
+// describeValidationError explains a failed --validate request in terms of
+// the configuration to fix
+func describeValidationError(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusUnauthorized:
+			return "the credentials were rejected (401 Unauthorized); check the username and app password or token"
+		case http.StatusForbidden:
+			return "access denied (403 Forbidden); the credentials lack permission or scopes for this workspace"
+		case http.StatusNotFound:
+			return "workspace not found (404 Not Found), or not visible to these credentials"
+		}
+	}
+	return err.Error()
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// parsePostHeaders parses --post-header values given as "Name: value"
+func parsePostHeaders(values []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, value := range values {
+		name, content, ok := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid --post-header %q (expected Name: value)", value)
+		}
+		headers.Add(name, strings.TrimSpace(content))
+	}
+	return headers, nil
+}
+
+// postResults sends the --json results to a --post-url webhook. It goes
+// through the client's transport, so the proxy and timeouts apply, but never
+// carries the hosting service's credentials; the endpoint's own go in
+// headers. A response other than 2xx is an error, quoting the start of the
+// response body.
+func (c *BitbucketClient) postResults(ctx context.Context, url string, headers http.Header, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeouts.request)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("posting results: %w", err)
+	}
+	req.Header = headers.Clone()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Transport: c.httpClient.Transport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("posting results: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		reply, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("posting results to %s failed with status %d: %s", url, resp.StatusCode, strings.Join(strings.Fields(string(reply)), " "))
+	}
+	return nil
+}